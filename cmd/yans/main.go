@@ -4,10 +4,12 @@ import (
 	"flag"
 	"github.com/ChronosX88/yans/internal/common"
 	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/logging"
 	"github.com/ChronosX88/yans/internal/server"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"syscall"
 )
 
 func main() {
@@ -16,32 +18,41 @@ func main() {
 	flag.Parse()
 
 	if *configPath == "" {
-		log.Fatal("No config provided!")
+		fatal("No config provided!")
 	}
 
 	cfg, err := config.ParseConfig(*configPath)
 	if err != nil {
-		log.Fatal(err)
+		fatal("Failed to parse config", "error", err)
+	}
+
+	if err := logging.Setup(cfg.LogLevel, cfg.LogFormat); err != nil {
+		fatal("Failed to set up logging", "error", err)
 	}
 
 	c := make(chan os.Signal, 1)
-	signal.Notify(c, os.Interrupt)
+	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
 
-	log.Printf("Starting %s...", common.ServerName)
+	slog.Info("Starting server", "name", common.ServerName)
 	ns, err := server.NewNNTPServer(cfg)
 	if err != nil {
-		log.Fatalf("Error occurred while starting the server: %s", err)
+		fatal("Error occurred while starting the server", "error", err)
 	}
 
 	if err := ns.Start(); err != nil {
-		log.Fatalf("Error occurred while starting the server: %s", err)
+		fatal("Error occurred while starting the server", "error", err)
 	}
-	log.Printf("%s has been successfully started!", common.ServerName)
-	log.Printf("Version: %s", common.ServerVersion)
+	slog.Info("Server has been successfully started", "name", common.ServerName, "version", common.ServerVersion)
 
 	for range c {
-		log.Printf("Stopping %s...", common.ServerName)
+		slog.Info("Stopping server", "name", common.ServerName)
 		ns.Stop()
+		slog.Info("Server has been stopped", "name", common.ServerName)
 		break
 	}
 }
+
+func fatal(msg string, args ...any) {
+	slog.Error(msg, args...)
+	os.Exit(1)
+}
@@ -0,0 +1,161 @@
+//go:build sqlite_fts5
+
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"net"
+	"net/textproto"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/backend/sqlite"
+	"github.com/ChronosX88/yans/internal/config"
+)
+
+// TestMain runs the server itself when the test binary is started by TestSIGTERMDuringPost
+func TestMain(m *testing.M) {
+	if path := os.Getenv("YANS_TEST_CONFIG"); path != "" {
+		os.Args = []string{"yans", "-config", path}
+		main()
+		os.Exit(0)
+	}
+	os.Exit(m.Run())
+}
+
+// freePort returns a port which nothing is listening on
+func freePort(t *testing.T) int {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	return ln.Addr().(*net.TCPAddr).Port
+}
+
+func TestSIGTERMDuringPost(t *testing.T) {
+	if testing.Short() {
+		t.Skip("spawns the server")
+	}
+
+	dir := t.TempDir()
+	dbPath := filepath.Join(dir, "yans.db")
+	b, err := sqlite.NewSQLiteBackend(config.SQLiteBackendConfig{Path: dbPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := b.CreateGroup(context.Background(), "test.group", "", false, "y"); err != nil {
+		t.Fatal(err)
+	}
+	b.Close()
+
+	port := freePort(t)
+	configPath := filepath.Join(dir, "yans.toml")
+	cfg := fmt.Sprintf("address = \"127.0.0.1\"\nport = %d\nws_port = %d\nbackend_type = \"sqlite\"\ndomain = \"news.example.com\"\nupload_path = %q\nshutdown_timeout = 10\n[sqlite]\npath = %q\n", port, freePort(t), dir, dbPath)
+	if err := os.WriteFile(configPath, []byte(cfg), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	cmd := exec.Command(os.Args[0], "-test.run=^$")
+	cmd.Env = append(os.Environ(), "YANS_TEST_CONFIG="+configPath)
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	exited := make(chan error, 1)
+	go func() { exited <- cmd.Wait() }()
+	defer func() {
+		cmd.Process.Kill()
+		<-exited
+	}()
+
+	var conn net.Conn
+	for deadline := time.Now().Add(10 * time.Second); ; time.Sleep(50 * time.Millisecond) {
+		if conn, err = net.Dial("tcp", fmt.Sprintf("127.0.0.1:%d", port)); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("server isn't listening: %v", err)
+		}
+	}
+	c := textproto.NewConn(conn)
+	defer c.Close()
+	if _, _, err := c.ReadCodeLine(201); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := c.PrintfLine("POST"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ReadCodeLine(340); err != nil {
+		t.Fatal(err)
+	}
+	c.PrintfLine("From: poster@example.com")
+	c.PrintfLine("Newsgroups: test.group")
+	c.PrintfLine("Subject: slow post")
+	c.PrintfLine("")
+	c.PrintfLine("first half")
+
+	// the server is stopped while the article is still being sent
+	if err := cmd.Process.Signal(syscall.SIGTERM); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(500 * time.Millisecond)
+	select {
+	case err := <-exited:
+		exited <- err
+		t.Fatalf("server exited in the middle of the POST: %v", err)
+	default:
+	}
+
+	c.PrintfLine("second half")
+	c.PrintfLine(".")
+	if _, message, err := c.ReadCodeLine(240); err != nil {
+		t.Fatalf("POST isn't finished: %v %s", err, message)
+	}
+	// the drained session is closed after the command
+	if _, _, err := c.ReadCodeLine(400); err != nil {
+		t.Fatalf("connection isn't closed on shutdown: %v", err)
+	}
+
+	select {
+	case err := <-exited:
+		exited <- err
+		if err != nil {
+			t.Fatalf("server exited with %v", err)
+		}
+	case <-time.After(10 * time.Second):
+		t.Fatal("server hasn't exited after the drain")
+	}
+
+	b, err = sqlite.NewSQLiteBackend(config.SQLiteBackendConfig{Path: dbPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	articles, err := b.GetArticlesByHeader(context.Background(), "Subject", "slow post")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(articles) != 1 || strings.ReplaceAll(articles[0].Body, "\r\n", "\n") != "first half\nsecond half\n" {
+		t.Fatalf("stored articles = %+v, want the whole post", articles)
+	}
+
+	// the driver is registered by the backend package
+	db, err := sql.Open("sqlite3", dbPath)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	var integrity string
+	if err := db.QueryRow("PRAGMA integrity_check").Scan(&integrity); err != nil || integrity != "ok" {
+		t.Errorf("database integrity check = %q, %v", integrity, err)
+	}
+}
@@ -0,0 +1,618 @@
+package admin
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/expiration"
+	"github.com/ChronosX88/yans/internal/mbox"
+	"github.com/ChronosX88/yans/internal/models"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// API is an HTTP interface for server administration tasks.
+// It doesn't perform any authentication, so it must only be exposed on trusted interfaces.
+type API struct {
+	backend  backend.StorageBackend
+	expirer  *expiration.Expirer
+	archiver *mbox.Archiver
+	server   *http.Server
+}
+
+type createGroupRequest struct {
+	Name           string `json:"name"`
+	Description    string `json:"description"`
+	Moderated      bool   `json:"moderated"`
+	ModeratorEmail string `json:"moderator_email"`
+	PostingStatus  string `json:"posting_status"`
+}
+
+type createUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+// fields which are absent in the request are left unchanged
+type updateGroupRequest struct {
+	Description    *string `json:"description"`
+	ModeratorEmail *string `json:"moderator_email"`
+	PostingStatus  *string `json:"posting_status"`
+}
+
+type setPermissionRequest struct {
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type moderateArticleRequest struct {
+	MessageID  string `json:"message_id"`
+	Approved   bool   `json:"approved"`
+	ApprovedBy string `json:"approved_by"`
+}
+
+type addArticleRequest struct {
+	MessageID string `json:"message_id"`
+}
+
+type groupResponse struct {
+	Name           string     `json:"name"`
+	Description    string     `json:"description"`
+	Moderated      bool       `json:"moderated"`
+	ModeratorEmail string     `json:"moderator_email"`
+	PostingStatus  string     `json:"posting_status"`
+	CreatedAt      time.Time  `json:"created_at"`
+	LastPostAt     *time.Time `json:"last_post_at,omitempty"` // absent for empty groups
+}
+
+type orphanedArticleResponse struct {
+	MessageID string    `json:"message_id"`
+	Subject   string    `json:"subject"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type spoolResponse struct {
+	Bytes int64 `json:"bytes"`
+}
+
+type deletedResponse struct {
+	Deleted int `json:"deleted"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+func NewAPI(b backend.StorageBackend, expirer *expiration.Expirer, uploadPath, address string) *API {
+	api := &API{backend: b, expirer: expirer, archiver: mbox.NewArchiver(b, uploadPath)}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/groups", api.handleGroups)
+	mux.HandleFunc("/groups/", api.handleGroup)
+	mux.HandleFunc("/users", api.handleUsers)
+	mux.HandleFunc("/expire", api.handleExpire)
+	mux.HandleFunc("/moderate", api.handleModerate)
+	mux.HandleFunc("/orphans", api.handleOrphans)
+	mux.HandleFunc("/hierarchies", api.handleHierarchies)
+	mux.HandleFunc("/spool", api.handleSpool)
+
+	api.server = &http.Server{Addr: address, Handler: mux}
+	return api
+}
+
+func (api *API) Start() {
+	go func() {
+		slog.Info("Admin API is listening", "address", api.server.Addr)
+		if err := api.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Admin API has failed", "error", err)
+		}
+	}()
+}
+
+func (api *API) Stop(ctx context.Context) error {
+	return api.server.Shutdown(ctx)
+}
+
+// handleGroups handles GET /groups and POST /groups
+func (api *API) handleGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method == http.MethodGet {
+		api.handleListGroups(w, r)
+		return
+	}
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req createGroupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Name == "" {
+		writeError(w, http.StatusBadRequest, "group name is required")
+		return
+	}
+	if !backend.IsValidPostingStatus(req.PostingStatus) {
+		writeError(w, http.StatusBadRequest, "posting status must be one of: y, n, m")
+		return
+	}
+
+	if err := api.backend.CreateGroup(r.Context(), req.Name, req.Description, req.Moderated, req.PostingStatus); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if req.ModeratorEmail != "" {
+		if err := api.backend.UpdateGroupModeratorEmail(r.Context(), req.Name, req.ModeratorEmail); err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleListGroups lists all the groups, or either moderated or unmoderated ones if the moderated parameter is set
+func (api *API) handleListGroups(w http.ResponseWriter, r *http.Request) {
+	var groups []models.Group
+	var err error
+	if v := r.URL.Query().Get("moderated"); v != "" {
+		moderated, perr := strconv.ParseBool(v)
+		if perr != nil {
+			writeError(w, http.StatusBadRequest, "moderated must be true or false")
+			return
+		}
+		groups, err = api.backend.GetGroupsByModeratedStatus(r.Context(), moderated)
+	} else {
+		groups, err = api.backend.ListGroups(r.Context())
+	}
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := []groupResponse{}
+	for _, v := range groups {
+		g := groupResponse{
+			Name:          v.GroupName,
+			Moderated:     v.Moderated,
+			PostingStatus: v.PostingStatus,
+			CreatedAt:     v.CreatedAt,
+		}
+		if v.Description != nil {
+			g.Description = *v.Description
+		}
+		if v.ModeratorEmail != nil {
+			g.ModeratorEmail = *v.ModeratorEmail
+		}
+		lastPost, err := api.backend.GetGroupLastPostTime(r.Context(), v.GroupName)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !lastPost.IsZero() {
+			g.LastPostAt = &lastPost
+		}
+		res = append(res, g)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleGroup handles DELETE /groups/{name}, PATCH /groups/{name}, POST /groups/{name}/permissions,
+// GET /groups/{name}/export, POST /groups/{name}/import, POST /groups/{name}/articles, GET/PATCH /groups/{name}/meta
+// and GET /groups/{name}/spool
+func (api *API) handleGroup(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/groups/")
+	if name := strings.TrimSuffix(path, "/permissions"); name != path && name != "" && !strings.Contains(name, "/") {
+		api.handleGroupPermissions(w, r, name)
+		return
+	}
+	if name := strings.TrimSuffix(path, "/export"); name != path && name != "" && !strings.Contains(name, "/") {
+		api.handleGroupExport(w, r, name)
+		return
+	}
+	if name := strings.TrimSuffix(path, "/import"); name != path && name != "" && !strings.Contains(name, "/") {
+		api.handleGroupImport(w, r, name)
+		return
+	}
+	if name := strings.TrimSuffix(path, "/articles"); name != path && name != "" && !strings.Contains(name, "/") {
+		api.handleGroupArticles(w, r, name)
+		return
+	}
+	if name := strings.TrimSuffix(path, "/meta"); name != path && name != "" && !strings.Contains(name, "/") {
+		api.handleGroupMeta(w, r, name)
+		return
+	}
+	if name := strings.TrimSuffix(path, "/spool"); name != path && name != "" && !strings.Contains(name, "/") {
+		api.handleGroupSpool(w, r, name)
+		return
+	}
+
+	name := path
+	if name == "" || strings.Contains(name, "/") {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	var err error
+	switch r.Method {
+	case http.MethodDelete:
+		{
+			err = api.backend.DeleteGroup(r.Context(), name)
+		}
+	case http.MethodPatch:
+		{
+			var req updateGroupRequest
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			if req.Description != nil {
+				err = api.backend.UpdateGroupDescription(r.Context(), name, *req.Description)
+			}
+			if err == nil && req.ModeratorEmail != nil {
+				err = api.backend.UpdateGroupModeratorEmail(r.Context(), name, *req.ModeratorEmail)
+			}
+			if err == nil && req.PostingStatus != nil {
+				if len(*req.PostingStatus) != 1 {
+					err = backend.ErrInvalidStatus
+				} else {
+					err = api.backend.UpdateGroupPosting(r.Context(), name, (*req.PostingStatus)[0])
+				}
+			}
+		}
+	default:
+		{
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "no such newsgroup")
+			return
+		}
+		if err == backend.ErrInvalidStatus {
+			writeError(w, http.StatusBadRequest, "posting status must be one of: y, n, m")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGroupPermissions grants a role in the group to a user
+func (api *API) handleGroupPermissions(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req setPermissionRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	switch req.Role {
+	case models.RoleReader, models.RolePoster, models.RoleModerator:
+	default:
+		{
+			writeError(w, http.StatusBadRequest, "role must be one of: reader, poster, moderator")
+			return
+		}
+	}
+
+	userID, err := api.backend.GetUserID(r.Context(), req.Username)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "no such user")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := api.backend.SetPermission(r.Context(), userID, name, req.Role); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "no such newsgroup")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGroupMeta returns the group metadata, PATCH sets the keys of the JSON object in the request body
+func (api *API) handleGroupMeta(w http.ResponseWriter, r *http.Request, name string) {
+	switch r.Method {
+	case http.MethodGet:
+		// the metadata is sent below, as well as after PATCH
+	case http.MethodPatch:
+		{
+			var req map[string]string
+			if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+				writeError(w, http.StatusBadRequest, err.Error())
+				return
+			}
+			for k, v := range req {
+				if err := api.backend.SetGroupMeta(r.Context(), name, k, v); err != nil {
+					if err == sql.ErrNoRows {
+						writeError(w, http.StatusNotFound, "no such newsgroup")
+						return
+					}
+					writeError(w, http.StatusInternalServerError, err.Error())
+					return
+				}
+			}
+		}
+	default:
+		{
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+	}
+
+	meta, err := api.backend.GetGroupMeta(r.Context(), name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "no such newsgroup")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, meta)
+}
+
+// handleGroupSpool responds with the size of the group article bodies
+func (api *API) handleGroupSpool(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	g, err := api.backend.GetGroup(r.Context(), name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "no such newsgroup")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	size, err := api.backend.GetSpoolSizeForGroup(r.Context(), &g)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, spoolResponse{Bytes: size})
+}
+
+// handleGroupExport sends all the group articles as an mbox file
+func (api *API) handleGroupExport(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	g, err := api.backend.GetGroup(r.Context(), name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "no such newsgroup")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/mbox")
+	if err := api.archiver.ExportGroup(r.Context(), &g, w); err != nil {
+		// the status is already sent at this point
+		slog.Error("Failed to export group", "group", name, "error", err)
+	}
+}
+
+// handleGroupImport saves the articles from the mbox file in the request body into the group
+func (api *API) handleGroupImport(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	g, err := api.backend.GetGroup(r.Context(), name)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "no such newsgroup")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := api.archiver.ImportGroup(r.Context(), &g, r.Body); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleGroupArticles adds an existing article to the group, e.g. when a cross-post arrives after it was posted
+func (api *API) handleGroupArticles(w http.ResponseWriter, r *http.Request, name string) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req addArticleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.MessageID == "" {
+		writeError(w, http.StatusBadRequest, "message id is required")
+		return
+	}
+
+	if err := api.backend.DuplicateArticleToGroup(r.Context(), req.MessageID, name); err != nil {
+		switch err {
+		case sql.ErrNoRows:
+			writeError(w, http.StatusNotFound, "no such article or newsgroup")
+		case backend.ErrAlreadyInGroup:
+			writeError(w, http.StatusConflict, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, err.Error())
+		}
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// handleUsers handles POST /users
+func (api *API) handleUsers(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req createUserRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.Username == "" || req.Password == "" {
+		writeError(w, http.StatusBadRequest, "username and password are required")
+		return
+	}
+
+	if err := api.backend.CreateUser(r.Context(), req.Username, req.Password); err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+}
+
+// handleExpire handles POST /expire
+func (api *API) handleExpire(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	deleted, err := api.expirer.Run(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, deletedResponse{Deleted: deleted})
+}
+
+// handleOrphans handles GET /orphans listing the articles which aren't in any group and DELETE /orphans pruning them
+func (api *API) handleOrphans(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		{
+			articles, err := api.backend.GetOrphanedArticles(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			res := []orphanedArticleResponse{}
+			for _, v := range articles {
+				res = append(res, orphanedArticleResponse{
+					MessageID: v.Header.Get("Message-Id"),
+					Subject:   v.Header.Get("Subject"),
+					CreatedAt: v.CreatedAt,
+				})
+			}
+			writeJSON(w, http.StatusOK, res)
+		}
+	case http.MethodDelete:
+		{
+			deleted, err := api.backend.PruneOrphanedArticles(r.Context())
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			writeJSON(w, http.StatusOK, deletedResponse{Deleted: deleted})
+		}
+	default:
+		{
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// handleHierarchies handles GET /hierarchies, responding with the number of groups in each top-level hierarchy
+func (api *API) handleHierarchies(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	counts, err := api.backend.GetGroupCountsByHierarchy(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, counts)
+}
+
+// handleSpool handles GET /spool, responding with the total size of the article bodies
+func (api *API) handleSpool(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	size, err := api.backend.GetSpoolSize(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	writeJSON(w, http.StatusOK, spoolResponse{Bytes: size})
+}
+
+// handleModerate handles POST /moderate
+func (api *API) handleModerate(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	var req moderateArticleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.MessageID == "" {
+		writeError(w, http.StatusBadRequest, "message id is required")
+		return
+	}
+
+	if err := api.backend.ModerateArticle(r.Context(), req.MessageID, req.Approved, req.ApprovedBy); err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "no such article")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Failed to write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
@@ -0,0 +1,119 @@
+// Package auth verifies credentials issued by external authentication systems.
+package auth
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"strings"
+	"time"
+)
+
+// scopes granting NNTP access, at least one of them is required
+const (
+	ScopeRead = "nntp:read"
+	ScopePost = "nntp:post"
+)
+
+var (
+	ErrInvalidToken = errors.New("invalid token")
+	ErrTokenExpired = errors.New("token is expired or not valid yet")
+	ErrMissingScope = errors.New("token has no nntp scope")
+)
+
+// JWTClaims are the registered claims used for authentication, scope is a space-separated list as in OAuth 2.0
+type JWTClaims struct {
+	Subject   string `json:"sub"`
+	ExpiresAt int64  `json:"exp"`
+	NotBefore int64  `json:"nbf"`
+	Scope     string `json:"scope"`
+}
+
+// HasScope tells whether the scope is granted by the token
+func (c JWTClaims) HasScope(scope string) bool {
+	for _, v := range strings.Fields(c.Scope) {
+		if v == scope {
+			return true
+		}
+	}
+	return false
+}
+
+// JWTValidator verifies tokens signed with a shared secret
+type JWTValidator struct {
+	algorithm string
+	hash      func() hash.Hash
+	secret    []byte
+}
+
+// NewJWTValidator creates the validator for one of HS256 (default), HS384 and HS512 algorithms
+func NewJWTValidator(secret, algorithm string) (*JWTValidator, error) {
+	v := &JWTValidator{algorithm: algorithm, secret: []byte(secret)}
+	switch algorithm {
+	case "", "HS256":
+		v.algorithm = "HS256"
+		v.hash = sha256.New
+	case "HS384":
+		v.hash = sha512.New384
+	case "HS512":
+		v.hash = sha512.New
+	default:
+		return nil, fmt.Errorf("unsupported JWT algorithm %q", algorithm)
+	}
+	if secret == "" {
+		return nil, errors.New("JWT secret is empty")
+	}
+	return v, nil
+}
+
+// ValidateJWT verifies the token signature, its expiry and the presence of an nntp scope.
+// Tokens signed with other algorithms than the configured one are rejected.
+func (v *JWTValidator) ValidateJWT(token string) (JWTClaims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return JWTClaims{}, ErrInvalidToken
+	}
+
+	var header struct {
+		Algorithm string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Algorithm != v.algorithm {
+		return JWTClaims{}, ErrInvalidToken
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return JWTClaims{}, ErrInvalidToken
+	}
+	mac := hmac.New(v.hash, v.secret)
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	if !hmac.Equal(signature, mac.Sum(nil)) {
+		return JWTClaims{}, ErrInvalidToken
+	}
+
+	var claims JWTClaims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return JWTClaims{}, ErrInvalidToken
+	}
+	now := time.Now().Unix()
+	if claims.ExpiresAt == 0 || now >= claims.ExpiresAt || now < claims.NotBefore {
+		return JWTClaims{}, ErrTokenExpired
+	}
+	if !claims.HasScope(ScopeRead) && !claims.HasScope(ScopePost) {
+		return JWTClaims{}, ErrMissingScope
+	}
+	return claims, nil
+}
+
+func decodeSegment(segment string, v interface{}) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
@@ -0,0 +1,43 @@
+package backend
+
+import (
+	"encoding/json"
+	"github.com/ChronosX88/yans/internal/models"
+	"net/textproto"
+	"sort"
+)
+
+// CanonicalizeHeaders returns the header with all field names in the canonical form, e.g. Message-Id for message-ID.
+// Values of the fields whose names differ only in case are merged.
+func CanonicalizeHeaders(h map[string][]string) map[string][]string {
+	keys := make([]string, 0, len(h))
+	for k := range h {
+		keys = append(keys, k)
+	}
+	// the order of the merged values mustn't depend on the map iteration
+	sort.Strings(keys)
+
+	res := make(map[string][]string, len(h))
+	for _, k := range keys {
+		name := textproto.CanonicalMIMEHeaderKey(k)
+		res[name] = append(res[name], h[k]...)
+	}
+	return res
+}
+
+// CanonicalizeArticleHeader canonicalizes the field names of the stored header JSON and updates the parsed header accordingly
+func CanonicalizeArticleHeader(a *models.Article) error {
+	var h map[string][]string
+	if err := json.Unmarshal([]byte(a.HeaderRaw), &h); err != nil {
+		return err
+	}
+	h = CanonicalizeHeaders(h)
+
+	raw, err := json.Marshal(h)
+	if err != nil {
+		return err
+	}
+	a.HeaderRaw = string(raw)
+	a.Header = h
+	return nil
+}
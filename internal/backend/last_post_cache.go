@@ -0,0 +1,42 @@
+package backend
+
+import (
+	"sync"
+	"time"
+)
+
+// how long the last post times are kept, posts made meanwhile aren't reflected until then
+const lastPostCacheTTL = time.Minute
+
+type lastPostEntry struct {
+	lastPost time.Time
+	cachedAt time.Time
+}
+
+// LastPostCache keeps the last post times of groups for a short while, so listings of all the groups
+// don't query each of them every time
+type LastPostCache struct {
+	entries sync.Map
+}
+
+func NewLastPostCache() *LastPostCache {
+	return &LastPostCache{}
+}
+
+// Get returns the cached time of the group, ok is false if it's absent or expired
+func (c *LastPostCache) Get(groupName string) (time.Time, bool) {
+	v, ok := c.entries.Load(groupName)
+	if !ok {
+		return time.Time{}, false
+	}
+	e := v.(lastPostEntry)
+	if time.Since(e.cachedAt) > lastPostCacheTTL {
+		c.entries.Delete(groupName)
+		return time.Time{}, false
+	}
+	return e.lastPost, true
+}
+
+func (c *LastPostCache) Set(groupName string, lastPost time.Time) {
+	c.entries.Store(groupName, lastPostEntry{lastPost: lastPost, cachedAt: time.Now()})
+}
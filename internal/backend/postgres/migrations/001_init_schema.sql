@@ -0,0 +1,28 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS groups(
+    id SERIAL PRIMARY KEY,
+    group_name TEXT UNIQUE NOT NULL,
+    description TEXT,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+CREATE TABLE IF NOT EXISTS articles(
+    id SERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    header JSONB,
+    thread TEXT,
+    body TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS articles_to_groups(
+    article_id INTEGER NOT NULL,
+    article_number INTEGER,
+    group_id INTEGER NOT NULL,
+    FOREIGN KEY (article_id) REFERENCES articles(id) ON DELETE CASCADE,
+    FOREIGN KEY (group_id) REFERENCES groups(id) ON DELETE CASCADE
+);
+
+-- +goose Down
+
+DROP TABLE articles_to_groups;
+DROP TABLE articles;
+DROP TABLE groups;
@@ -0,0 +1,14 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS users(
+    id SERIAL PRIMARY KEY,
+    username TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+ALTER TABLE groups ADD COLUMN requires_auth BOOLEAN NOT NULL DEFAULT FALSE;
+
+-- +goose Down
+
+DROP TABLE IF EXISTS users;
+ALTER TABLE groups DROP COLUMN requires_auth;
@@ -0,0 +1,12 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS permissions(
+    user_id INTEGER NOT NULL REFERENCES users(id) ON DELETE CASCADE,
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    role TEXT NOT NULL CHECK (role IN ('reader', 'poster', 'moderator')),
+    PRIMARY KEY (user_id, group_id)
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS permissions;
@@ -0,0 +1,7 @@
+-- +goose Up
+
+CREATE UNIQUE INDEX IF NOT EXISTS articles_message_id ON articles((header->'Message-Id'->>0));
+
+-- +goose Down
+
+DROP INDEX IF EXISTS articles_message_id;
@@ -0,0 +1,11 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS peer_sync_state(
+    peer_id TEXT PRIMARY KEY,
+    last_article_id INTEGER NOT NULL,
+    updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS peer_sync_state;
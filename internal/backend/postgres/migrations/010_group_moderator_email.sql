@@ -0,0 +1,7 @@
+-- +goose Up
+
+ALTER TABLE groups ADD COLUMN moderator_email TEXT;
+
+-- +goose Down
+
+ALTER TABLE groups DROP COLUMN moderator_email;
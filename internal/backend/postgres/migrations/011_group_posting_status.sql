@@ -0,0 +1,8 @@
+-- +goose Up
+
+ALTER TABLE groups ADD COLUMN posting_status CHAR(1) NOT NULL DEFAULT 'y' CHECK (posting_status IN ('y', 'n', 'm'));
+UPDATE groups SET posting_status = 'm' WHERE moderated;
+
+-- +goose Down
+
+ALTER TABLE groups DROP COLUMN posting_status;
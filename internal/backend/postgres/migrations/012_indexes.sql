@@ -0,0 +1,9 @@
+-- +goose Up
+
+CREATE INDEX IF NOT EXISTS idx_atg_group_num ON articles_to_groups(group_id, article_number);
+CREATE INDEX IF NOT EXISTS idx_articles_created ON articles(created_at);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_atg_group_num;
+DROP INDEX IF EXISTS idx_articles_created;
@@ -0,0 +1,10 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS attachments (
+    attachment_id TEXT PRIMARY KEY,
+    content BYTEA NOT NULL
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS attachments;
@@ -0,0 +1,12 @@
+-- +goose Up
+
+-- filled with utils.NormalizeEmail on saving, existing articles get its approximation
+ALTER TABLE articles ADD COLUMN from_email TEXT NOT NULL DEFAULT '';
+UPDATE articles SET from_email = lower(trim(COALESCE(header->'From'->>0, '')));
+UPDATE articles SET from_email = trim(substring(from_email from '<([^>]*)>')) WHERE from_email ~ '<[^>]*>';
+CREATE INDEX IF NOT EXISTS idx_articles_from_email ON articles(from_email);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_articles_from_email;
+ALTER TABLE articles DROP COLUMN from_email;
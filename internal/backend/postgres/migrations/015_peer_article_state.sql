@@ -0,0 +1,13 @@
+-- +goose Up
+
+-- articles fed to the peer beyond its peer_sync_state.last_article_id, rows at or below it are pruned
+CREATE TABLE IF NOT EXISTS peer_article_state(
+    peer_id TEXT NOT NULL,
+    article_id INTEGER NOT NULL,
+    sent_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+    PRIMARY KEY (peer_id, article_id)
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS peer_article_state;
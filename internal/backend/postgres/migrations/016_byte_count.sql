@@ -0,0 +1,23 @@
+-- +goose Up
+
+-- header and body size in bytes reported by OVER, kept by the trigger below
+ALTER TABLE articles ADD COLUMN byte_count INTEGER NOT NULL DEFAULT 0;
+UPDATE articles SET byte_count = octet_length(header::text) + octet_length(body);
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION articles_byte_count() RETURNS trigger AS $$
+BEGIN
+    NEW.byte_count := octet_length(NEW.header::text) + octet_length(NEW.body);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER articles_byte_count BEFORE INSERT OR UPDATE OF header, body ON articles
+    FOR EACH ROW EXECUTE FUNCTION articles_byte_count();
+
+-- +goose Down
+
+DROP TRIGGER IF EXISTS articles_byte_count ON articles;
+DROP FUNCTION IF EXISTS articles_byte_count();
+ALTER TABLE articles DROP COLUMN byte_count;
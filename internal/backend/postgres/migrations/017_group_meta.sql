@@ -0,0 +1,13 @@
+-- +goose Up
+
+-- free-form settings of extensions, e.g. spam filter thresholds or archive URLs
+CREATE TABLE IF NOT EXISTS group_meta(
+    group_id INTEGER NOT NULL REFERENCES groups(id) ON DELETE CASCADE,
+    key TEXT NOT NULL,
+    value TEXT NOT NULL,
+    PRIMARY KEY (group_id, key)
+);
+
+-- +goose Down
+
+DROP TABLE IF EXISTS group_meta;
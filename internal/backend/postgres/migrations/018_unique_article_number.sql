@@ -0,0 +1,11 @@
+-- +goose Up
+
+-- numbers are allocated under the group row lock, the constraint guards against duplicates anyway.
+-- It's deferrable to be checked at the end of statements, so renumbering doesn't conflict with itself.
+ALTER TABLE articles_to_groups ADD CONSTRAINT atg_group_number_unique UNIQUE (group_id, article_number) DEFERRABLE INITIALLY IMMEDIATE;
+DROP INDEX IF EXISTS idx_atg_group_num;
+
+-- +goose Down
+
+CREATE INDEX IF NOT EXISTS idx_atg_group_num ON articles_to_groups(group_id, article_number);
+ALTER TABLE articles_to_groups DROP CONSTRAINT IF EXISTS atg_group_number_unique;
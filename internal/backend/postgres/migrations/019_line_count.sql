@@ -0,0 +1,28 @@
+-- +goose Up
+
+-- number of the body lines reported by OVER, kept along with byte_count so it isn't counted on every query
+ALTER TABLE articles ADD COLUMN line_count INTEGER NOT NULL DEFAULT 0;
+UPDATE articles SET line_count = length(body) - length(replace(body, E'\n', ''));
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION articles_byte_count() RETURNS trigger AS $$
+BEGIN
+    NEW.byte_count := octet_length(NEW.header::text) + octet_length(NEW.body);
+    NEW.line_count := length(NEW.body) - length(replace(NEW.body, E'\n', ''));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION articles_byte_count() RETURNS trigger AS $$
+BEGIN
+    NEW.byte_count := octet_length(NEW.header::text) + octet_length(NEW.body);
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+ALTER TABLE articles DROP COLUMN line_count;
@@ -0,0 +1,34 @@
+-- +goose Up
+
+-- byte_count is the size of the article as sent by ARTICLE, the same as models.Article.WireSize computes:
+-- "Name: value" CRLF for every header value, the empty line and the body lines terminated with CRLF
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION articles_byte_count() RETURNS trigger AS $$
+DECLARE
+    b text := replace(NEW.body, E'\r\n', E'\n');
+BEGIN
+    NEW.byte_count := 2 + (SELECT COALESCE(SUM(octet_length(h.key) + octet_length(v.value) + 4), 0) FROM jsonb_each(NEW.header) h, jsonb_array_elements_text(h.value) v)
+        + octet_length(b) + length(b) - length(replace(b, E'\n', ''))
+        + CASE WHEN b = '' OR right(b, 1) = E'\n' THEN 0 ELSE 2 END;
+    NEW.line_count := length(NEW.body) - length(replace(NEW.body, E'\n', ''));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- the trigger recounts the existing articles
+UPDATE articles SET body = body;
+
+-- +goose Down
+
+-- +goose StatementBegin
+CREATE OR REPLACE FUNCTION articles_byte_count() RETURNS trigger AS $$
+BEGIN
+    NEW.byte_count := octet_length(NEW.header::text) + octet_length(NEW.body);
+    NEW.line_count := length(NEW.body) - length(replace(NEW.body, E'\n', ''));
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+UPDATE articles SET body = body;
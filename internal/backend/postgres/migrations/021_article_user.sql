@@ -0,0 +1,9 @@
+-- +goose Up
+
+-- authenticated user who has posted the article to this server, NULL for anonymous, transit and imported articles.
+-- The user ids aren't reused, so the cancel permission can't pass to another user.
+ALTER TABLE articles ADD COLUMN user_id INTEGER;
+
+-- +goose Down
+
+ALTER TABLE articles DROP COLUMN user_id;
@@ -0,0 +1,48 @@
+package backend
+
+import (
+	"database/sql"
+	"github.com/ChronosX88/yans/internal/models"
+	"strings"
+)
+
+// BuildReferencesTree links the articles into the tree rooted at rootMessageID, mapping the message-id of every
+// article in it to the message-ids of its replies. The parent of an article is taken from its In-Reply-To header,
+// or the last entry of References if it's absent. Articles which aren't connected to the root are left out.
+// sql.ErrNoRows is returned if the root isn't among the articles.
+func BuildReferencesTree(rootMessageID string, articles []models.Article) (map[string][]string, error) {
+	replies := map[string][]string{}
+	found := false
+	for _, v := range articles {
+		messageID := v.Header.Get("Message-Id")
+		if messageID == rootMessageID {
+			found = true
+			continue
+		}
+		parent := v.Header.Get("In-Reply-To")
+		if parent == "" {
+			if refs := strings.Fields(v.Header.Get("References")); len(refs) > 0 {
+				parent = refs[len(refs)-1]
+			}
+		}
+		if parent != "" && parent != messageID {
+			replies[parent] = append(replies[parent], messageID)
+		}
+	}
+	if !found {
+		return nil, sql.ErrNoRows
+	}
+
+	tree := map[string][]string{}
+	queue := []string{rootMessageID}
+	for len(queue) > 0 {
+		messageID := queue[0]
+		queue = queue[1:]
+		if _, ok := tree[messageID]; ok {
+			continue // the same article referenced twice
+		}
+		tree[messageID] = append([]string{}, replies[messageID]...)
+		queue = append(queue, replies[messageID]...)
+	}
+	return tree, nil
+}
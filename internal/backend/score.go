@@ -0,0 +1,25 @@
+package backend
+
+import (
+	"github.com/ChronosX88/yans/internal/models"
+	"sort"
+)
+
+// ScoreFunc rates the articles, listings sorted by score put the higher rated articles first
+type ScoreFunc interface {
+	Score(a *models.Article) float64
+}
+
+// ReplyCountScore rates the articles by the number of replies in their threads, ReplyCount must be filled
+type ReplyCountScore struct{}
+
+func (ReplyCountScore) Score(a *models.Article) float64 {
+	return float64(a.ReplyCount)
+}
+
+// SortByScore orders the articles by descending score, equally rated ones keep their order
+func SortByScore(articles []models.Article, f ScoreFunc) {
+	sort.SliceStable(articles, func(i, j int) bool {
+		return f.Score(&articles[i]) > f.Score(&articles[j])
+	})
+}
@@ -0,0 +1,7 @@
+-- +goose Up
+
+ALTER TABLE groups ADD COLUMN moderated BOOLEAN NOT NULL DEFAULT 0;
+
+-- +goose Down
+
+ALTER TABLE groups DROP COLUMN moderated;
@@ -0,0 +1,14 @@
+-- +goose Up
+
+CREATE TABLE IF NOT EXISTS users(
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    username TEXT UNIQUE NOT NULL,
+    password_hash TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+ALTER TABLE groups ADD COLUMN requires_auth BOOLEAN NOT NULL DEFAULT 0;
+
+-- +goose Down
+
+DROP TABLE IF EXISTS users;
+ALTER TABLE groups DROP COLUMN requires_auth;
@@ -0,0 +1,30 @@
+-- +goose Up
+
+CREATE VIRTUAL TABLE IF NOT EXISTS articles_fts USING fts5(subject, body);
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_fts_insert AFTER INSERT ON articles BEGIN
+    INSERT INTO articles_fts (rowid, subject, body) VALUES (new.id, json_extract(new.header, '$.Subject[0]'), new.body);
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_fts_update AFTER UPDATE ON articles BEGIN
+    UPDATE articles_fts SET subject = json_extract(new.header, '$.Subject[0]'), body = new.body WHERE rowid = old.id;
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_fts_delete AFTER DELETE ON articles BEGIN
+    DELETE FROM articles_fts WHERE rowid = old.id;
+END;
+-- +goose StatementEnd
+
+INSERT INTO articles_fts (rowid, subject, body) SELECT id, json_extract(header, '$.Subject[0]'), body FROM articles;
+
+-- +goose Down
+
+DROP TRIGGER IF EXISTS articles_fts_insert;
+DROP TRIGGER IF EXISTS articles_fts_update;
+DROP TRIGGER IF EXISTS articles_fts_delete;
+DROP TABLE IF EXISTS articles_fts;
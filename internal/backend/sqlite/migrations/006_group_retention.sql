@@ -0,0 +1,7 @@
+-- +goose Up
+
+ALTER TABLE groups ADD COLUMN retention_days INTEGER;
+
+-- +goose Down
+
+ALTER TABLE groups DROP COLUMN retention_days;
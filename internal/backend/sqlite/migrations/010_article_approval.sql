@@ -0,0 +1,9 @@
+-- +goose Up
+
+ALTER TABLE articles ADD COLUMN approved BOOLEAN NOT NULL DEFAULT 1;
+ALTER TABLE articles ADD COLUMN approved_by TEXT;
+
+-- +goose Down
+
+ALTER TABLE articles DROP COLUMN approved_by;
+ALTER TABLE articles DROP COLUMN approved;
@@ -0,0 +1,12 @@
+-- +goose Up
+
+-- filled with utils.NormalizeEmail on saving, existing articles get its approximation
+ALTER TABLE articles ADD COLUMN from_email TEXT NOT NULL DEFAULT '';
+UPDATE articles SET from_email = lower(trim(COALESCE(json_extract(header, '$.From[0]'), '')));
+UPDATE articles SET from_email = trim(substr(from_email, instr(from_email, '<') + 1, instr(from_email, '>') - instr(from_email, '<') - 1)) WHERE instr(from_email, '<') > 0 AND instr(from_email, '>') > instr(from_email, '<');
+CREATE INDEX IF NOT EXISTS idx_articles_from_email ON articles(from_email);
+
+-- +goose Down
+
+DROP INDEX IF EXISTS idx_articles_from_email;
+ALTER TABLE articles DROP COLUMN from_email;
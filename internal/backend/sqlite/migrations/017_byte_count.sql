@@ -0,0 +1,37 @@
+-- +goose Up
+
+-- header and body size in bytes reported by OVER, kept by the triggers below
+ALTER TABLE articles ADD COLUMN byte_count INTEGER NOT NULL DEFAULT 0;
+UPDATE articles SET byte_count = length(CAST(header AS BLOB)) + length(CAST(body AS BLOB));
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_byte_count_insert AFTER INSERT ON articles BEGIN
+    UPDATE articles SET byte_count = length(CAST(new.header AS BLOB)) + length(CAST(new.body AS BLOB)) WHERE id = new.id;
+END;
+-- +goose StatementEnd
+
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_byte_count_update AFTER UPDATE OF header, body ON articles BEGIN
+    UPDATE articles SET byte_count = length(CAST(new.header AS BLOB)) + length(CAST(new.body AS BLOB)) WHERE id = new.id;
+END;
+-- +goose StatementEnd
+
+-- the search index doesn't need refreshing when only byte_count or approval changes
+DROP TRIGGER IF EXISTS articles_fts_update;
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_fts_update AFTER UPDATE OF header, body ON articles BEGIN
+    UPDATE articles_fts SET subject = json_extract(new.header, '$.Subject[0]'), body = new.body WHERE rowid = old.id;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+
+DROP TRIGGER IF EXISTS articles_fts_update;
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_fts_update AFTER UPDATE ON articles BEGIN
+    UPDATE articles_fts SET subject = json_extract(new.header, '$.Subject[0]'), body = new.body WHERE rowid = old.id;
+END;
+-- +goose StatementEnd
+DROP TRIGGER IF EXISTS articles_byte_count_insert;
+DROP TRIGGER IF EXISTS articles_byte_count_update;
+ALTER TABLE articles DROP COLUMN byte_count;
@@ -0,0 +1,37 @@
+-- +goose Up
+
+-- number of the body lines reported by OVER, kept along with byte_count so it isn't counted on every query
+ALTER TABLE articles ADD COLUMN line_count INTEGER NOT NULL DEFAULT 0;
+UPDATE articles SET line_count = length(body) - length(replace(body, char(10), ''));
+
+DROP TRIGGER IF EXISTS articles_byte_count_insert;
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_byte_count_insert AFTER INSERT ON articles BEGIN
+    UPDATE articles SET byte_count = length(CAST(new.header AS BLOB)) + length(CAST(new.body AS BLOB)), line_count = length(new.body) - length(replace(new.body, char(10), '')) WHERE id = new.id;
+END;
+-- +goose StatementEnd
+
+DROP TRIGGER IF EXISTS articles_byte_count_update;
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_byte_count_update AFTER UPDATE OF header, body ON articles BEGIN
+    UPDATE articles SET byte_count = length(CAST(new.header AS BLOB)) + length(CAST(new.body AS BLOB)), line_count = length(new.body) - length(replace(new.body, char(10), '')) WHERE id = new.id;
+END;
+-- +goose StatementEnd
+
+-- +goose Down
+
+DROP TRIGGER IF EXISTS articles_byte_count_insert;
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_byte_count_insert AFTER INSERT ON articles BEGIN
+    UPDATE articles SET byte_count = length(CAST(new.header AS BLOB)) + length(CAST(new.body AS BLOB)) WHERE id = new.id;
+END;
+-- +goose StatementEnd
+
+DROP TRIGGER IF EXISTS articles_byte_count_update;
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_byte_count_update AFTER UPDATE OF header, body ON articles BEGIN
+    UPDATE articles SET byte_count = length(CAST(new.header AS BLOB)) + length(CAST(new.body AS BLOB)) WHERE id = new.id;
+END;
+-- +goose StatementEnd
+
+ALTER TABLE articles DROP COLUMN line_count;
@@ -0,0 +1,37 @@
+-- +goose Up
+
+-- byte_count is the size of the article as sent by ARTICLE, the same as models.Article.WireSize computes:
+-- "Name: value" CRLF for every header value, the empty line and the body lines terminated with CRLF
+DROP TRIGGER IF EXISTS articles_byte_count_insert;
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_byte_count_insert AFTER INSERT ON articles BEGIN
+    UPDATE articles SET byte_count = 2 + (SELECT COALESCE(SUM(length(CAST(h.key AS BLOB)) + length(CAST(v.value AS BLOB)) + 4), 0) FROM json_each(new.header) h, json_each(h.value) v) + (SELECT length(CAST(b AS BLOB)) + length(b) - length(replace(b, char(10), '')) + CASE WHEN b = '' OR substr(b, -1) = char(10) THEN 0 ELSE 2 END FROM (SELECT replace(new.body, char(13) || char(10), char(10)) AS b)), line_count = length(new.body) - length(replace(new.body, char(10), '')) WHERE id = new.id;
+END;
+-- +goose StatementEnd
+
+DROP TRIGGER IF EXISTS articles_byte_count_update;
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_byte_count_update AFTER UPDATE OF header, body ON articles BEGIN
+    UPDATE articles SET byte_count = 2 + (SELECT COALESCE(SUM(length(CAST(h.key AS BLOB)) + length(CAST(v.value AS BLOB)) + 4), 0) FROM json_each(new.header) h, json_each(h.value) v) + (SELECT length(CAST(b AS BLOB)) + length(b) - length(replace(b, char(10), '')) + CASE WHEN b = '' OR substr(b, -1) = char(10) THEN 0 ELSE 2 END FROM (SELECT replace(new.body, char(13) || char(10), char(10)) AS b)), line_count = length(new.body) - length(replace(new.body, char(10), '')) WHERE id = new.id;
+END;
+-- +goose StatementEnd
+
+UPDATE articles SET byte_count = 2 + (SELECT COALESCE(SUM(length(CAST(h.key AS BLOB)) + length(CAST(v.value AS BLOB)) + 4), 0) FROM json_each(articles.header) h, json_each(h.value) v) + (SELECT length(CAST(b AS BLOB)) + length(b) - length(replace(b, char(10), '')) + CASE WHEN b = '' OR substr(b, -1) = char(10) THEN 0 ELSE 2 END FROM (SELECT replace(articles.body, char(13) || char(10), char(10)) AS b));
+
+-- +goose Down
+
+DROP TRIGGER IF EXISTS articles_byte_count_insert;
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_byte_count_insert AFTER INSERT ON articles BEGIN
+    UPDATE articles SET byte_count = length(CAST(new.header AS BLOB)) + length(CAST(new.body AS BLOB)), line_count = length(new.body) - length(replace(new.body, char(10), '')) WHERE id = new.id;
+END;
+-- +goose StatementEnd
+
+DROP TRIGGER IF EXISTS articles_byte_count_update;
+-- +goose StatementBegin
+CREATE TRIGGER IF NOT EXISTS articles_byte_count_update AFTER UPDATE OF header, body ON articles BEGIN
+    UPDATE articles SET byte_count = length(CAST(new.header AS BLOB)) + length(CAST(new.body AS BLOB)), line_count = length(new.body) - length(replace(new.body, char(10), '')) WHERE id = new.id;
+END;
+-- +goose StatementEnd
+
+UPDATE articles SET byte_count = length(CAST(articles.header AS BLOB)) + length(CAST(articles.body AS BLOB));
@@ -1,39 +1,88 @@
 package sqlite
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"encoding/json"
 	"fmt"
+	"github.com/ChronosX88/yans/internal/backend"
 	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/metrics"
 	"github.com/ChronosX88/yans/internal/models"
 	"github.com/ChronosX88/yans/internal/utils"
-	"github.com/dlclark/regexp2"
 	"github.com/jmoiron/sqlx"
 	"github.com/mattn/go-sqlite3"
 	_ "github.com/mattn/go-sqlite3"
 	"github.com/pressly/goose/v3"
+	"golang.org/x/crypto/bcrypt"
+	"net/textproto"
+	"slices"
+	"sort"
 	"strings"
+	"sync"
+	"time"
 )
 
 //go:embed migrations/*.sql
 var migrations embed.FS
 
+// rows per single INSERT statement, keeps bind variables count below the driver limit
+const bulkInsertBatchSize = 500
+
+// approvedCond hides unapproved articles of moderated groups, the query must join the group's articles_to_groups row as atg
+const approvedCond = "(articles.approved OR NOT (SELECT groups.moderated FROM groups WHERE groups.id = atg.group_id))"
+
+// approvedAnyCond hides unapproved articles which aren't posted to any unmoderated group
+const approvedAnyCond = "(articles.approved OR articles.id IN (SELECT a.article_id FROM articles_to_groups a INNER JOIN groups ON groups.id = a.group_id WHERE NOT groups.moderated))"
+
+// groupSortColumns whitelists the fields groups can be sorted by, mapped to their SQL expressions
+var groupSortColumns = map[string]string{
+	"group_name":    "groups.group_name",
+	"created_at":    "groups.created_at",
+	"article_count": "(SELECT COUNT(*) FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = groups.id AND " + approvedCond + ")",
+}
+
 type SQLiteBackend struct {
-	db *sqlx.DB
+	db *metrics.DB
+	// the database itself, or the transaction for SQLiteBackendTx
+	conn metrics.Conn
+
+	lastPosts *backend.LastPostCache
+}
+
+// SQLiteBackendTx runs the backend methods inside a single transaction
+type SQLiteBackendTx struct {
+	*SQLiteBackend
+	tx *metrics.Tx
 }
 
+// overviewRow is used to scan the extra overview headers, which are selected as a JSON array
+type overviewRow struct {
+	models.Overview
+	ExtraHeaders *string `db:"extra_headers"`
+}
+
+var registerDriver sync.Once
+
 func regexHelper(re, s string) (bool, error) {
-	return regexp2.MustCompile(re, regexp2.None).MatchString(s)
+	r, err := utils.CompileRegex(re)
+	if err != nil {
+		return false, err
+	}
+	return r.MatchString(s)
 }
 
 func NewSQLiteBackend(cfg config.SQLiteBackendConfig) (*SQLiteBackend, error) {
-	sql.Register("sqlite3_with_regexp",
-		&sqlite3.SQLiteDriver{
-			ConnectHook: func(conn *sqlite3.SQLiteConn) error {
-				return conn.RegisterFunc("regexp", regexHelper, true)
-			},
-		})
+	// drivers can be registered only once per process
+	registerDriver.Do(func() {
+		sql.Register("sqlite3_with_regexp",
+			&sqlite3.SQLiteDriver{
+				ConnectHook: func(conn *sqlite3.SQLiteConn) error {
+					return conn.RegisterFunc("regexp", regexHelper, true)
+				},
+			})
+	})
 
 	db, err := sqlx.Open("sqlite3_with_regexp", cfg.Path)
 	if err != nil {
@@ -49,65 +98,400 @@ func NewSQLiteBackend(cfg config.SQLiteBackendConfig) (*SQLiteBackend, error) {
 		return nil, err
 	}
 
+	wrapped := metrics.WrapDB(db)
 	return &SQLiteBackend{
-		db: db,
+		db:        wrapped,
+		conn:      wrapped,
+		lastPosts: backend.NewLastPostCache(),
+	}, nil
+}
+
+// Close cancels the running queries and closes the database
+func (sb *SQLiteBackend) Close() error {
+	return sb.db.Close()
+}
+
+// BeginTx starts the transaction, which is also rolled back once ctx is done.
+// Transactions started from a transaction are savepoints of the outer one.
+func (sb *SQLiteBackend) BeginTx(ctx context.Context) (backend.BackendTx, error) {
+	tx, err := sb.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	return &SQLiteBackendTx{
+		SQLiteBackend: &SQLiteBackend{db: sb.db, conn: tx, lastPosts: sb.lastPosts},
+		tx:            tx,
 	}, nil
 }
 
-func (sb *SQLiteBackend) ListGroups() ([]models.Group, error) {
+func (btx *SQLiteBackendTx) Commit() error {
+	return btx.tx.Commit()
+}
+
+func (btx *SQLiteBackendTx) Rollback() error {
+	return btx.tx.Rollback()
+}
+
+// Close rolls back the transaction unless it's finished already, the database is left open
+func (btx *SQLiteBackendTx) Close() error {
+	if err := btx.tx.Rollback(); err != nil && err != sql.ErrTxDone {
+		return err
+	}
+	return nil
+}
+
+// ListGroups returns the groups in alphabetical order
+func (sb *SQLiteBackend) ListGroups(ctx context.Context) ([]models.Group, error) {
+	return sb.GetGroupsSortedBy(ctx, "group_name", true)
+}
+
+// GetGroupsSortedBy returns the groups sorted by one of the whitelisted fields, ErrInvalidSortField is returned for other ones
+func (sb *SQLiteBackend) GetGroupsSortedBy(ctx context.Context, field string, asc bool) ([]models.Group, error) {
+	column, ok := groupSortColumns[field]
+	if !ok {
+		return nil, backend.ErrInvalidSortField
+	}
+	order := "ASC"
+	if !asc {
+		order = "DESC"
+	}
+
 	var groups []models.Group
-	return groups, sb.db.Select(&groups, "SELECT * FROM groups")
+	return groups, sb.conn.SelectContext(ctx, &groups, "SELECT * FROM groups ORDER BY "+column+" "+order+", groups.group_name")
 }
 
-func (sb *SQLiteBackend) ListGroupsByPattern(pattern string) ([]models.Group, error) {
+// GetGroupsByModeratedStatus returns either moderated or unmoderated groups in alphabetical order
+func (sb *SQLiteBackend) GetGroupsByModeratedStatus(ctx context.Context, moderated bool) ([]models.Group, error) {
 	var groups []models.Group
-	w, err := utils.ParseWildmat(pattern)
-	if err != nil {
+	return groups, sb.conn.SelectContext(ctx, &groups, "SELECT * FROM groups WHERE moderated = ? ORDER BY group_name", moderated)
+}
+
+// GetGroupCountsByHierarchy counts the groups by the first component of their names, e.g. comp for comp.lang.go
+func (sb *SQLiteBackend) GetGroupCountsByHierarchy(ctx context.Context) (map[string]int, error) {
+	var rows []struct {
+		Hierarchy string `db:"hierarchy"`
+		Count     int    `db:"count"`
+	}
+	if err := sb.conn.SelectContext(ctx, &rows, "SELECT CASE WHEN instr(group_name, '.') > 0 THEN substr(group_name, 1, instr(group_name, '.') - 1) ELSE group_name END AS hierarchy, COUNT(*) AS count FROM groups GROUP BY hierarchy"); err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int, len(rows))
+	for _, v := range rows {
+		counts[v.Hierarchy] = v.Count
+	}
+	return counts, nil
+}
+
+// GetGroupMeta returns all the metadata of the group, sql.ErrNoRows is returned if there is no such group
+func (sb *SQLiteBackend) GetGroupMeta(ctx context.Context, groupName string) (map[string]string, error) {
+	var groupID int
+	if err := sb.conn.GetContext(ctx, &groupID, "SELECT id FROM groups WHERE group_name = ?", groupName); err != nil {
+		return nil, err
+	}
+
+	var rows []struct {
+		Key   string `db:"key"`
+		Value string `db:"value"`
+	}
+	if err := sb.conn.SelectContext(ctx, &rows, "SELECT key, value FROM group_meta WHERE group_id = ?", groupID); err != nil {
 		return nil, err
 	}
-	r, err := w.ToRegex()
+
+	meta := make(map[string]string, len(rows))
+	for _, v := range rows {
+		meta[v.Key] = v.Value
+	}
+	return meta, nil
+}
+
+// SetGroupMeta sets the metadata value of the group, replacing the existing one
+func (sb *SQLiteBackend) SetGroupMeta(ctx context.Context, groupName, key, value string) error {
+	res, err := sb.conn.ExecContext(ctx, "INSERT INTO group_meta (group_id, key, value) SELECT id, ?, ? FROM groups WHERE group_name = ? ON CONFLICT (group_id, key) DO UPDATE SET value = excluded.value", key, value, groupName)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (sb *SQLiteBackend) ListGroupsByPattern(ctx context.Context, pattern string) ([]models.Group, error) {
+	var groups []models.Group
+	cond, args, err := utils.WildmatToSQL(pattern)
 	if err != nil {
 		return nil, err
 	}
-	return groups, sb.db.Select(&groups, "SELECT * FROM groups WHERE group_name REGEXP ?", r.String())
+	return groups, sb.conn.SelectContext(ctx, &groups, "SELECT * FROM groups WHERE "+cond, args...)
+}
+
+func (sb *SQLiteBackend) ListGroupsWithStats(ctx context.Context) ([]models.GroupStats, error) {
+	var groups []models.GroupStats
+	return groups, sb.conn.SelectContext(ctx, &groups, "SELECT groups.*, COALESCE(min(atg.article_number), 0) AS low_water_mark, COALESCE(max(atg.article_number), 0) AS high_water_mark, COUNT(atg.article_id) AS article_count FROM groups LEFT JOIN articles_to_groups atg ON atg.group_id = groups.id AND (NOT groups.moderated OR atg.article_id IN (SELECT id FROM articles WHERE approved)) GROUP BY groups.id")
 }
 
-func (sb *SQLiteBackend) GetArticlesCount(g *models.Group) (int, error) {
+func (sb *SQLiteBackend) GetArticlesCount(ctx context.Context, g *models.Group) (int, error) {
 	var count int
-	return count, sb.db.Get(&count, "SELECT COUNT(*) FROM articles_to_groups WHERE group_id = ?", g.ID)
+	return count, sb.conn.GetContext(ctx, &count, "SELECT COUNT(*) FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = ? AND "+approvedCond, g.ID)
 }
 
-func (sb *SQLiteBackend) GetGroupHighWaterMark(g *models.Group) (int, error) {
-	var waterMark int
-	return waterMark, sb.db.Get(&waterMark, "SELECT COALESCE(max(article_number), 0) FROM articles_to_groups WHERE group_id = ?", g.ID)
+func (sb *SQLiteBackend) GetArticlesCountInRange(ctx context.Context, g *models.Group, low, high int64) (int, error) {
+	var count int
+	return count, sb.conn.GetContext(ctx, &count, "SELECT COUNT(*) FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = ? AND atg.article_number >= ? AND atg.article_number <= ? AND "+approvedCond, g.ID, low, high)
+}
+
+func (sb *SQLiteBackend) GetArticlesCountByDateRange(ctx context.Context, g *models.Group, from, to time.Time) (int, error) {
+	var count int
+	return count, sb.conn.GetContext(ctx, &count, "SELECT COUNT(*) FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = ? AND "+approvedCond+" AND articles.created_at >= datetime(?, 'unixepoch') AND articles.created_at < datetime(?, 'unixepoch')", g.ID, from.Unix(), to.Unix())
+}
+
+func (sb *SQLiteBackend) GetArticlesPerDay(ctx context.Context, g *models.Group, from, to time.Time) ([]models.DailyCount, error) {
+	var rows []struct {
+		Day   string `db:"day"`
+		Count int    `db:"article_count"`
+	}
+	if err := sb.conn.SelectContext(ctx, &rows, "SELECT strftime('%Y-%m-%d', articles.created_at) AS day, COUNT(*) AS article_count FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = ? AND "+approvedCond+" AND articles.created_at >= datetime(?, 'unixepoch') AND articles.created_at < datetime(?, 'unixepoch') GROUP BY day ORDER BY day", g.ID, from.Unix(), to.Unix()); err != nil {
+		return nil, err
+	}
+
+	var counts []models.DailyCount
+	for _, v := range rows {
+		date, err := time.Parse(time.DateOnly, v.Day)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, models.DailyCount{Date: date, Count: v.Count})
+	}
+	return counts, nil
+}
+
+func (sb *SQLiteBackend) GetGroupHighWaterMark(ctx context.Context, g *models.Group) (int, error) {
+	num, err := sb.GetHighestArticleNumber(ctx, g)
+	return int(num), err
 }
 
-func (sb *SQLiteBackend) GetGroupLowWaterMark(g *models.Group) (int, error) {
-	var waterMark int
-	return waterMark, sb.db.Get(&waterMark, "SELECT COALESCE(min(article_number), 0) FROM articles_to_groups WHERE group_id = ?", g.ID)
+func (sb *SQLiteBackend) GetGroupLowWaterMark(ctx context.Context, g *models.Group) (int, error) {
+	num, err := sb.GetLowestArticleNumber(ctx, g)
+	return int(num), err
 }
 
-func (sb *SQLiteBackend) GetGroup(groupName string) (models.Group, error) {
+// GetHighestArticleNumber returns 0 for empty groups, the lookup is covered by idx_atg_group_num
+func (sb *SQLiteBackend) GetHighestArticleNumber(ctx context.Context, g *models.Group) (int64, error) {
+	var num int64
+	return num, sb.conn.GetContext(ctx, &num, "SELECT COALESCE(max(article_number), 0) FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = ? AND "+approvedCond, g.ID)
+}
+
+// GetGroupLastPostTime returns the time of the latest article of the group, or the zero time if it's empty.
+// The times are cached for a minute.
+func (sb *SQLiteBackend) GetGroupLastPostTime(ctx context.Context, groupName string) (time.Time, error) {
+	if t, ok := sb.lastPosts.Get(groupName); ok {
+		return t, nil
+	}
+
+	var unix int64
+	if err := sb.conn.GetContext(ctx, &unix, "SELECT COALESCE((SELECT CAST(strftime('%s', MAX(articles.created_at)) AS INTEGER) FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = groups.id AND "+approvedCond+"), 0) FROM groups WHERE group_name = ?", groupName); err != nil {
+		return time.Time{}, err
+	}
+	var t time.Time
+	if unix != 0 {
+		t = time.Unix(unix, 0).UTC()
+	}
+	sb.lastPosts.Set(groupName, t)
+	return t, nil
+}
+
+// GetLowestArticleNumber returns 0 for empty groups, the lookup is covered by idx_atg_group_num
+func (sb *SQLiteBackend) GetLowestArticleNumber(ctx context.Context, g *models.Group) (int64, error) {
+	var num int64
+	return num, sb.conn.GetContext(ctx, &num, "SELECT COALESCE(min(article_number), 0) FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = ? AND "+approvedCond, g.ID)
+}
+
+func (sb *SQLiteBackend) GetGroup(ctx context.Context, groupName string) (models.Group, error) {
+	var group models.Group
+	return group, sb.conn.GetContext(ctx, &group, "SELECT * FROM groups WHERE group_name = ?", groupName)
+}
+
+func (sb *SQLiteBackend) GetGroupByID(ctx context.Context, id int) (models.Group, error) {
 	var group models.Group
-	return group, sb.db.Get(&group, "SELECT * FROM groups WHERE group_name = ?", groupName)
+	return group, sb.conn.GetContext(ctx, &group, "SELECT * FROM groups WHERE id = ?", id)
 }
 
-func (sb *SQLiteBackend) GetNewGroupsSince(timestamp int64) ([]models.Group, error) {
+func (sb *SQLiteBackend) GetNewGroupsSince(ctx context.Context, timestamp int64) ([]models.Group, error) {
 	var groups []models.Group
-	return groups, sb.db.Select(&groups, "SELECT * FROM groups WHERE created_at > datetime(?, 'unixepoch')", timestamp)
+	return groups, sb.conn.SelectContext(ctx, &groups, "SELECT * FROM groups WHERE created_at > datetime(?, 'unixepoch')", timestamp)
 }
 
-func (sb *SQLiteBackend) SaveArticle(a models.Article, groups []string) error {
-	res, err := sb.db.Exec("INSERT INTO articles (header, body, thread) VALUES (?, ?, ?)", a.HeaderRaw, a.Body, a.Thread)
-	articleID, err := res.LastInsertId()
+// GetNewGroupsWithStatsSince returns the groups created after timestamp along with their article numbering info
+func (sb *SQLiteBackend) GetNewGroupsWithStatsSince(ctx context.Context, timestamp int64) ([]models.GroupStats, error) {
+	var groups []models.GroupStats
+	return groups, sb.conn.SelectContext(ctx, &groups, "SELECT groups.*, COALESCE(min(atg.article_number), 0) AS low_water_mark, COALESCE(max(atg.article_number), 0) AS high_water_mark, COUNT(atg.article_id) AS article_count FROM groups LEFT JOIN articles_to_groups atg ON atg.group_id = groups.id AND (NOT groups.moderated OR atg.article_id IN (SELECT id FROM articles WHERE approved)) WHERE groups.created_at > datetime(?, 'unixepoch') GROUP BY groups.id", timestamp)
+}
+
+// CreateGroup adds the group, empty posting status is derived from moderated flag
+func (sb *SQLiteBackend) CreateGroup(ctx context.Context, name, description string, moderated bool, postingStatus string) error {
+	var desc *string
+	if description != "" {
+		desc = &description
+	}
+	_, err := sb.conn.ExecContext(ctx, "INSERT INTO groups (group_name, description, moderated, posting_status) VALUES (?, ?, ?, ?)", name, desc, moderated, backend.DefaultPostingStatus(moderated, postingStatus))
+	return err
+}
+
+func (sb *SQLiteBackend) GetGroupDescription(ctx context.Context, groupName string) (string, error) {
+	var desc string
+	return desc, sb.conn.GetContext(ctx, &desc, "SELECT COALESCE(description, '') FROM groups WHERE group_name = ?", groupName)
+}
+
+func (sb *SQLiteBackend) UpdateGroupDescription(ctx context.Context, name, description string) error {
+	var desc *string
+	if description != "" {
+		desc = &description
+	}
+	res, err := sb.conn.ExecContext(ctx, "UPDATE groups SET description = ? WHERE group_name = ?", desc, name)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// GetGroupModeratorEmail returns the address which posts to the moderated group are forwarded to, it's empty if there's none
+func (sb *SQLiteBackend) GetGroupModeratorEmail(ctx context.Context, groupName string) (string, error) {
+	var email string
+	return email, sb.conn.GetContext(ctx, &email, "SELECT COALESCE(moderator_email, '') FROM groups WHERE group_name = ?", groupName)
+}
+
+func (sb *SQLiteBackend) UpdateGroupModeratorEmail(ctx context.Context, name, email string) error {
+	var addr *string
+	if email != "" {
+		addr = &email
+	}
+	res, err := sb.conn.ExecContext(ctx, "UPDATE groups SET moderator_email = ? WHERE group_name = ?", addr, name)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateGroupPosting changes the posting status, the moderated flag is set only for the moderated status
+func (sb *SQLiteBackend) UpdateGroupPosting(ctx context.Context, name string, flag byte) error {
+	status := string(flag)
+	if !backend.IsValidPostingStatus(status) {
+		return backend.ErrInvalidStatus
+	}
+	res, err := sb.conn.ExecContext(ctx, "UPDATE groups SET posting_status = ?, moderated = ? WHERE group_name = ?", status, status == models.PostingModerated, name)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
 	if err != nil {
 		return err
 	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (sb *SQLiteBackend) RenameGroup(ctx context.Context, oldName, newName string) error {
+	res, err := sb.conn.ExecContext(ctx, "UPDATE groups SET group_name = ? WHERE group_name = ?", newName, oldName)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// ReindexGroup renumbers the group articles from 1 keeping their order, including the unapproved ones.
+//
+// WARNING: this is destructive. Clients keep article numbers in their newsrc files and
+// sessions keep the current article number, all of them point to other articles afterwards.
+// Only run it during maintenance windows.
+func (sb *SQLiteBackend) ReindexGroup(ctx context.Context, g *models.Group) error {
+	_, err := sb.conn.ExecContext(ctx, "UPDATE articles_to_groups SET article_number = renumbered.num FROM (SELECT article_id, ROW_NUMBER() OVER (ORDER BY article_number) AS num FROM articles_to_groups WHERE group_id = ?) renumbered WHERE articles_to_groups.group_id = ? AND articles_to_groups.article_id = renumbered.article_id", g.ID, g.ID)
+	return err
+}
+
+func (sb *SQLiteBackend) DeleteGroup(ctx context.Context, name string) error {
+	tx, err := sb.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var groupID int
+	if err := tx.GetContext(ctx, &groupID, "SELECT id FROM groups WHERE group_name = ?", name); err != nil {
+		return err
+	}
+
+	// articles which are cross-posted to other groups must be kept
+	exclusiveArticles := "SELECT article_id FROM articles_to_groups WHERE group_id = ? AND article_id NOT IN (SELECT article_id FROM articles_to_groups WHERE group_id != ?)"
+	if _, err := tx.ExecContext(ctx, "DELETE FROM attachments WHERE attachment_id IN (SELECT attachment_id FROM attachments_articles_mapping WHERE article_id IN ("+exclusiveArticles+"))", groupID, groupID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM attachments_articles_mapping WHERE article_id IN ("+exclusiveArticles+")", groupID, groupID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM articles WHERE id IN ("+exclusiveArticles+")", groupID, groupID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM articles_to_groups WHERE group_id = ?", groupID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM permissions WHERE group_id = ?", groupID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM group_meta WHERE group_id = ?", groupID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM groups WHERE id = ?", groupID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (sb *SQLiteBackend) SaveArticle(ctx context.Context, a models.Article, groups []string) error {
+	if err := backend.CanonicalizeArticleHeader(&a); err != nil {
+		return err
+	}
+
+	tx, err := sb.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
 
 	var groupIDs []int
+	approved := true
 	for _, v := range groups {
 		v = strings.TrimSpace(v)
-		g, err := sb.GetGroup(v)
+		var g models.Group
+		err := tx.GetContext(ctx, &g, "SELECT * FROM groups WHERE group_name = ?", v)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return fmt.Errorf("no such newsgroup")
@@ -116,10 +500,28 @@ func (sb *SQLiteBackend) SaveArticle(a models.Article, groups []string) error {
 			}
 		}
 		groupIDs = append(groupIDs, g.ID)
+		if g.Moderated {
+			// articles of moderated groups are hidden until they are approved
+			approved = false
+		}
+	}
+
+	res, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO articles (header, body, thread, approved, from_email, user_id) VALUES (?, ?, ?, ?, ?, ?)", a.HeaderRaw, a.Body, a.Thread, approved, utils.NormalizeEmail(a.Header.Get("From")), a.UserID)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return backend.ErrArticleExists
+	}
+	articleID, err := res.LastInsertId()
+	if err != nil {
+		return err
 	}
 
 	for _, v := range groupIDs {
-		_, err = sb.db.Exec("INSERT INTO articles_to_groups (article_id, article_number, group_id) VALUES (?, (SELECT ifnull(max(article_number)+1, 1) FROM articles_to_groups WHERE group_id = ?), ?)", articleID, v, v)
+		_, err = tx.ExecContext(ctx, "INSERT INTO articles_to_groups (article_id, article_number, group_id) VALUES (?, (SELECT ifnull(max(article_number)+1, 1) FROM articles_to_groups WHERE group_id = ?), ?)", articleID, v, v)
 		if err != nil {
 			return err
 		}
@@ -127,99 +529,748 @@ func (sb *SQLiteBackend) SaveArticle(a models.Article, groups []string) error {
 
 	// save attachments into db
 	for _, v := range a.Attachments {
-		_, err = sb.db.Exec("INSERT INTO attachments_articles_mapping (article_id, content_type, attachment_id) VALUES (?, ?, ?)", articleID, v.ContentType, v.FileName)
+		_, err = tx.ExecContext(ctx, "INSERT INTO attachments_articles_mapping (article_id, content_type, attachment_id) VALUES (?, ?, ?)", articleID, v.ContentType, v.FileName)
 		if err != nil {
 			return err
 		}
+		if err := saveAttachmentContent(ctx, tx, v); err != nil {
+			return err
+		}
 	}
 
-	return err
+	return tx.Commit()
 }
 
-func (sb *SQLiteBackend) GetArticle(messageID string) (models.Article, error) {
-	var a models.Article
-	if err := sb.db.Get(&a, "SELECT * FROM articles WHERE json_extract(articles.header, '$.Message-Id[0]') = ?", messageID); err != nil {
-		return a, err
-	}
-	if err := sb.db.Get(&a.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", a.ID); err != nil {
-		return a, err
-	}
-	if err := sb.db.Select(&a.Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", a.ID); err != nil {
-		return a, err
+func (sb *SQLiteBackend) BulkSaveArticles(ctx context.Context, articles []models.Article, groups []string) error {
+	tx, err := sb.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
 	}
-	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
-}
+	defer tx.Rollback()
 
-func (sb *SQLiteBackend) GetArticleByNumber(g *models.Group, num int) (models.Article, error) {
-	var a models.Article
-	if err := sb.db.Get(&a, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number = ? AND atg.group_id = ?", num, g.ID); err != nil {
-		return a, err
-	}
-	a.ArticleNumber = num
-	if err := sb.db.Select(&a.Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", a.ID); err != nil {
-		return a, err
+	var groupIDs []int
+	approved := true
+	for _, v := range groups {
+		v = strings.TrimSpace(v)
+		var g models.Group
+		err := tx.GetContext(ctx, &g, "SELECT * FROM groups WHERE group_name = ?", v)
+		if err != nil {
+			if err == sql.ErrNoRows {
+				return fmt.Errorf("no such newsgroup")
+			} else {
+				return err
+			}
+		}
+		groupIDs = append(groupIDs, g.ID)
+		if g.Moderated {
+			approved = false
+		}
 	}
-	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
-}
 
-func (sb *SQLiteBackend) GetArticleNumbers(g *models.Group, low, high int64) ([]int64, error) {
-	var numbers []int64
+	for start := 0; start < len(articles); start += bulkInsertBatchSize {
+		end := start + bulkInsertBatchSize
+		if end > len(articles) {
+			end = len(articles)
+		}
+		batch := articles[start:end]
 
-	if high == 0 && low == 0 {
-		if err := sb.db.Select(&numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = ?", g.ID); err != nil {
-			return nil, err
+		var values []string
+		var args []interface{}
+		for _, a := range batch {
+			if err := backend.CanonicalizeArticleHeader(&a); err != nil {
+				return err
+			}
+			values = append(values, "(?, ?, ?, ?, ?)")
+			args = append(args, a.HeaderRaw, a.Body, a.Thread, approved, utils.NormalizeEmail(a.Header.Get("From")))
 		}
-	} else if low == -1 && high != 0 {
-		if err := sb.db.Select(&numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = ? AND article_number = ?", g.ID, high); err != nil {
-			return nil, err
+		var articleIDs []int
+		if err := tx.SelectContext(ctx, &articleIDs, "INSERT INTO articles (header, body, thread, approved, from_email) VALUES "+strings.Join(values, ", ")+" RETURNING id", args...); err != nil {
+			return err
 		}
-	} else if low != 0 && high == -1 {
-		if err := sb.db.Select(&numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = ? AND article_number > ?", g.ID, low); err != nil {
-			return nil, err
+		// ids are assigned in the order of rows, but RETURNING doesn't guarantee any order
+		sort.Ints(articleIDs)
+
+		for _, groupID := range groupIDs {
+			var lastNumber int
+			if err := tx.GetContext(ctx, &lastNumber, "SELECT COALESCE(max(article_number), 0) FROM articles_to_groups WHERE group_id = ?", groupID); err != nil {
+				return err
+			}
+
+			values, args = nil, nil
+			for i, articleID := range articleIDs {
+				values = append(values, "(?, ?, ?)")
+				args = append(args, articleID, lastNumber+i+1, groupID)
+			}
+			if _, err := tx.ExecContext(ctx, "INSERT INTO articles_to_groups (article_id, article_number, group_id) VALUES "+strings.Join(values, ", "), args...); err != nil {
+				return err
+			}
 		}
-	} else if low == -1 && high == -1 {
-		return nil, nil
-	} else {
-		if err := sb.db.Select(&numbers, "SELECT article_number FROM articles_to_groups WHERE group_id = ? AND article_number > ? AND article_number < ?", g.ID, low, high); err != nil {
-			return nil, err
+
+		values, args = nil, nil
+		for i, a := range batch {
+			for _, v := range a.Attachments {
+				values = append(values, "(?, ?, ?)")
+				args = append(args, articleIDs[i], v.ContentType, v.FileName)
+				if err := saveAttachmentContent(ctx, tx, v); err != nil {
+					return err
+				}
+			}
+		}
+		if len(values) > 0 {
+			if _, err := tx.ExecContext(ctx, "INSERT INTO attachments_articles_mapping (article_id, content_type, attachment_id) VALUES "+strings.Join(values, ", "), args...); err != nil {
+				return err
+			}
 		}
 	}
 
-	return numbers, nil
+	return tx.Commit()
 }
 
-func (sb *SQLiteBackend) GetLastArticleByNum(g *models.Group, a *models.Article) (models.Article, error) {
-	var lastArticle models.Article
-	if err := sb.db.Get(&lastArticle, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number < ? AND atg.group_id = ? ORDER BY atg.article_number DESC LIMIT 1", a.ArticleNumber, g.ID); err != nil {
-		return lastArticle, err
-	}
-	if err := sb.db.Get(&lastArticle.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", lastArticle.ID); err != nil {
-		return lastArticle, err
+// saveAttachmentContent stores the attachment data, attachments without the content are only kept as files
+func saveAttachmentContent(ctx context.Context, tx *metrics.Tx, a models.Attachment) error {
+	if len(a.Content) == 0 {
+		return nil
 	}
-	return lastArticle, json.Unmarshal([]byte(lastArticle.HeaderRaw), &lastArticle.Header)
+	_, err := tx.ExecContext(ctx, "INSERT INTO attachments (attachment_id, content) VALUES (?, ?)", a.FileName, a.Content)
+	return err
 }
 
-func (sb *SQLiteBackend) GetNextArticleByNum(g *models.Group, a *models.Article) (models.Article, error) {
-	var nextArticle models.Article
-	if err := sb.db.Get(&nextArticle, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number > ? AND atg.group_id = ? ORDER BY atg.article_number LIMIT 1", a.ArticleNumber, g.ID); err != nil {
-		return nextArticle, err
+// GetAttachmentContent returns the attachment data along with its content type, sql.ErrNoRows is returned
+// if the article has no such attachment or its content isn't stored in the database
+func (sb *SQLiteBackend) GetAttachmentContent(ctx context.Context, articleID int64, attachmentID string) ([]byte, string, error) {
+	var res struct {
+		Content     []byte `db:"content"`
+		ContentType string `db:"content_type"`
 	}
-	if err := sb.db.Get(&nextArticle.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", nextArticle.ID); err != nil {
-		return nextArticle, err
+	if err := sb.conn.GetContext(ctx, &res, "SELECT attachments.content, m.content_type FROM attachments_articles_mapping m INNER JOIN attachments ON attachments.attachment_id = m.attachment_id WHERE m.article_id = ? AND m.attachment_id = ?", articleID, attachmentID); err != nil {
+		return nil, "", err
 	}
-	return nextArticle, json.Unmarshal([]byte(nextArticle.HeaderRaw), &nextArticle.Header)
+	return res.Content, res.ContentType, nil
 }
 
-func (sb *SQLiteBackend) GetArticlesByRange(g *models.Group, low, high int64) ([]models.Article, error) {
-	var articles []models.Article
-
-	if err := sb.db.Select(&articles, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number >= ? AND atg.article_number <= ? AND atg.group_id = ? ORDER BY atg.article_number", low, high, g.ID); err != nil {
+// ModerateArticle sets whether the article is shown in moderated groups, sql.ErrNoRows is returned if there's no such article
+func (sb *SQLiteBackend) ModerateArticle(ctx context.Context, messageID string, approved bool, approvedBy string) error {
+	res, err := sb.conn.ExecContext(ctx, "UPDATE articles SET approved = ?, approved_by = ? WHERE json_extract(articles.header, '$.Message-Id[0]') = ?", approved, approvedBy, messageID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// UpdateArticleHeader merges the fields into the stored article header, replacing the values of the fields it already has
+func (sb *SQLiteBackend) UpdateArticleHeader(ctx context.Context, messageID string, header map[string][]string) error {
+	fields := map[string][]string{}
+	for k, v := range header {
+		if !backend.IsValidHeaderName(k) {
+			return backend.ErrInvalidHeader
+		}
+		// headers are stored by their canonical names
+		fields[textproto.CanonicalMIMEHeaderKey(k)] = v
+	}
+	patch, err := json.Marshal(fields)
+	if err != nil {
+		return err
+	}
+
+	res, err := sb.conn.ExecContext(ctx, "UPDATE articles SET header = json_patch(header, ?) WHERE json_extract(articles.header, '$.Message-Id[0]') = ?", string(patch), messageID)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (sb *SQLiteBackend) DeleteArticle(ctx context.Context, messageID string) error {
+	tx, err := sb.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var articleID int
+	if err := tx.GetContext(ctx, &articleID, "SELECT id FROM articles WHERE json_extract(articles.header, '$.Message-Id[0]') = ?", messageID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM attachments WHERE attachment_id IN (SELECT attachment_id FROM attachments_articles_mapping WHERE article_id = ?)", articleID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM attachments_articles_mapping WHERE article_id = ?", articleID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM articles_to_groups WHERE article_id = ?", articleID); err != nil {
+		return err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM articles WHERE id = ?", articleID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// DuplicateArticleToGroup adds the existing article to one more group under the next article number,
+// the article itself including its Newsgroups header is left as is
+func (sb *SQLiteBackend) DuplicateArticleToGroup(ctx context.Context, messageID, targetGroup string) error {
+	tx, err := sb.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var groupID int
+	if err := tx.GetContext(ctx, &groupID, "SELECT id FROM groups WHERE group_name = ?", targetGroup); err != nil {
+		return err
+	}
+	var articleID int
+	if err := tx.GetContext(ctx, &articleID, "SELECT id FROM articles WHERE json_extract(articles.header, '$.Message-Id[0]') = ?", messageID); err != nil {
+		return err
+	}
+	var exists bool
+	if err := tx.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM articles_to_groups WHERE article_id = ? AND group_id = ?)", articleID, groupID); err != nil {
+		return err
+	}
+	if exists {
+		return backend.ErrAlreadyInGroup
+	}
+	if _, err := tx.ExecContext(ctx, "INSERT INTO articles_to_groups (article_id, article_number, group_id) VALUES (?, (SELECT ifnull(max(article_number)+1, 1) FROM articles_to_groups WHERE group_id = ?), ?)", articleID, groupID, groupID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (sb *SQLiteBackend) GetArticle(ctx context.Context, messageID string) (models.Article, error) {
+	var a models.Article
+	if err := sb.conn.GetContext(ctx, &a, "SELECT * FROM articles WHERE json_extract(articles.header, '$.Message-Id[0]') = ? AND "+approvedAnyCond, messageID); err != nil {
+		return a, err
+	}
+	if err := sb.conn.GetContext(ctx, &a.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", a.ID); err != nil {
+		return a, err
+	}
+	if err := sb.conn.SelectContext(ctx, &a.Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", a.ID); err != nil {
+		return a, err
+	}
+	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
+}
+
+func (sb *SQLiteBackend) GetArticleReferences(ctx context.Context, messageID string) ([]string, error) {
+	var references string
+	if err := sb.conn.GetContext(ctx, &references, "SELECT COALESCE(json_extract(header, '$.References[0]'), '') FROM articles WHERE json_extract(header, '$.Message-Id[0]') = ? AND "+approvedAnyCond, messageID); err != nil {
+		return nil, err
+	}
+	return strings.Fields(references), nil
+}
+
+func (sb *SQLiteBackend) GetArticleInGroup(ctx context.Context, g *models.Group, messageID string) (models.Article, error) {
+	var a models.Article
+	if err := sb.conn.GetContext(ctx, &a, "SELECT articles.*, atg.article_number FROM articles INNER JOIN articles_to_groups atg ON atg.article_id = articles.id WHERE json_extract(articles.header, '$.Message-Id[0]') = ? AND atg.group_id = ? AND "+approvedCond, messageID, g.ID); err != nil {
+		return a, err
+	}
+	if err := sb.conn.SelectContext(ctx, &a.Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", a.ID); err != nil {
+		return a, err
+	}
+	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
+}
+
+func (sb *SQLiteBackend) GetArticleGroups(ctx context.Context, messageID string) ([]models.Group, error) {
+	var groups []models.Group
+	return groups, sb.conn.SelectContext(ctx, &groups, "SELECT groups.* FROM groups INNER JOIN articles_to_groups atg ON atg.group_id = groups.id INNER JOIN articles ON articles.id = atg.article_id WHERE json_extract(articles.header, '$.Message-Id[0]') = ? AND "+approvedCond+" ORDER BY groups.group_name", messageID)
+}
+
+// HasArticle looks the message-id up regardless of the approval
+func (sb *SQLiteBackend) HasArticle(ctx context.Context, messageID string) (bool, error) {
+	var exists bool
+	return exists, sb.conn.GetContext(ctx, &exists, "SELECT EXISTS (SELECT 1 FROM articles WHERE json_extract(header, '$.Message-Id[0]') = ?)", messageID)
+}
+
+// ArticleExists looks the article up by message-id, its number is zero unless the article is in the group
+func (sb *SQLiteBackend) ArticleExists(ctx context.Context, g *models.Group, messageID string) (int, bool, error) {
+	var groupID int
+	if g != nil {
+		groupID = g.ID
+	}
+	var num int
+	if err := sb.conn.GetContext(ctx, &num, "SELECT COALESCE((SELECT atg.article_number FROM articles_to_groups atg WHERE atg.article_id = articles.id AND atg.group_id = ? AND "+approvedCond+"), 0) FROM articles WHERE json_extract(articles.header, '$.Message-Id[0]') = ? AND "+approvedAnyCond, groupID, messageID); err != nil {
+		if err == sql.ErrNoRows {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return num, true, nil
+}
+
+// GetArticleNumberForMessageID looks up the number of the article in the group without fetching the article itself
+func (sb *SQLiteBackend) GetArticleNumberForMessageID(ctx context.Context, g *models.Group, messageID string) (int, error) {
+	var num sql.NullInt64
+	if err := sb.conn.GetContext(ctx, &num, "SELECT atg.article_number FROM articles LEFT JOIN articles_to_groups atg ON atg.article_id = articles.id AND atg.group_id = ? AND "+approvedCond+" WHERE json_extract(articles.header, '$.Message-Id[0]') = ? AND "+approvedAnyCond, g.ID, messageID); err != nil {
+		return 0, err
+	}
+	if !num.Valid {
+		return 0, backend.ErrNotInGroup
+	}
+	return int(num.Int64), nil
+}
+
+func (sb *SQLiteBackend) GetArticleByNumber(ctx context.Context, g *models.Group, num int) (models.Article, error) {
+	var a models.Article
+	if err := sb.conn.GetContext(ctx, &a, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number = ? AND atg.group_id = ? AND "+approvedCond, num, g.ID); err != nil {
+		return a, err
+	}
+	a.ArticleNumber = num
+	if err := sb.conn.SelectContext(ctx, &a.Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", a.ID); err != nil {
+		return a, err
+	}
+	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
+}
+
+// GetLatestArticle returns the article with the highest number in the group
+func (sb *SQLiteBackend) GetLatestArticle(ctx context.Context, g *models.Group) (models.Article, error) {
+	var a models.Article
+	if err := sb.conn.GetContext(ctx, &a, "SELECT articles.*, atg.article_number FROM articles INNER JOIN articles_to_groups atg ON atg.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" ORDER BY atg.article_number DESC LIMIT 1", g.ID); err != nil {
+		return a, err
+	}
+	if err := sb.conn.SelectContext(ctx, &a.Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", a.ID); err != nil {
+		return a, err
+	}
+	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
+}
+
+// GetArticleBodyOnly returns the article body without parsing its headers
+func (sb *SQLiteBackend) GetArticleBodyOnly(ctx context.Context, messageID string) ([]byte, error) {
+	var body []byte
+	return body, sb.conn.GetContext(ctx, &body, "SELECT body FROM articles WHERE json_extract(header, '$.Message-Id[0]') = ? AND "+approvedAnyCond, messageID)
+}
+
+// GetArticleBodyOnlyByNumber returns the article body without parsing its headers
+func (sb *SQLiteBackend) GetArticleBodyOnlyByNumber(ctx context.Context, g *models.Group, num int) ([]byte, error) {
+	var body []byte
+	return body, sb.conn.GetContext(ctx, &body, "SELECT articles.body FROM articles INNER JOIN articles_to_groups atg ON atg.article_id = articles.id WHERE atg.article_number = ? AND atg.group_id = ? AND "+approvedCond, num, g.ID)
+}
+
+// GetArticleHeaders returns the article without its body
+func (sb *SQLiteBackend) GetArticleHeaders(ctx context.Context, messageID string) (models.Article, error) {
+	var a models.Article
+	if err := sb.conn.GetContext(ctx, &a, "SELECT articles.id, articles.header, atg.article_number FROM articles INNER JOIN articles_to_groups atg ON atg.article_id = articles.id WHERE json_extract(articles.header, '$.Message-Id[0]') = ? AND "+approvedAnyCond+" LIMIT 1", messageID); err != nil {
+		return a, err
+	}
+	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
+}
+
+// GetArticleHeadersByNumber returns the article without its body
+func (sb *SQLiteBackend) GetArticleHeadersByNumber(ctx context.Context, g *models.Group, num int) (models.Article, error) {
+	var a models.Article
+	if err := sb.conn.GetContext(ctx, &a, "SELECT articles.id, articles.header, atg.article_number FROM articles INNER JOIN articles_to_groups atg ON atg.article_id = articles.id WHERE atg.article_number = ? AND atg.group_id = ? AND "+approvedCond, num, g.ID); err != nil {
+		return a, err
+	}
+	return a, json.Unmarshal([]byte(a.HeaderRaw), &a.Header)
+}
+
+// GetArticleLineCount returns the stored number of the body lines, the same one as the overview reports
+func (sb *SQLiteBackend) GetArticleLineCount(ctx context.Context, articleID int64) (int, error) {
+	var lines int
+	return lines, sb.conn.GetContext(ctx, &lines, "SELECT line_count FROM articles WHERE id = ?", articleID)
+}
+
+// GetArticleByteCount returns the article size as sent by ARTICLE, it's computed by a trigger on saving
+func (sb *SQLiteBackend) GetArticleByteCount(ctx context.Context, articleID int64) (int, error) {
+	var bytes int
+	return bytes, sb.conn.GetContext(ctx, &bytes, "SELECT byte_count FROM articles WHERE id = ?", articleID)
+}
+
+func (sb *SQLiteBackend) GetSpoolSize(ctx context.Context) (int64, error) {
+	var size int64
+	return size, sb.conn.GetContext(ctx, &size, "SELECT COALESCE(SUM(articles.byte_count), 0) FROM articles")
+}
+
+func (sb *SQLiteBackend) GetSpoolSizeForGroup(ctx context.Context, g *models.Group) (int64, error) {
+	var size int64
+	return size, sb.conn.GetContext(ctx, &size, "SELECT COALESCE(SUM(articles.byte_count), 0) FROM articles INNER JOIN articles_to_groups atg ON atg.article_id = articles.id WHERE atg.group_id = ?", g.ID)
+}
+
+func (sb *SQLiteBackend) GetArticlesByHeader(ctx context.Context, headerName, value string) ([]models.Article, error) {
+	if !backend.IsValidHeaderName(headerName) {
+		return nil, backend.ErrInvalidHeader
+	}
+	// headers are stored by their canonical names
+	headerName = textproto.CanonicalMIMEHeaderKey(headerName)
+
+	var articles []models.Article
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT * FROM articles WHERE json_extract(header, '$.' || ? || '[0]') = ? AND "+approvedAnyCond+" ORDER BY id", fmt.Sprintf("\"%s\"", headerName), value); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+	return articles, nil
+}
+
+func (sb *SQLiteBackend) GetArticlesByFromAddress(ctx context.Context, email string) ([]models.Article, error) {
+	email = utils.NormalizeEmail(email)
+	if email == "" {
+		return nil, nil
+	}
+
+	var articles []models.Article
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT * FROM articles WHERE from_email = ? AND "+approvedAnyCond+" ORDER BY id", email); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+	return articles, nil
+}
+
+// GetDistinctFromAddresses returns the sorted unique From addresses of the group articles, normalized on saving
+func (sb *SQLiteBackend) GetDistinctFromAddresses(ctx context.Context, g *models.Group) ([]string, error) {
+	var addresses []string
+	if err := sb.conn.SelectContext(ctx, &addresses, "SELECT DISTINCT from_email FROM articles INNER JOIN articles_to_groups atg ON atg.article_id = articles.id WHERE atg.group_id = ? AND from_email <> '' AND "+approvedCond+" ORDER BY from_email", g.ID); err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+// GetDistinctFromAddressesAll returns the sorted unique From addresses of all the articles
+func (sb *SQLiteBackend) GetDistinctFromAddressesAll(ctx context.Context) ([]string, error) {
+	var addresses []string
+	if err := sb.conn.SelectContext(ctx, &addresses, "SELECT DISTINCT from_email FROM articles WHERE from_email <> '' AND "+approvedAnyCond+" ORDER BY from_email"); err != nil {
+		return nil, err
+	}
+	return addresses, nil
+}
+
+func (sb *SQLiteBackend) GetArticleNumbers(ctx context.Context, g *models.Group, low, high int64) ([]int64, error) {
+	var numbers []int64
+
+	if high == 0 && low == 0 {
+		if err := sb.conn.SelectContext(ctx, &numbers, "SELECT article_number FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = ? AND "+approvedCond, g.ID); err != nil {
+			return nil, err
+		}
+	} else if low == -1 && high != 0 {
+		if err := sb.conn.SelectContext(ctx, &numbers, "SELECT article_number FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = ? AND atg.article_number = ? AND "+approvedCond, g.ID, high); err != nil {
+			return nil, err
+		}
+	} else if low != 0 && high == -1 {
+		if err := sb.conn.SelectContext(ctx, &numbers, "SELECT article_number FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = ? AND atg.article_number >= ? AND "+approvedCond, g.ID, low); err != nil {
+			return nil, err
+		}
+	} else if low == -1 && high == -1 {
+		return nil, nil
+	} else {
+		if err := sb.conn.SelectContext(ctx, &numbers, "SELECT article_number FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = ? AND atg.article_number >= ? AND atg.article_number <= ? AND "+approvedCond, g.ID, low, high); err != nil {
+			return nil, err
+		}
+	}
+
+	return numbers, nil
+}
+
+func (sb *SQLiteBackend) ListArticleIDs(ctx context.Context, g *models.Group) ([]string, error) {
+	var ids []string
+	return ids, sb.conn.SelectContext(ctx, &ids, "SELECT json_extract(articles.header, '$.Message-Id[0]') FROM articles_to_groups atg INNER JOIN articles ON articles.id = atg.article_id WHERE atg.group_id = ? AND "+approvedCond+" AND json_extract(articles.header, '$.Message-Id[0]') IS NOT NULL ORDER BY atg.article_number", g.ID)
+}
+
+func (sb *SQLiteBackend) GetLastArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error) {
+	var lastArticle models.Article
+	if err := sb.conn.GetContext(ctx, &lastArticle, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number < ? AND atg.group_id = ? AND "+approvedCond+" ORDER BY atg.article_number DESC LIMIT 1", a.ArticleNumber, g.ID); err != nil {
+		return lastArticle, err
+	}
+	if err := sb.conn.GetContext(ctx, &lastArticle.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", lastArticle.ID); err != nil {
+		return lastArticle, err
+	}
+	return lastArticle, json.Unmarshal([]byte(lastArticle.HeaderRaw), &lastArticle.Header)
+}
+
+func (sb *SQLiteBackend) GetNextArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error) {
+	var nextArticle models.Article
+	if err := sb.conn.GetContext(ctx, &nextArticle, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number > ? AND atg.group_id = ? AND "+approvedCond+" ORDER BY atg.article_number LIMIT 1", a.ArticleNumber, g.ID); err != nil {
+		return nextArticle, err
+	}
+	if err := sb.conn.GetContext(ctx, &nextArticle.ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", nextArticle.ID); err != nil {
+		return nextArticle, err
+	}
+	return nextArticle, json.Unmarshal([]byte(nextArticle.HeaderRaw), &nextArticle.Header)
+}
+
+func (sb *SQLiteBackend) GetArticlesByRange(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error) {
+	var articles []models.Article
+
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT articles.*, atg.article_number, att.article_id IS NOT NULL AS has_attachments FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id LEFT JOIN (SELECT DISTINCT article_id FROM attachments_articles_mapping) att ON att.article_id = articles.id WHERE atg.article_number >= ? AND atg.article_number <= ? AND atg.group_id = ? AND "+approvedCond+" ORDER BY atg.article_number", low, high, g.ID); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+// GetArticlesSinceLastRead returns the articles numbered after lastReadNum in a single query
+func (sb *SQLiteBackend) GetArticlesSinceLastRead(ctx context.Context, g *models.Group, lastReadNum int64) ([]models.Article, error) {
+	var articles []models.Article
+
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT articles.*, atg.article_number, att.article_id IS NOT NULL AS has_attachments FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id LEFT JOIN (SELECT DISTINCT article_id FROM attachments_articles_mapping) att ON att.article_id = articles.id WHERE atg.article_number > ? AND atg.group_id = ? AND "+approvedCond+" ORDER BY atg.article_number", lastReadNum, g.ID); err != nil {
+		return nil, err
+	}
+	if len(articles) == 0 {
+		return nil, backend.ErrNoNewArticles
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+func (sb *SQLiteBackend) GetLastNArticles(ctx context.Context, g *models.Group, n int) ([]models.Article, error) {
+	var articles []models.Article
+
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT articles.*, atg.article_number, att.article_id IS NOT NULL AS has_attachments FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id LEFT JOIN (SELECT DISTINCT article_id FROM attachments_articles_mapping) att ON att.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" ORDER BY atg.article_number DESC LIMIT ?", g.ID, n); err != nil {
+		return nil, err
+	}
+	slices.Reverse(articles)
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+// GetUnreadArticles returns the group articles except the ones with readNumbers, ordered by article number.
+// The read numbers are put into a temporary table, so their count isn't limited by the number of bind variables.
+func (sb *SQLiteBackend) GetUnreadArticles(ctx context.Context, g *models.Group, readNumbers []int64) ([]models.Article, error) {
+	// the transaction is never committed, so the temporary table goes away with its rollback
+	tx, err := sb.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.ExecContext(ctx, "CREATE TEMP TABLE read_numbers (article_number INTEGER PRIMARY KEY)"); err != nil {
+		return nil, err
+	}
+	for start := 0; start < len(readNumbers); start += bulkInsertBatchSize {
+		end := start + bulkInsertBatchSize
+		if end > len(readNumbers) {
+			end = len(readNumbers)
+		}
+
+		var values []string
+		var args []interface{}
+		for _, v := range readNumbers[start:end] {
+			values = append(values, "(?)")
+			args = append(args, v)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO read_numbers (article_number) VALUES "+strings.Join(values, ", "), args...); err != nil {
+			return nil, err
+		}
+	}
+
+	var articles []models.Article
+	if err := tx.SelectContext(ctx, &articles, "SELECT articles.*, atg.article_number, att.article_id IS NOT NULL AS has_attachments FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id LEFT JOIN (SELECT DISTINCT article_id FROM attachments_articles_mapping) att ON att.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" AND atg.article_number NOT IN (SELECT article_number FROM read_numbers) ORDER BY atg.article_number", g.ID); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+// GetArticlesSortedByScore returns the group articles in the range, the ones of the threads with more replies first
+func (sb *SQLiteBackend) GetArticlesSortedByScore(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error) {
+	var articles []models.Article
+
+	replyCount := "(SELECT COUNT(*) FROM articles r INNER JOIN articles_to_groups ratg ON ratg.article_id = r.id WHERE ratg.group_id = atg.group_id AND r.thread = COALESCE(articles.thread, json_extract(articles.header, '$.Message-Id[0]')) AND (r.approved OR NOT (SELECT groups.moderated FROM groups WHERE groups.id = ratg.group_id)))"
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT articles.*, atg.article_number, att.article_id IS NOT NULL AS has_attachments, "+replyCount+" AS reply_count FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id LEFT JOIN (SELECT DISTINCT article_id FROM attachments_articles_mapping) att ON att.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" AND atg.article_number >= ? AND atg.article_number <= ? ORDER BY atg.article_number", g.ID, low, high); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	backend.SortByScore(articles, backend.ReplyCountScore{})
+	return articles, nil
+}
+
+// GetArticlesWithAttachments returns the group articles which have attachments, ordered by article number
+func (sb *SQLiteBackend) GetArticlesWithAttachments(ctx context.Context, g *models.Group) ([]models.Article, error) {
+	var articles []models.Article
+
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT articles.*, atg.article_number, TRUE AS has_attachments FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id INNER JOIN (SELECT DISTINCT article_id FROM attachments_articles_mapping) att ON att.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" ORDER BY atg.article_number", g.ID); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := sb.conn.SelectContext(ctx, &articles[i].Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", articles[i].ID); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+// GetArticlesSince returns the group articles created after since, ordered by article number
+func (sb *SQLiteBackend) GetArticlesSince(ctx context.Context, g *models.Group, since time.Time) ([]models.Article, error) {
+	var articles []models.Article
+
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT articles.*, atg.article_number, att.article_id IS NOT NULL AS has_attachments FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id LEFT JOIN (SELECT DISTINCT article_id FROM attachments_articles_mapping) att ON att.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" AND articles.created_at > datetime(?, 'unixepoch') ORDER BY atg.article_number", g.ID, since.Unix()); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+func (sb *SQLiteBackend) GetArticlesByDateRange(ctx context.Context, g *models.Group, from, to time.Time) ([]models.Article, error) {
+	var articles []models.Article
+
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT articles.*, atg.article_number, att.article_id IS NOT NULL AS has_attachments FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id LEFT JOIN (SELECT DISTINCT article_id FROM attachments_articles_mapping) att ON att.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" AND articles.created_at BETWEEN datetime(?, 'unixepoch') AND datetime(?, 'unixepoch') ORDER BY atg.article_number", g.ID, from.Unix(), to.Unix()); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+func (sb *SQLiteBackend) GetRecentArticlesAcrossGroups(ctx context.Context, n int) ([]models.ArticleWithGroup, error) {
+	var articles []models.ArticleWithGroup
+
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT articles.*, atg.article_number, atg.group_id, groups.group_name FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id INNER JOIN groups ON groups.id = atg.group_id WHERE "+approvedCond+" ORDER BY articles.created_at DESC, articles.id DESC, groups.group_name LIMIT ?", n); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+func (sb *SQLiteBackend) GetArticlesByRangeWithHeaders(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error) {
+	var articles []models.Article
+
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT articles.id, articles.header, atg.article_number, articles.byte_count, articles.line_count FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number >= ? AND atg.article_number <= ? AND atg.group_id = ? AND "+approvedCond+" ORDER BY atg.article_number", low, high, g.ID); err != nil {
 		return nil, err
 	}
 	for i := 0; i < len(articles); i++ {
-		if err := sb.db.Get(&articles[i].ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", articles[i].ID); err != nil {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
 			return nil, err
 		}
+	}
+
+	return articles, nil
+}
+
+func (sb *SQLiteBackend) GetOverviewByRange(ctx context.Context, g *models.Group, low, high int64, extraHeaders []string) ([]models.Overview, error) {
+	var rows []overviewRow
+
+	q := "SELECT atg.article_number, COALESCE(json_extract(articles.header, '$.Subject[0]'), '') AS subject, COALESCE(json_extract(articles.header, '$.From[0]'), '') AS from_header, COALESCE(json_extract(articles.header, '$.Date[0]'), '') AS date, COALESCE(json_extract(articles.header, '$.Message-Id[0]'), '') AS message_id, COALESCE(json_extract(articles.header, '$.References[0]'), '') AS references_header, articles.byte_count AS bytes, articles.line_count AS lines"
+	var args []interface{}
+	if len(extraHeaders) > 0 {
+		var fields []string
+		for _, v := range extraHeaders {
+			fields = append(fields, "json_extract(articles.header, ?)")
+			args = append(args, fmt.Sprintf("$.\"%s\"[0]", v))
+		}
+		q += ", json_array(" + strings.Join(fields, ", ") + ") AS extra_headers"
+	}
+	q += " FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number >= ? AND atg.article_number <= ? AND atg.group_id = ? AND " + approvedCond + " ORDER BY atg.article_number"
+	args = append(args, low, high, g.ID)
+
+	if err := sb.conn.SelectContext(ctx, &rows, q, args...); err != nil {
+		return nil, err
+	}
+	overview := make([]models.Overview, 0, len(rows))
+	for _, r := range rows {
+		if r.ExtraHeaders != nil {
+			var values []*string
+			if err := json.Unmarshal([]byte(*r.ExtraHeaders), &values); err != nil {
+				return nil, err
+			}
+			for _, v := range values {
+				if v == nil {
+					r.Extra = append(r.Extra, "")
+				} else {
+					r.Extra = append(r.Extra, *v)
+				}
+			}
+		}
+		overview = append(overview, r.Overview)
+	}
+	return overview, nil
+}
+
+func (sb *SQLiteBackend) GetHeaderFieldByRange(ctx context.Context, g *models.Group, field string, low, high int64) ([]models.HeaderField, error) {
+	if !backend.IsValidHeaderName(field) {
+		return nil, backend.ErrInvalidHeader
+	}
+	field = textproto.CanonicalMIMEHeaderKey(field)
+
+	var fields []models.HeaderField
+	return fields, sb.conn.SelectContext(ctx, &fields, "SELECT atg.article_number, COALESCE(json_extract(articles.header, ?), '') AS value FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number >= ? AND atg.article_number <= ? AND atg.group_id = ? AND "+approvedCond+" ORDER BY atg.article_number", fmt.Sprintf("$.\"%s\"[0]", field), low, high, g.ID)
+}
+
+// GetNewArticlesSince returns message-ids of the articles created after the timestamp, optionally limited to the groups
+// matching any of the wildmats
+func (sb *SQLiteBackend) GetNewArticlesSince(ctx context.Context, timestamp int64, groups []string) ([]string, error) {
+	q, args, err := newArticlesSinceQuery("json_extract(articles.header, '$.Message-Id[0]')", timestamp, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	var articleIds []string
+	return articleIds, sb.conn.SelectContext(ctx, &articleIds, q, args...)
+}
+
+// GetNewArticlesFullSince is like GetNewArticlesSince, but whole articles are returned
+func (sb *SQLiteBackend) GetNewArticlesFullSince(ctx context.Context, timestamp int64, groups []string) ([]models.Article, error) {
+	q, args, err := newArticlesSinceQuery("*", timestamp, groups)
+	if err != nil {
+		return nil, err
+	}
+
+	var articles []models.Article
+	if err := sb.conn.SelectContext(ctx, &articles, q, args...); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
 		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
 			return nil, err
 		}
@@ -228,19 +1279,408 @@ func (sb *SQLiteBackend) GetArticlesByRange(g *models.Group, low, high int64) ([
 	return articles, nil
 }
 
-func (sb *SQLiteBackend) GetNewArticlesSince(timestamp int64) ([]string, error) {
-	var articleIds []string
-	return articleIds, sb.db.Select(&articleIds, "SELECT json_extract(articles.header, '$.Message-Id[0]') FROM articles WHERE created_at > datetime(?, 'unixepoch')", timestamp)
+// newArticlesSinceQuery selects the columns of the articles created after the timestamp, ordered by creation time
+func newArticlesSinceQuery(columns string, timestamp int64, groups []string) (string, []interface{}, error) {
+	q := "SELECT " + columns + " FROM articles WHERE created_at > datetime(?, 'unixepoch') AND " + approvedAnyCond
+	args := []interface{}{timestamp}
+	if len(groups) > 0 {
+		var conds []string
+		for _, v := range groups {
+			r, err := utils.CompileWildmat(v)
+			if err != nil {
+				return "", nil, err
+			}
+			conds = append(conds, "groups.group_name REGEXP ?")
+			args = append(args, r.String())
+		}
+		q += " AND id IN (SELECT atg.article_id FROM articles_to_groups atg INNER JOIN groups ON groups.id = atg.group_id WHERE " + strings.Join(conds, " OR ") + ")"
+	}
+	return q + " ORDER BY created_at", args, nil
+}
+
+// GetNewThreads returns numbers of the thread starting articles, newest first. Pages are numbered from 1.
+func (sb *SQLiteBackend) GetNewThreads(ctx context.Context, g *models.Group, perPage int, pageNum int) ([]int, error) {
+	var numbers []int
+
+	return numbers, sb.conn.SelectContext(ctx, &numbers, "SELECT atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" AND articles.thread IS NULL ORDER BY articles.created_at DESC LIMIT ? OFFSET ?", g.ID, perPage, perPage*(pageNum-1))
 }
 
-func (sb *SQLiteBackend) GetNewThreads(g *models.Group, perPage int, pageNum int) ([]int, error) {
+// GetNewThreadsSince is like GetNewThreads, but only threads started after since are returned
+func (sb *SQLiteBackend) GetNewThreadsSince(ctx context.Context, g *models.Group, since time.Time, perPage, pageNum int) ([]int, error) {
 	var numbers []int
 
-	return numbers, sb.db.Select(&numbers, "SELECT atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? AND articles.thread IS NULL ORDER BY articles.created_at DESC LIMIT ? OFFSET ?", g.ID, perPage, perPage*pageNum)
+	return numbers, sb.conn.SelectContext(ctx, &numbers, "SELECT atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" AND articles.thread IS NULL AND articles.created_at > datetime(?, 'unixepoch') ORDER BY articles.created_at DESC LIMIT ? OFFSET ?", g.ID, since.Unix(), perPage, perPage*(pageNum-1))
+}
+
+// GetThreadCount returns the number of threads started in the group
+func (sb *SQLiteBackend) GetThreadCount(ctx context.Context, g *models.Group) (int, error) {
+	var count int
+	return count, sb.conn.GetContext(ctx, &count, "SELECT COUNT(*) FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" AND articles.thread IS NULL", g.ID)
+}
+
+func (sb *SQLiteBackend) GetTopPosters(ctx context.Context, g *models.Group, n int) ([]models.PosterStats, error) {
+	var rows []struct {
+		From  string `db:"from_header"`
+		Count int    `db:"article_count"`
+	}
+	if err := sb.conn.SelectContext(ctx, &rows, "SELECT json_extract(articles.header, '$.From[0]') AS from_header, COUNT(*) AS article_count FROM articles INNER JOIN articles_to_groups atg ON atg.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" AND json_extract(articles.header, '$.From[0]') IS NOT NULL GROUP BY from_header ORDER BY article_count DESC, from_header LIMIT ?", g.ID, n); err != nil {
+		return nil, err
+	}
+
+	posters := make([]models.PosterStats, 0, len(rows))
+	for _, v := range rows {
+		posters = append(posters, backend.NewPosterStats(v.From, v.Count))
+	}
+	return posters, nil
 }
 
-func (sb *SQLiteBackend) GetThread(g *models.Group, threadNum int) ([]int, error) {
+func (sb *SQLiteBackend) GetThread(ctx context.Context, g *models.Group, threadNum int) ([]int, error) {
 	var numbers []int
 
-	return numbers, sb.db.Select(&numbers, "SELECT atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? AND articles.thread = json_extract((SELECT articles.header from articles INNER JOIN articles_to_groups a on articles.id = a.article_id WHERE a.group_id = ? AND a.article_number = ?), '$.Message-Id[0]') ORDER BY articles.created_at", g.ID, g.ID, threadNum)
+	return numbers, sb.conn.SelectContext(ctx, &numbers, "SELECT atg.article_number FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" AND articles.thread = json_extract((SELECT articles.header from articles INNER JOIN articles_to_groups a on articles.id = a.article_id WHERE a.group_id = ? AND a.article_number = ?), '$.Message-Id[0]') ORDER BY articles.created_at", g.ID, g.ID, threadNum)
+}
+
+// GetArticlesByThread returns the thread root with the message-id threadID and all the replies to it
+func (sb *SQLiteBackend) GetArticlesByThread(ctx context.Context, g *models.Group, threadID string) ([]models.Article, error) {
+	var articles []models.Article
+
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT articles.*, atg.article_number, att.article_id IS NOT NULL AS has_attachments FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id LEFT JOIN (SELECT DISTINCT article_id FROM attachments_articles_mapping) att ON att.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" AND (articles.thread = ? OR json_extract(articles.header, '$.Message-Id[0]') = ?) ORDER BY articles.created_at", g.ID, threadID, threadID); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+// GetArticlesBySubject returns the group articles with the subject, reply markers are ignored.
+// In fuzzy mode the subject only needs to be contained in the article one, regardless of case.
+func (sb *SQLiteBackend) GetArticlesBySubject(ctx context.Context, g *models.Group, subject string, fuzzy bool) ([]models.Article, error) {
+	subject = utils.StripReplyPrefix(subject)
+	var candidates []models.Article
+	if err := sb.conn.SelectContext(ctx, &candidates, "SELECT articles.*, atg.article_number FROM articles INNER JOIN articles_to_groups atg ON atg.article_id = articles.id WHERE atg.group_id = ? AND "+approvedCond+" AND json_extract(articles.header, '$.Subject[0]') LIKE ? ESCAPE '\\' ORDER BY atg.article_number", g.ID, "%"+utils.EscapeLike(subject)+"%"); err != nil {
+		return nil, err
+	}
+
+	var articles []models.Article
+	for _, v := range candidates {
+		if err := json.Unmarshal([]byte(v.HeaderRaw), &v.Header); err != nil {
+			return nil, err
+		}
+		if fuzzy || utils.StripReplyPrefix(v.Header.Get("Subject")) == subject {
+			articles = append(articles, v)
+		}
+	}
+	return articles, nil
+}
+
+// GetArticleReferencesTree returns the replies to every article of the thread started by rootMessageID,
+// candidates are the articles of the thread and the ones transitively referencing the root
+func (sb *SQLiteBackend) GetArticleReferencesTree(ctx context.Context, rootMessageID string) (map[string][]string, error) {
+	var articles []models.Article
+	if err := sb.conn.SelectContext(ctx, &articles, "WITH RECURSIVE tree(id, message_id) AS (SELECT id, json_extract(header, '$.Message-Id[0]') FROM articles WHERE json_extract(header, '$.Message-Id[0]') = ? UNION SELECT articles.id, json_extract(articles.header, '$.Message-Id[0]') FROM articles INNER JOIN tree ON json_extract(articles.header, '$.In-Reply-To[0]') = tree.message_id OR instr(json_extract(articles.header, '$.References[0]'), tree.message_id) > 0) SELECT articles.id, articles.header FROM articles WHERE (articles.id IN (SELECT id FROM tree) OR articles.thread = ?) AND "+approvedAnyCond+" ORDER BY articles.created_at, articles.id", rootMessageID, rootMessageID); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+	return backend.BuildReferencesTree(rootMessageID, articles)
+}
+
+func (sb *SQLiteBackend) CreateUser(ctx context.Context, username, password string) error {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return err
+	}
+	_, err = sb.conn.ExecContext(ctx, "INSERT INTO users (username, password_hash) VALUES (?, ?)", username, string(hash))
+	return err
+}
+
+func (sb *SQLiteBackend) AuthenticateUser(ctx context.Context, username, password string) (bool, error) {
+	var hash string
+	if err := sb.conn.GetContext(ctx, &hash, "SELECT password_hash FROM users WHERE username = ?", username); err != nil {
+		if err == sql.ErrNoRows {
+			return false, nil
+		}
+		return false, err
+	}
+	if err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password)); err != nil {
+		if err == bcrypt.ErrMismatchedHashAndPassword {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+func (sb *SQLiteBackend) GetUserID(ctx context.Context, username string) (int64, error) {
+	var id int64
+	return id, sb.conn.GetContext(ctx, &id, "SELECT id FROM users WHERE username = ?", username)
+}
+
+func (sb *SQLiteBackend) CanRead(ctx context.Context, userID int64, groupName string) (bool, error) {
+	var ok bool
+	return ok, sb.conn.GetContext(ctx, &ok, "SELECT NOT EXISTS (SELECT 1 FROM permissions p INNER JOIN groups g ON g.id = p.group_id WHERE g.group_name = ?) OR EXISTS (SELECT 1 FROM permissions p INNER JOIN groups g ON g.id = p.group_id WHERE g.group_name = ? AND p.user_id = ?)", groupName, groupName, userID)
+}
+
+func (sb *SQLiteBackend) CanPost(ctx context.Context, userID int64, groupName string) (bool, error) {
+	var ok bool
+	return ok, sb.conn.GetContext(ctx, &ok, "SELECT (NOT EXISTS (SELECT 1 FROM permissions p INNER JOIN groups g ON g.id = p.group_id WHERE g.group_name = ?) OR EXISTS (SELECT 1 FROM permissions p INNER JOIN groups g ON g.id = p.group_id WHERE g.group_name = ? AND p.user_id = ? AND p.role IN (?, ?))) AND NOT EXISTS (SELECT 1 FROM groups WHERE group_name = ? AND posting_status = ?)", groupName, groupName, userID, models.RolePoster, models.RoleModerator, groupName, models.PostingNotAllowed)
+}
+
+func (sb *SQLiteBackend) IsModerator(ctx context.Context, userID int64, groupName string) (bool, error) {
+	var ok bool
+	return ok, sb.conn.GetContext(ctx, &ok, "SELECT EXISTS (SELECT 1 FROM permissions p INNER JOIN groups g ON g.id = p.group_id WHERE g.group_name = ? AND p.user_id = ? AND p.role = ?)", groupName, userID, models.RoleModerator)
+}
+
+func (sb *SQLiteBackend) SetPermission(ctx context.Context, userID int64, groupName, role string) error {
+	res, err := sb.conn.ExecContext(ctx, "INSERT INTO permissions (user_id, group_id, role) SELECT ?, id, ? FROM groups WHERE group_name = ? ON CONFLICT (user_id, group_id) DO UPDATE SET role = excluded.role", userID, role, groupName)
+	if err != nil {
+		return err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+func (sb *SQLiteBackend) SearchArticles(ctx context.Context, query string, groups []string) ([]models.Article, error) {
+	var articles []models.Article
+
+	q := "SELECT articles.*, snippet(articles_fts, 1, '', '', '...', 16) AS snippet FROM articles_fts INNER JOIN articles ON articles.id = articles_fts.rowid WHERE articles_fts MATCH ? AND " + approvedAnyCond
+	args := []interface{}{query}
+	if len(groups) > 0 {
+		q += " AND articles.id IN (SELECT atg.article_id FROM articles_to_groups atg INNER JOIN groups ON groups.id = atg.group_id WHERE groups.group_name IN (?))"
+		args = append(args, groups)
+	}
+	q += " ORDER BY rank"
+
+	q, args, err := sqlx.In(q, args...)
+	if err != nil {
+		return nil, err
+	}
+	if err := sb.conn.SelectContext(ctx, &articles, q, args...); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+// ExpireGroupArticles removes the articles created before the given time from the group.
+// Articles which are left without any group are deleted completely, their count is returned.
+func (sb *SQLiteBackend) ExpireGroupArticles(ctx context.Context, g *models.Group, before time.Time) (int, error) {
+	tx, err := sb.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var expiredIDs []int
+	if err := tx.SelectContext(ctx, &expiredIDs, "DELETE FROM articles_to_groups WHERE group_id = ? AND article_id IN (SELECT id FROM articles WHERE created_at < datetime(?, 'unixepoch')) RETURNING article_id", g.ID, before.Unix()); err != nil {
+		return 0, err
+	}
+
+	deleted, err := deleteExpiredArticles(ctx, tx, expiredIDs)
+	if err != nil {
+		return 0, err
+	}
+	return deleted, tx.Commit()
+}
+
+// RunExpiration removes the articles older than the retention_days of their groups in one transaction.
+// Articles which are left without any group are deleted completely, their count is returned.
+func (sb *SQLiteBackend) RunExpiration(ctx context.Context) (int, error) {
+	tx, err := sb.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var expiredIDs []int
+	if err := tx.SelectContext(ctx, &expiredIDs, "DELETE FROM articles_to_groups WHERE article_id IN (SELECT articles.id FROM articles INNER JOIN groups ON groups.id = articles_to_groups.group_id WHERE groups.retention_days > 0 AND articles.created_at < datetime('now', '-' || groups.retention_days || ' days')) RETURNING article_id"); err != nil {
+		return 0, err
+	}
+	deleted, err := deleteExpiredArticles(ctx, tx, expiredIDs)
+	if err != nil {
+		return 0, err
+	}
+
+	return deleted, tx.Commit()
+}
+
+// deleteExpiredArticles deletes the articles removed from their groups unless they are still cross-posted elsewhere
+func deleteExpiredArticles(ctx context.Context, tx *metrics.Tx, expiredIDs []int) (int, error) {
+	deleted := 0
+	seen := map[int]bool{}
+	for _, v := range expiredIDs {
+		if seen[v] {
+			continue
+		}
+		seen[v] = true
+
+		// article may be still cross-posted to groups with longer retention
+		var groupsLeft int
+		if err := tx.GetContext(ctx, &groupsLeft, "SELECT COUNT(*) FROM articles_to_groups WHERE article_id = ?", v); err != nil {
+			return 0, err
+		}
+		if groupsLeft > 0 {
+			continue
+		}
+
+		if _, err := tx.ExecContext(ctx, "DELETE FROM attachments WHERE attachment_id IN (SELECT attachment_id FROM attachments_articles_mapping WHERE article_id = ?)", v); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM attachments_articles_mapping WHERE article_id = ?", v); err != nil {
+			return 0, err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM articles WHERE id = ?", v); err != nil {
+			return 0, err
+		}
+		deleted++
+	}
+	return deleted, nil
+}
+
+func (sb *SQLiteBackend) GetOrphanedArticles(ctx context.Context) ([]models.Article, error) {
+	var articles []models.Article
+
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT articles.* FROM articles LEFT JOIN articles_to_groups atg ON atg.article_id = articles.id WHERE atg.article_id IS NULL ORDER BY articles.id"); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+func (sb *SQLiteBackend) PruneOrphanedArticles(ctx context.Context) (int, error) {
+	tx, err := sb.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	const orphaned = "SELECT articles.id FROM articles LEFT JOIN articles_to_groups atg ON atg.article_id = articles.id WHERE atg.article_id IS NULL"
+	if _, err := tx.ExecContext(ctx, "DELETE FROM attachments WHERE attachment_id IN (SELECT attachment_id FROM attachments_articles_mapping WHERE article_id IN ("+orphaned+"))"); err != nil {
+		return 0, err
+	}
+	if _, err := tx.ExecContext(ctx, "DELETE FROM attachments_articles_mapping WHERE article_id IN ("+orphaned+")"); err != nil {
+		return 0, err
+	}
+	res, err := tx.ExecContext(ctx, "DELETE FROM articles WHERE id IN ("+orphaned+")")
+	if err != nil {
+		return 0, err
+	}
+	n, err := res.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(n), tx.Commit()
+}
+
+func (sb *SQLiteBackend) GetArticlesNotSeenByPeer(ctx context.Context, peerID string, since time.Time) ([]models.Article, error) {
+	var articles []models.Article
+
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT * FROM articles WHERE id > COALESCE((SELECT last_article_id FROM peer_sync_state WHERE peer_id = ?), 0) AND created_at >= datetime(?, 'unixepoch') AND "+approvedAnyCond+" ORDER BY id", peerID, since.Unix()); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := sb.conn.SelectContext(ctx, &articles[i].Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", articles[i].ID); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+func (sb *SQLiteBackend) SetPeerSyncState(ctx context.Context, peerID string, lastArticleID int) error {
+	_, err := sb.conn.ExecContext(ctx, "INSERT INTO peer_sync_state (peer_id, last_article_id) VALUES (?, ?) ON CONFLICT (peer_id) DO UPDATE SET last_article_id = excluded.last_article_id, updated_at = CURRENT_TIMESTAMP", peerID, lastArticleID)
+	return err
+}
+
+// GetArticlesForPeer returns up to batchSize articles which haven't been fed to the peer yet, ordered by id
+func (sb *SQLiteBackend) GetArticlesForPeer(ctx context.Context, peerID string, batchSize int) ([]models.Article, error) {
+	var articles []models.Article
+
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT * FROM articles WHERE id > COALESCE((SELECT last_article_id FROM peer_sync_state WHERE peer_id = ?), 0) AND id NOT IN (SELECT article_id FROM peer_article_state WHERE peer_id = ?) AND "+approvedAnyCond+" ORDER BY id LIMIT ?", peerID, peerID, batchSize); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := sb.conn.SelectContext(ctx, &articles[i].Attachments, "SELECT content_type, attachment_id FROM attachments_articles_mapping WHERE article_id = ?", articles[i].ID); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+
+	return articles, nil
+}
+
+// MarkArticlesSentToPeer records the articles as fed to the peer.
+// The peer sync state is then advanced over the articles sent without gaps, and their rows are pruned.
+func (sb *SQLiteBackend) MarkArticlesSentToPeer(ctx context.Context, peerID string, articleIDs []int64) error {
+	tx, err := sb.conn.BeginTxx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for start := 0; start < len(articleIDs); start += bulkInsertBatchSize {
+		end := start + bulkInsertBatchSize
+		if end > len(articleIDs) {
+			end = len(articleIDs)
+		}
+
+		var values []string
+		var args []interface{}
+		for _, v := range articleIDs[start:end] {
+			values = append(values, "(?, ?)")
+			args = append(args, peerID, v)
+		}
+		if _, err := tx.ExecContext(ctx, "INSERT OR IGNORE INTO peer_article_state (peer_id, article_id) VALUES "+strings.Join(values, ", "), args...); err != nil {
+			return err
+		}
+	}
+
+	var last int64
+	if err := tx.GetContext(ctx, &last, "SELECT COALESCE((SELECT last_article_id FROM peer_sync_state WHERE peer_id = ?), 0)", peerID); err != nil {
+		return err
+	}
+	// everything below the first article that wasn't sent is done
+	var next int64
+	if err := tx.GetContext(ctx, &next, "SELECT COALESCE((SELECT MIN(id) - 1 FROM articles WHERE id > ? AND id NOT IN (SELECT article_id FROM peer_article_state WHERE peer_id = ?)), (SELECT MAX(article_id) FROM peer_article_state WHERE peer_id = ?), ?)", last, peerID, peerID, last); err != nil {
+		return err
+	}
+	if next > last {
+		if _, err := tx.ExecContext(ctx, "INSERT INTO peer_sync_state (peer_id, last_article_id) VALUES (?, ?) ON CONFLICT (peer_id) DO UPDATE SET last_article_id = excluded.last_article_id, updated_at = CURRENT_TIMESTAMP", peerID, next); err != nil {
+			return err
+		}
+		if _, err := tx.ExecContext(ctx, "DELETE FROM peer_article_state WHERE peer_id = ? AND article_id <= ?", peerID, next); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
 }
@@ -0,0 +1,1159 @@
+//go:build sqlite_fts5
+
+package sqlite
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+)
+
+// newTestBackend opens a fresh in-memory database, which is shared by all connections of the backend
+func newTestBackend(t testing.TB) *SQLiteBackend {
+	t.Helper()
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	b, err := NewSQLiteBackend(config.SQLiteBackendConfig{Path: "file:" + name + "?mode=memory&cache=shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	return b
+}
+
+func createTestGroups(t testing.TB, b *SQLiteBackend, names ...string) {
+	t.Helper()
+	for _, v := range names {
+		if err := b.CreateGroup(context.Background(), v, "", false, "y"); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+// testArticle builds an article with the header fields given as name-value pairs
+func testArticle(t testing.TB, body string, fields ...string) models.Article {
+	t.Helper()
+	header := map[string][]string{}
+	for i := 0; i+1 < len(fields); i += 2 {
+		header[fields[i]] = append(header[fields[i]], fields[i+1])
+	}
+	raw, err := json.Marshal(header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return models.Article{HeaderRaw: string(raw), Header: header, Body: body}
+}
+
+func TestSaveArticleDuplicateMessageID(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group")
+	ctx := context.Background()
+
+	a := testArticle(t, "hello\n", "Message-Id", "<dup@example.com>", "Subject", "first")
+	if err := b.SaveArticle(ctx, a, []string{"test.group"}); err != nil {
+		t.Fatalf("SaveArticle() error = %v", err)
+	}
+
+	dup := testArticle(t, "again\n", "Message-Id", "<dup@example.com>", "Subject", "second")
+	if err := b.SaveArticle(ctx, dup, []string{"test.group"}); !errors.Is(err, backend.ErrArticleExists) {
+		t.Fatalf("SaveArticle() of a duplicate error = %v, want %v", err, backend.ErrArticleExists)
+	}
+
+	// the plain INSERT of the bulk saving hits the UNIQUE index itself
+	if err := b.BulkSaveArticles(ctx, []models.Article{dup}, []string{"test.group"}); err == nil || !strings.Contains(err.Error(), "UNIQUE") {
+		t.Fatalf("BulkSaveArticles() of a duplicate error = %v, want UNIQUE constraint violation", err)
+	}
+
+	stored, err := b.GetArticle(ctx, "<dup@example.com>")
+	if err != nil {
+		t.Fatalf("GetArticle() error = %v", err)
+	}
+	if got := stored.Header.Get("Subject"); got != "first" {
+		t.Errorf("stored Subject = %q, want %q", got, "first")
+	}
+	g, err := b.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatalf("GetGroup() error = %v", err)
+	}
+	if count, err := b.GetArticlesCount(ctx, &g); err != nil || count != 1 {
+		t.Errorf("GetArticlesCount() = %d, %v, want 1", count, err)
+	}
+}
+
+func TestGetArticlesSinceLastRead(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group")
+	ctx := context.Background()
+
+	for _, v := range []string{"<1@example.com>", "<2@example.com>", "<3@example.com>"} {
+		if err := b.SaveArticle(ctx, testArticle(t, "hello\n", "Message-Id", v), []string{"test.group"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g, err := b.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	articles, err := b.GetArticlesSinceLastRead(ctx, &g, 1)
+	if err != nil {
+		t.Fatalf("GetArticlesSinceLastRead() error = %v", err)
+	}
+	if len(articles) != 2 || articles[0].ArticleNumber != 2 || articles[1].ArticleNumber != 3 {
+		t.Errorf("GetArticlesSinceLastRead() = %+v, want articles 2 and 3", articles)
+	}
+	if _, err := b.GetArticlesSinceLastRead(ctx, &g, 3); !errors.Is(err, backend.ErrNoNewArticles) {
+		t.Errorf("GetArticlesSinceLastRead() past the last article error = %v, want %v", err, backend.ErrNoNewArticles)
+	}
+}
+
+func TestRenameGroup(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.old", "test.taken")
+	ctx := context.Background()
+
+	a := testArticle(t, "hello\n", "Message-Id", "<renamed@example.com>", "Subject", "before the rename")
+	if err := b.SaveArticle(ctx, a, []string{"test.old"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := b.RenameGroup(ctx, "test.old", "test.new"); err != nil {
+		t.Fatalf("RenameGroup() error = %v", err)
+	}
+	if _, err := b.GetGroup(ctx, "test.old"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetGroup() of the old name error = %v, want sql.ErrNoRows", err)
+	}
+	g, err := b.GetGroup(ctx, "test.new")
+	if err != nil {
+		t.Fatalf("GetGroup() of the new name error = %v", err)
+	}
+	stored, err := b.GetArticleByNumber(ctx, &g, 1)
+	if err != nil {
+		t.Fatalf("GetArticleByNumber() error = %v", err)
+	}
+	if got := stored.Header.Get("Message-Id"); got != "<renamed@example.com>" {
+		t.Errorf("article 1 of the renamed group = %q", got)
+	}
+
+	if err := b.RenameGroup(ctx, "test.new", "test.taken"); err == nil {
+		t.Error("RenameGroup() to an existing group name succeeded")
+	}
+	if err := b.RenameGroup(ctx, "no.such.group", "test.other"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("RenameGroup() of a missing group error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestGetArticlesByHeader(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group")
+	ctx := context.Background()
+
+	articles := []models.Article{
+		testArticle(t, "hello\n", "Message-Id", "<root@example.com>", "From", "alice@example.com", "Subject", "Root"),
+		testArticle(t, "hi\n", "Message-Id", "<reply@example.com>", "From", "bob@example.com", "Subject", "Re: Root", "References", "<root@example.com>"),
+		testArticle(t, "more\n", "Message-Id", "<other@example.com>", "From", "alice@example.com", "Subject", "Other"),
+	}
+	for _, v := range articles {
+		if err := b.SaveArticle(ctx, v, []string{"test.group"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		headerName string
+		value      string
+		want       []string
+	}{
+		{headerName: "From", value: "alice@example.com", want: []string{"<root@example.com>", "<other@example.com>"}},
+		{headerName: "Subject", value: "Re: Root", want: []string{"<reply@example.com>"}},
+		{headerName: "References", value: "<root@example.com>", want: []string{"<reply@example.com>"}},
+		// names are matched in their canonical form
+		{headerName: "subject", value: "Other", want: []string{"<other@example.com>"}},
+		{headerName: "From", value: "nobody@example.com", want: nil},
+	}
+	for _, tt := range tests {
+		t.Run(tt.headerName+" "+tt.value, func(t *testing.T) {
+			res, err := b.GetArticlesByHeader(ctx, tt.headerName, tt.value)
+			if err != nil {
+				t.Fatalf("GetArticlesByHeader() error = %v", err)
+			}
+			var got []string
+			for _, v := range res {
+				got = append(got, v.Header.Get("Message-Id"))
+			}
+			if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+				t.Errorf("GetArticlesByHeader(%q, %q) = %q, want %q", tt.headerName, tt.value, got, tt.want)
+			}
+		})
+	}
+
+	for _, v := range []string{"", "From') OR 1=1 --", "From.x", "From\"", "From[0]", "Sub ject"} {
+		if _, err := b.GetArticlesByHeader(ctx, v, "alice@example.com"); !errors.Is(err, backend.ErrInvalidHeader) {
+			t.Errorf("GetArticlesByHeader(%q) error = %v, want %v", v, err, backend.ErrInvalidHeader)
+		}
+	}
+}
+
+func TestGetGroupsByModeratedStatus(t *testing.T) {
+	b := newTestBackend(t)
+	ctx := context.Background()
+
+	for _, v := range []struct {
+		name      string
+		moderated bool
+	}{{"test.moderated.b", true}, {"test.open", false}, {"test.moderated.a", true}} {
+		if err := b.CreateGroup(ctx, v.name, "", v.moderated, "y"); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range []struct {
+		moderated bool
+		want      []string
+	}{
+		{moderated: true, want: []string{"test.moderated.a", "test.moderated.b"}},
+		{moderated: false, want: []string{"test.open"}},
+	} {
+		groups, err := b.GetGroupsByModeratedStatus(ctx, tt.moderated)
+		if err != nil {
+			t.Fatalf("GetGroupsByModeratedStatus(%v) error = %v", tt.moderated, err)
+		}
+		var got []string
+		for _, v := range groups {
+			if v.Moderated != tt.moderated {
+				t.Errorf("group %s moderated = %v", v.GroupName, v.Moderated)
+			}
+			got = append(got, v.GroupName)
+		}
+		if strings.Join(got, " ") != strings.Join(tt.want, " ") {
+			t.Errorf("GetGroupsByModeratedStatus(%v) = %q, want %q", tt.moderated, got, tt.want)
+		}
+	}
+}
+
+// saveTestArticles stores n articles with the given body into the group at once
+func saveTestArticles(t testing.TB, b *SQLiteBackend, group string, n int, body string) {
+	t.Helper()
+	articles := make([]models.Article, 0, n)
+	for i := 0; i < n; i++ {
+		articles = append(articles, testArticle(t, body, "Message-Id", fmt.Sprintf("<%d@example.com>", i), "Subject", fmt.Sprintf("article %d", i)))
+	}
+	if err := b.BulkSaveArticles(context.Background(), articles, []string{group}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetArticlesByRange(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group")
+	saveTestArticles(t, b, "test.group", 5, "hello\n")
+	ctx := context.Background()
+	g, err := b.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	articles, err := b.GetArticlesByRange(ctx, &g, 2, 4)
+	if err != nil {
+		t.Fatalf("GetArticlesByRange() error = %v", err)
+	}
+	if len(articles) != 3 {
+		t.Fatalf("GetArticlesByRange() returned %d articles, want 3", len(articles))
+	}
+	for i, v := range articles {
+		if want := i + 2; v.ArticleNumber != want || v.Header.Get("Message-Id") != fmt.Sprintf("<%d@example.com>", want-1) {
+			t.Errorf("article %d = number %d %s", want, v.ArticleNumber, v.Header.Get("Message-Id"))
+		}
+	}
+}
+
+// getArticlesByRangePerNumber is GetArticlesByRange as it was before, with a query for the number of every article
+func getArticlesByRangePerNumber(ctx context.Context, sb *SQLiteBackend, g *models.Group, low, high int64) ([]models.Article, error) {
+	var articles []models.Article
+	if err := sb.conn.SelectContext(ctx, &articles, "SELECT articles.* FROM articles INNER JOIN articles_to_groups atg on atg.article_id = articles.id WHERE atg.article_number >= ? AND atg.article_number <= ? AND atg.group_id = ? ORDER BY atg.article_number", low, high, g.ID); err != nil {
+		return nil, err
+	}
+	for i := 0; i < len(articles); i++ {
+		if err := sb.conn.GetContext(ctx, &articles[i].ArticleNumber, "SELECT article_number FROM articles_to_groups WHERE article_id = ?", articles[i].ID); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal([]byte(articles[i].HeaderRaw), &articles[i].Header); err != nil {
+			return nil, err
+		}
+	}
+	return articles, nil
+}
+
+// BenchmarkGetArticlesByRange compares the single query with the former query per article number
+func BenchmarkGetArticlesByRange(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			sb := newTestBackend(b)
+			createTestGroups(b, sb, "test.group")
+			saveTestArticles(b, sb, "test.group", n, "hello\n")
+			ctx := context.Background()
+			g, err := sb.GetGroup(ctx, "test.group")
+			if err != nil {
+				b.Fatal(err)
+			}
+
+			b.Run("SingleQuery", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := sb.GetArticlesByRange(ctx, &g, 1, int64(n)); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+			b.Run("PerArticleNumber", func(b *testing.B) {
+				for i := 0; i < b.N; i++ {
+					if _, err := getArticlesByRangePerNumber(ctx, sb, &g, 1, int64(n)); err != nil {
+						b.Fatal(err)
+					}
+				}
+			})
+		})
+	}
+}
+
+// articleWithAttachment is cross-posted to test.one and test.two by the atomicity tests
+func articleWithAttachment(t testing.TB, i int) models.Article {
+	a := testArticle(t, "hello\n", "Message-Id", fmt.Sprintf("<%d@example.com>", i))
+	a.Attachments = []models.Attachment{{ContentType: "image/png", FileName: fmt.Sprintf("%d.png", i), Content: []byte("png")}}
+	return a
+}
+
+// checkNoPartialArticles fails if any article is stored without all its groups and attachments, or the other way round
+func checkNoPartialArticles(t *testing.T, b *SQLiteBackend) {
+	t.Helper()
+	var partial int
+	if err := b.conn.GetContext(context.Background(), &partial, `SELECT
+		(SELECT COUNT(*) FROM articles a WHERE (SELECT COUNT(*) FROM articles_to_groups WHERE article_id = a.id) <> 2 OR (SELECT COUNT(*) FROM attachments_articles_mapping WHERE article_id = a.id) <> 1) +
+		(SELECT COUNT(*) FROM articles_to_groups WHERE article_id NOT IN (SELECT id FROM articles)) +
+		(SELECT COUNT(*) FROM attachments_articles_mapping WHERE article_id NOT IN (SELECT id FROM articles)) +
+		(SELECT COUNT(*) FROM attachments WHERE attachment_id NOT IN (SELECT attachment_id FROM attachments_articles_mapping))`); err != nil {
+		t.Fatal(err)
+	}
+	if partial != 0 {
+		t.Errorf("%d partially saved rows found", partial)
+	}
+}
+
+func TestSaveArticleRollsBack(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.one", "test.two")
+	ctx := context.Background()
+
+	// the last insert of the saving fails
+	if _, err := b.conn.ExecContext(ctx, "CREATE TRIGGER fail_attachments BEFORE INSERT ON attachments BEGIN SELECT RAISE(ABORT, 'injected failure'); END"); err != nil {
+		t.Fatal(err)
+	}
+	if err := b.SaveArticle(ctx, articleWithAttachment(t, 1), []string{"test.one", "test.two"}); err == nil || !strings.Contains(err.Error(), "injected failure") {
+		t.Fatalf("SaveArticle() error = %v, want the injected failure", err)
+	}
+
+	var count int
+	if err := b.conn.GetContext(ctx, &count, "SELECT (SELECT COUNT(*) FROM articles) + (SELECT COUNT(*) FROM articles_to_groups) + (SELECT COUNT(*) FROM attachments_articles_mapping)"); err != nil {
+		t.Fatal(err)
+	}
+	if count != 0 {
+		t.Errorf("%d rows are left after the failed saving", count)
+	}
+}
+
+// TestSaveArticleKilled kills the process saving articles in a loop and checks the database has no partially saved ones
+func TestSaveArticleKilled(t *testing.T) {
+	if path := os.Getenv("YANS_TEST_KILLED_DB"); path != "" {
+		b, err := NewSQLiteBackend(config.SQLiteBackendConfig{Path: path})
+		if err != nil {
+			t.Fatal(err)
+		}
+		for i := 0; ; i++ {
+			if err := b.SaveArticle(context.Background(), articleWithAttachment(t, i), []string{"test.one", "test.two"}); err != nil {
+				t.Fatal(err)
+			}
+			if i == 0 {
+				fmt.Println("saving")
+			}
+		}
+	}
+	if testing.Short() {
+		t.Skip("spawns a process")
+	}
+
+	path := filepath.Join(t.TempDir(), "yans.db")
+	b, err := NewSQLiteBackend(config.SQLiteBackendConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	createTestGroups(t, b, "test.one", "test.two")
+	b.Close()
+
+	cmd := exec.Command(os.Args[0], "-test.run=^TestSaveArticleKilled$")
+	cmd.Env = append(os.Environ(), "YANS_TEST_KILLED_DB="+path)
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := cmd.Start(); err != nil {
+		t.Fatal(err)
+	}
+	// wait for the first article to be saved
+	buf := make([]byte, 64)
+	for out := ""; !strings.Contains(out, "saving"); {
+		n, err := stdout.Read(buf)
+		if err != nil {
+			cmd.Process.Kill()
+			cmd.Wait()
+			t.Fatalf("the saving process failed: %v", err)
+		}
+		out += string(buf[:n])
+	}
+	time.Sleep(200 * time.Millisecond)
+	if err := cmd.Process.Kill(); err != nil {
+		t.Fatal(err)
+	}
+	cmd.Wait()
+
+	b, err = NewSQLiteBackend(config.SQLiteBackendConfig{Path: path})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	var count int
+	if err := b.conn.GetContext(context.Background(), &count, "SELECT COUNT(*) FROM articles"); err != nil {
+		t.Fatal(err)
+	}
+	if count == 0 {
+		t.Fatal("no articles were saved before the kill")
+	}
+	checkNoPartialArticles(t, b)
+}
+
+func TestDeleteArticle(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.one", "test.two")
+	ctx := context.Background()
+
+	for i := 1; i <= 3; i++ {
+		if err := b.SaveArticle(ctx, articleWithAttachment(t, i), []string{"test.one", "test.two"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// the lowest article goes first, then the highest one
+	for _, tt := range []struct {
+		messageID           string
+		low, high, articles int
+	}{
+		{"<1@example.com>", 2, 3, 2},
+		{"<3@example.com>", 2, 2, 1},
+	} {
+		if err := b.DeleteArticle(ctx, tt.messageID); err != nil {
+			t.Fatalf("DeleteArticle(%s) error = %v", tt.messageID, err)
+		}
+		if _, err := b.GetArticle(ctx, tt.messageID); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetArticle() of the deleted article error = %v, want sql.ErrNoRows", err)
+		}
+		checkNoPartialArticles(t, b)
+
+		for _, group := range []string{"test.one", "test.two"} {
+			g, err := b.GetGroup(ctx, group)
+			if err != nil {
+				t.Fatal(err)
+			}
+			low, err := b.GetGroupLowWaterMark(ctx, &g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			high, err := b.GetGroupHighWaterMark(ctx, &g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			count, err := b.GetArticlesCount(ctx, &g)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if low != tt.low || high != tt.high || count != tt.articles {
+				t.Errorf("%s after deleting %s: low %d, high %d, %d articles, want %d, %d, %d", group, tt.messageID, low, high, count, tt.low, tt.high, tt.articles)
+			}
+		}
+	}
+	if err := b.DeleteArticle(ctx, "<1@example.com>"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("DeleteArticle() of a missing article error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestGetArticlesByRangeWithHeaders(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group")
+	saveTestArticles(t, b, "test.group", 3, "hello\nworld\n")
+	ctx := context.Background()
+	g, err := b.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	articles, err := b.GetArticlesByRangeWithHeaders(ctx, &g, 2, 3)
+	if err != nil {
+		t.Fatalf("GetArticlesByRangeWithHeaders() error = %v", err)
+	}
+	if len(articles) != 2 {
+		t.Fatalf("GetArticlesByRangeWithHeaders() returned %d articles, want 2", len(articles))
+	}
+	for i, v := range articles {
+		if v.ArticleNumber != i+2 || v.Header.Get("Subject") != fmt.Sprintf("article %d", i+1) {
+			t.Errorf("article %d = number %d %q", i+2, v.ArticleNumber, v.Header.Get("Subject"))
+		}
+		size, err := b.GetArticleByteCount(ctx, int64(v.ID))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if v.Body != "" || v.ByteCount != size || v.LineCount != 2 {
+			t.Errorf("article %d body = %q, size %d, lines %d, want no body, size %d and 2 lines", i+2, v.Body, v.ByteCount, v.LineCount, size)
+		}
+	}
+}
+
+// BenchmarkOverviewRange compares loading the articles for OVER with and without their bodies
+func BenchmarkOverviewRange(b *testing.B) {
+	sb := newTestBackend(b)
+	createTestGroups(b, sb, "test.group")
+	saveTestArticles(b, sb, "test.group", 5000, strings.Repeat(strings.Repeat("x", 99)+"\n", 500))
+	ctx := context.Background()
+	g, err := sb.GetGroup(ctx, "test.group")
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	for _, bm := range []struct {
+		name string
+		get  func(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error)
+	}{
+		{"WithBodies", sb.GetArticlesByRange},
+		{"HeadersOnly", sb.GetArticlesByRangeWithHeaders},
+		{"Overview", func(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error) {
+			_, err := sb.GetOverviewByRange(ctx, g, low, high, nil)
+			return nil, err
+		}},
+	} {
+		b.Run(bm.name, func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := bm.get(ctx, &g, 1, 5000); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+}
+
+func BenchmarkSaveArticles(b *testing.B) {
+	articles := make([]models.Article, 1000)
+	for i := range articles {
+		articles[i] = testArticle(b, "hello\n", "Message-Id", fmt.Sprintf("<%d@example.com>", i), "Subject", fmt.Sprintf("article %d", i))
+	}
+
+	b.Run("Single", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			sb := newTestBackend(b)
+			createTestGroups(b, sb, "test.group")
+			b.StartTimer()
+			for _, v := range articles {
+				if err := sb.SaveArticle(context.Background(), v, []string{"test.group"}); err != nil {
+					b.Fatal(err)
+				}
+			}
+			b.StopTimer()
+			sb.Close()
+		}
+	})
+	b.Run("Bulk", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			b.StopTimer()
+			sb := newTestBackend(b)
+			createTestGroups(b, sb, "test.group")
+			b.StartTimer()
+			if err := sb.BulkSaveArticles(context.Background(), articles, []string{"test.group"}); err != nil {
+				b.Fatal(err)
+			}
+			b.StopTimer()
+			sb.Close()
+		}
+	})
+}
+
+// BenchmarkIndexes runs the number and date lookups with and without the indexes of the 013 migration
+func BenchmarkIndexes(b *testing.B) {
+	sb := newTestBackend(b)
+	ctx := context.Background()
+	for i := 0; i < 10; i++ {
+		group := fmt.Sprintf("test.group%d", i)
+		createTestGroups(b, sb, group)
+		articles := make([]models.Article, 1000)
+		for j := range articles {
+			articles[j] = testArticle(b, "hello\n", "Message-Id", fmt.Sprintf("<%d.%d@example.com>", i, j))
+		}
+		if err := sb.BulkSaveArticles(ctx, articles, []string{group}); err != nil {
+			b.Fatal(err)
+		}
+	}
+	// one article a minute
+	if _, err := sb.conn.ExecContext(ctx, "UPDATE articles SET created_at = datetime('now', '-' || id || ' minutes')"); err != nil {
+		b.Fatal(err)
+	}
+	g, err := sb.GetGroup(ctx, "test.group5")
+	if err != nil {
+		b.Fatal(err)
+	}
+	since := time.Now().Add(-time.Hour).Unix()
+
+	run := func(b *testing.B) {
+		b.Run("ArticleByNumber", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := sb.GetArticleByNumber(ctx, &g, 500); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+		b.Run("NewArticlesSince", func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				if _, err := sb.GetNewArticlesSince(ctx, since, nil); err != nil {
+					b.Fatal(err)
+				}
+			}
+		})
+	}
+	b.Run("Indexed", run)
+	if _, err := sb.conn.ExecContext(ctx, "DROP INDEX idx_atg_group_num; DROP INDEX idx_articles_created"); err != nil {
+		b.Fatal(err)
+	}
+	b.Run("Unindexed", run)
+}
+
+func TestGetTopPosters(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group", "test.other")
+	ctx := context.Background()
+
+	posts := []struct {
+		from  string
+		group string
+	}{
+		{"Alice <alice@example.com>", "test.group"},
+		{"Alice <alice@example.com>", "test.group"},
+		{"Alice <alice@example.com>", "test.group"},
+		{"bob@example.com", "test.group"},
+		{"bob@example.com", "test.group"},
+		{"not an address", "test.group"},
+		{"Carol <carol@example.com>", "test.other"},
+		{"Carol <carol@example.com>", "test.other"},
+		{"Carol <carol@example.com>", "test.other"},
+		{"Carol <carol@example.com>", "test.other"},
+	}
+	for i, v := range posts {
+		if err := b.SaveArticle(ctx, testArticle(t, "hello\n", "Message-Id", fmt.Sprintf("<%d@example.com>", i), "From", v.from), []string{v.group}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g, err := b.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	posters, err := b.GetTopPosters(ctx, &g, 10)
+	if err != nil {
+		t.Fatalf("GetTopPosters() error = %v", err)
+	}
+	want := []models.PosterStats{
+		{Email: "alice@example.com", DisplayName: "Alice", ArticleCount: 3},
+		{Email: "bob@example.com", ArticleCount: 2},
+		{Email: "not an address", ArticleCount: 1},
+	}
+	if fmt.Sprint(posters) != fmt.Sprint(want) {
+		t.Errorf("GetTopPosters() = %+v, want %+v", posters, want)
+	}
+
+	if posters, err := b.GetTopPosters(ctx, &g, 1); err != nil || len(posters) != 1 || posters[0].Email != "alice@example.com" {
+		t.Errorf("GetTopPosters() limited to 1 = %+v, %v", posters, err)
+	}
+}
+
+func TestGetArticlesBySubject(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group")
+	ctx := context.Background()
+
+	for i, v := range []string{"Go generics", "Re: Go generics", "RE: Re: Go generics", "Go generics in 1.18", "Rust 100%_safe"} {
+		if err := b.SaveArticle(ctx, testArticle(t, "hello\n", "Message-Id", fmt.Sprintf("<%d@example.com>", i), "Subject", v), []string{"test.group"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	g, err := b.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		subject string
+		fuzzy   bool
+		want    []int
+	}{
+		{subject: "Re: Go generics", fuzzy: true, want: []int{1, 2, 3, 4}},
+		{subject: "Go generics", fuzzy: false, want: []int{1, 2, 3}},
+		{subject: "Re: Re: Go generics in 1.18", fuzzy: false, want: []int{4}},
+		// LIKE wildcards are matched literally
+		{subject: "100%_safe", fuzzy: true, want: []int{5}},
+		{subject: "100%", fuzzy: false, want: nil},
+	}
+	for _, tt := range tests {
+		articles, err := b.GetArticlesBySubject(ctx, &g, tt.subject, tt.fuzzy)
+		if err != nil {
+			t.Fatalf("GetArticlesBySubject() error = %v", err)
+		}
+		var got []int
+		for _, v := range articles {
+			got = append(got, v.ArticleNumber)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("GetArticlesBySubject(%q, %v) = %v, want %v", tt.subject, tt.fuzzy, got, tt.want)
+		}
+	}
+}
+
+func TestGetArticleNumbers(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group")
+	saveTestArticles(t, b, "test.group", 6, "hello\n")
+	ctx := context.Background()
+	g, err := b.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		low, high int64
+		want      []int64
+	}{
+		// ranges include both boundaries (RFC 3977 §6.1.2)
+		{low: 1, high: 5, want: []int64{1, 2, 3, 4, 5}},
+		{low: 2, high: 2, want: []int64{2}},
+		{low: 5, high: 10, want: []int64{5, 6}},
+		{low: 4, high: -1, want: []int64{4, 5, 6}},
+		{low: -1, high: 3, want: []int64{3}},
+		{low: 0, high: 0, want: []int64{1, 2, 3, 4, 5, 6}},
+		{low: 7, high: 9, want: nil},
+	}
+	for _, tt := range tests {
+		got, err := b.GetArticleNumbers(ctx, &g, tt.low, tt.high)
+		if err != nil {
+			t.Fatalf("GetArticleNumbers(%d, %d) error = %v", tt.low, tt.high, err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("GetArticleNumbers(%d, %d) = %v, want %v", tt.low, tt.high, got, tt.want)
+		}
+	}
+}
+
+// setCreatedAt backdates the article, createdAt is in the "YYYY-MM-DD HH:MM:SS" form of SQLite
+func setCreatedAt(t *testing.T, b *SQLiteBackend, messageID, createdAt string) {
+	t.Helper()
+	if _, err := b.conn.ExecContext(context.Background(), "UPDATE articles SET created_at = ? WHERE json_extract(header, '$.Message-Id[0]') = ?", createdAt, messageID); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestGetArticlesPerDay(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group", "test.other")
+	ctx := context.Background()
+
+	posts := []struct {
+		createdAt string
+		group     string
+	}{
+		{"2026-01-01 10:00:00", "test.group"},
+		{"2026-01-01 12:00:00", "test.group"},
+		{"2026-01-01 12:00:00", "test.other"},
+		{"2026-01-02 23:59:59", "test.group"},
+		{"2026-01-04 00:00:00", "test.group"},
+		{"2026-01-05 00:00:00", "test.group"}, // the end of the range is exclusive
+		{"2025-12-31 23:59:59", "test.group"},
+	}
+	for i, v := range posts {
+		messageID := fmt.Sprintf("<%d@example.com>", i)
+		if err := b.SaveArticle(ctx, testArticle(t, "hello\n", "Message-Id", messageID), []string{v.group}); err != nil {
+			t.Fatal(err)
+		}
+		setCreatedAt(t, b, messageID, v.createdAt)
+	}
+	g, err := b.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 1, 5, 0, 0, 0, 0, time.UTC)
+
+	if count, err := b.GetArticlesCountByDateRange(ctx, &g, from, to); err != nil || count != 4 {
+		t.Errorf("GetArticlesCountByDateRange() = %d, %v, want 4", count, err)
+	}
+
+	counts, err := b.GetArticlesPerDay(ctx, &g, from, to)
+	if err != nil {
+		t.Fatalf("GetArticlesPerDay() error = %v", err)
+	}
+	want := []models.DailyCount{
+		{Date: time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC), Count: 2},
+		{Date: time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), Count: 1},
+		{Date: time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC), Count: 1},
+	}
+	if len(counts) != len(want) {
+		t.Fatalf("GetArticlesPerDay() = %+v, want %+v", counts, want)
+	}
+	for i := range want {
+		if !counts[i].Date.Equal(want[i].Date) || counts[i].Count != want[i].Count {
+			t.Errorf("GetArticlesPerDay()[%d] = %+v, want %+v", i, counts[i], want[i])
+		}
+	}
+}
+
+func TestGetArticlesByDateRange(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group")
+	ctx := context.Background()
+
+	for i, v := range []string{"2026-01-01 23:59:59", "2026-01-02 00:00:00", "2026-01-03 12:00:00", "2026-01-04 00:00:00", "2026-01-04 00:00:01"} {
+		messageID := fmt.Sprintf("<%d@example.com>", i)
+		if err := b.SaveArticle(ctx, testArticle(t, "hello\n", "Message-Id", messageID), []string{"test.group"}); err != nil {
+			t.Fatal(err)
+		}
+		setCreatedAt(t, b, messageID, v)
+	}
+	g, err := b.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the articles posted exactly at from and to are included
+	articles, err := b.GetArticlesByDateRange(ctx, &g, time.Date(2026, 1, 2, 0, 0, 0, 0, time.UTC), time.Date(2026, 1, 4, 0, 0, 0, 0, time.UTC))
+	if err != nil {
+		t.Fatalf("GetArticlesByDateRange() error = %v", err)
+	}
+	var got []string
+	for _, v := range articles {
+		got = append(got, v.Header.Get("Message-Id"))
+	}
+	if want := []string{"<1@example.com>", "<2@example.com>", "<3@example.com>"}; fmt.Sprint(got) != fmt.Sprint(want) {
+		t.Errorf("GetArticlesByDateRange() = %v, want %v", got, want)
+	}
+}
+
+func TestGetLastNArticles(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group")
+	saveTestArticles(t, b, "test.group", 3, "hello\n")
+	ctx := context.Background()
+	g, err := b.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		n    int
+		want []int
+	}{
+		{n: 2, want: []int{2, 3}},
+		{n: 3, want: []int{1, 2, 3}},
+		// fewer articles than requested
+		{n: 5, want: []int{1, 2, 3}},
+	}
+	for _, tt := range tests {
+		articles, err := b.GetLastNArticles(ctx, &g, tt.n)
+		if err != nil {
+			t.Fatalf("GetLastNArticles(%d) error = %v", tt.n, err)
+		}
+		var got []int
+		for _, v := range articles {
+			got = append(got, v.ArticleNumber)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) {
+			t.Errorf("GetLastNArticles(%d) = %v, want %v", tt.n, got, tt.want)
+		}
+	}
+}
+
+func TestGetArticlesForPeer(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group")
+	saveTestArticles(t, b, "test.group", 5, "hello\n")
+	ctx := context.Background()
+
+	batch := func(peerID string, want ...int64) []int64 {
+		t.Helper()
+		articles, err := b.GetArticlesForPeer(ctx, peerID, 3)
+		if err != nil {
+			t.Fatalf("GetArticlesForPeer() error = %v", err)
+		}
+		var got []int64
+		for _, v := range articles {
+			got = append(got, int64(v.ID))
+		}
+		if fmt.Sprint(got) != fmt.Sprint(want) {
+			t.Fatalf("GetArticlesForPeer(%q) = %v, want %v", peerID, got, want)
+		}
+		return got
+	}
+	mark := func(peerID string, ids ...int64) {
+		t.Helper()
+		if err := b.MarkArticlesSentToPeer(ctx, peerID, ids); err != nil {
+			t.Fatalf("MarkArticlesSentToPeer() error = %v", err)
+		}
+	}
+
+	batch("peer", 1, 2, 3)
+	// the second article has failed, it's sent again in the next batch
+	mark("peer", 1, 3)
+	batch("peer", 2, 4, 5)
+	// nothing is sent in this round
+	batch("peer", 2, 4, 5)
+	mark("peer", 2, 4, 5)
+	batch("peer")
+
+	// the rows of the sent articles are pruned once the sync state moves past them
+	var rows int
+	if err := b.conn.GetContext(ctx, &rows, "SELECT COUNT(*) FROM peer_article_state WHERE peer_id = 'peer'"); err != nil {
+		t.Fatal(err)
+	}
+	if rows != 0 {
+		t.Errorf("%d sent article rows are left", rows)
+	}
+
+	// peers are fed independently
+	batch("other", 1, 2, 3)
+}
+
+// saveSpoolTestArticles stores the articles in test.one and test.two, their sizes are returned by the message-ids
+func saveSpoolTestArticles(t *testing.T, b *SQLiteBackend) map[string]int64 {
+	t.Helper()
+	createTestGroups(t, b, "test.one", "test.two", "test.empty")
+	posts := []struct {
+		body   string
+		groups []string
+	}{
+		{"abc", []string{"test.one"}},
+		{"héllo\n", []string{"test.one", "test.two"}}, // multibyte and cross-posted
+		{"12345", []string{"test.two"}},
+	}
+	sizes := map[string]int64{}
+	for i, v := range posts {
+		messageID := fmt.Sprintf("<%d@example.com>", i)
+		if err := b.SaveArticle(context.Background(), testArticle(t, v.body, "Message-Id", messageID), v.groups); err != nil {
+			t.Fatal(err)
+		}
+		a, err := b.GetArticle(context.Background(), messageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[messageID] = int64(a.ByteCount)
+	}
+	return sizes
+}
+
+func TestGetSpoolSize(t *testing.T) {
+	b := newTestBackend(t)
+	ctx := context.Background()
+	if size, err := b.GetSpoolSize(ctx); err != nil || size != 0 {
+		t.Errorf("GetSpoolSize() of the empty spool = %d, %v, want 0", size, err)
+	}
+	sizes := saveSpoolTestArticles(t, b)
+
+	// the cross-posted article is counted once in the total
+	if size, err := b.GetSpoolSize(ctx); err != nil || size != sizes["<0@example.com>"]+sizes["<1@example.com>"]+sizes["<2@example.com>"] {
+		t.Errorf("GetSpoolSize() = %d, %v, want the sum of %v", size, err, sizes)
+	}
+	for name, want := range map[string]int64{
+		"test.one":   sizes["<0@example.com>"] + sizes["<1@example.com>"],
+		"test.two":   sizes["<1@example.com>"] + sizes["<2@example.com>"],
+		"test.empty": 0,
+	} {
+		g, err := b.GetGroup(ctx, name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if size, err := b.GetSpoolSizeForGroup(ctx, &g); err != nil || size != want {
+			t.Errorf("GetSpoolSizeForGroup(%s) = %d, %v, want %d", name, size, err, want)
+		}
+	}
+}
+
+func TestGetArticleReferences(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.group")
+	ctx := context.Background()
+
+	tests := []struct {
+		messageID  string
+		references []string // the header is omitted if empty
+		want       []string
+	}{
+		{messageID: "<none@example.com>", want: nil},
+		{messageID: "<one@example.com>", references: []string{"<none@example.com>"}, want: []string{"<none@example.com>"}},
+		{
+			messageID: "<many@example.com>",
+			// folded the way long References headers are
+			references: []string{"<none@example.com> <one@example.com>\r\n\t<two@example.com>  <three@example.com>"},
+			want:       []string{"<none@example.com>", "<one@example.com>", "<two@example.com>", "<three@example.com>"},
+		},
+	}
+	for _, tt := range tests {
+		fields := []string{"Message-Id", tt.messageID}
+		for _, v := range tt.references {
+			fields = append(fields, "References", v)
+		}
+		if err := b.SaveArticle(ctx, testArticle(t, "hello\n", fields...), []string{"test.group"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, tt := range tests {
+		got, err := b.GetArticleReferences(ctx, tt.messageID)
+		if err != nil {
+			t.Fatalf("GetArticleReferences(%s) error = %v", tt.messageID, err)
+		}
+		if fmt.Sprint(got) != fmt.Sprint(tt.want) || len(got) != len(tt.want) {
+			t.Errorf("GetArticleReferences(%s) = %q, want %q", tt.messageID, got, tt.want)
+		}
+	}
+	if _, err := b.GetArticleReferences(ctx, "<missing@example.com>"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetArticleReferences() of a missing article error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestHeldArticleLookups(t *testing.T) {
+	b := newTestBackend(t)
+	ctx := context.Background()
+	if err := b.CreateGroup(ctx, "test.moderated", "", true, "m"); err != nil {
+		t.Fatal(err)
+	}
+	createTestGroups(t, b, "test.open")
+
+	const held = "<held@example.com>"
+	if err := b.SaveArticle(ctx, testArticle(t, "held\n", "Message-Id", held), []string{"test.moderated"}); err != nil {
+		t.Fatal(err)
+	}
+	// cross-posted to an unmoderated group, it's shown there without the approval
+	if err := b.SaveArticle(ctx, testArticle(t, "open\n", "Message-Id", "<open@example.com>"), []string{"test.moderated", "test.open"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := b.GetArticle(ctx, held); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetArticle() error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := b.GetArticleHeaders(ctx, held); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetArticleHeaders() error = %v, want sql.ErrNoRows", err)
+	}
+	if _, err := b.GetArticleBodyOnly(ctx, held); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetArticleBodyOnly() error = %v, want sql.ErrNoRows", err)
+	}
+	if _, ok, err := b.ArticleExists(ctx, nil, held); err != nil || ok {
+		t.Errorf("ArticleExists() = %v, %v, want false", ok, err)
+	}
+	if exists, err := b.HasArticle(ctx, held); err != nil || !exists {
+		t.Errorf("HasArticle() = %v, %v, want true", exists, err)
+	}
+
+	peerBatch := func() []string {
+		t.Helper()
+		articles, err := b.GetArticlesForPeer(ctx, "peer", 10)
+		if err != nil {
+			t.Fatalf("GetArticlesForPeer() error = %v", err)
+		}
+		var ids []string
+		for _, v := range articles {
+			ids = append(ids, v.Header["Message-Id"][0])
+		}
+		return ids
+	}
+	if got := peerBatch(); fmt.Sprint(got) != "[<open@example.com>]" {
+		t.Errorf("peer batch = %q, want only the unmoderated article", got)
+	}
+	// the approved article is fed with the next batch
+	if err := b.ModerateArticle(ctx, held, true, "moderator"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := b.GetArticle(ctx, held); err != nil {
+		t.Errorf("GetArticle() of the approved article error = %v", err)
+	}
+	if got := peerBatch(); fmt.Sprint(got) != "[<held@example.com> <open@example.com>]" {
+		t.Errorf("peer batch = %q after the approval", got)
+	}
+}
+
+func TestRunExpiration(t *testing.T) {
+	b := newTestBackend(t)
+	createTestGroups(t, b, "test.short", "test.forever")
+	ctx := context.Background()
+	if _, err := b.conn.ExecContext(ctx, "UPDATE groups SET retention_days = 1 WHERE group_name = 'test.short'"); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().UTC().AddDate(0, 0, -2).Format("2006-01-02 15:04:05")
+	for _, v := range []struct {
+		messageID string
+		groups    []string
+		old       bool
+	}{
+		{"<old@example.com>", []string{"test.short"}, true},
+		{"<new@example.com>", []string{"test.short"}, false},
+		{"<kept@example.com>", []string{"test.forever"}, true},
+		{"<cross@example.com>", []string{"test.short", "test.forever"}, true},
+	} {
+		if err := b.SaveArticle(ctx, testArticle(t, "hello\n", "Message-Id", v.messageID), v.groups); err != nil {
+			t.Fatal(err)
+		}
+		if v.old {
+			setCreatedAt(t, b, v.messageID, old)
+		}
+	}
+
+	// the cross-posted article is left in the group without retention
+	if deleted, err := b.RunExpiration(ctx); err != nil || deleted != 1 {
+		t.Fatalf("RunExpiration() = %d, %v, want 1", deleted, err)
+	}
+	if _, err := b.GetArticle(ctx, "<old@example.com>"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetArticle() of the expired article error = %v, want sql.ErrNoRows", err)
+	}
+	for _, v := range []struct{ group, want string }{
+		{"test.short", "[<new@example.com>]"},
+		{"test.forever", "[<kept@example.com> <cross@example.com>]"},
+	} {
+		g, err := b.GetGroup(ctx, v.group)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, err := b.ListArticleIDs(ctx, &g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(ids) != v.want {
+			t.Errorf("articles of %s = %q, want %s", v.group, ids, v.want)
+		}
+	}
+	if orphaned, err := b.GetOrphanedArticles(ctx); err != nil || len(orphaned) != 0 {
+		t.Errorf("GetOrphanedArticles() = %d articles, %v", len(orphaned), err)
+	}
+
+	if deleted, err := b.RunExpiration(ctx); err != nil || deleted != 0 {
+		t.Errorf("second RunExpiration() = %d, %v, want 0", deleted, err)
+	}
+}
@@ -0,0 +1,79 @@
+//go:build sqlite_fts5
+
+package sqlite
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/utils"
+)
+
+// FuzzWildmatToSQL checks the SQL made by WildmatToSQL matches the same names as the regex of CompileWildmat
+func FuzzWildmatToSQL(f *testing.F) {
+	seeds := []struct{ wildmat, name string }{
+		{"comp.*", "comp.lang.go"},
+		{"Comp.*", "comp.lang.go"},
+		{"comp.*", "xcomp.lang"},
+		{"Comp.*,!x", "comp.lang.go"},
+		{"*,!comp.*", "comp.lang.go"},
+		{"*,!comp.*,comp.lang.*", "comp.lang.go"},
+		{"!comp.*", "alt.test"},
+		{"a?c", "abc"},
+		{"a?c", "ac"},
+		{"a[b]c", "a[b]c"},
+		{"100%", "100x"},
+		{"a_b", "axb"},
+		{`a\b`, `a\b`},
+		{"a.b", "axb"},
+		{"", ""},
+		{"*", "any.group"},
+		{"a*b*c", "a.x.b.y.c"},
+	}
+	for _, v := range seeds {
+		f.Add(v.wildmat, v.name)
+	}
+
+	b := newFuzzBackend(f)
+	ctx := context.Background()
+	f.Fuzz(func(t *testing.T, wildmat, name string) {
+		// the database doesn't keep NUL characters in text and invalid UTF-8 is matched byte-wise
+		if !utf8.ValidString(wildmat) || !utf8.ValidString(name) || strings.ContainsRune(wildmat+name, 0) {
+			t.Skip()
+		}
+
+		r, err := utils.CompileWildmat(wildmat)
+		if err != nil {
+			t.Fatalf("CompileWildmat(%q) error = %v", wildmat, err)
+		}
+		want, err := r.MatchString(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		cond, args, err := utils.WildmatToSQL(wildmat)
+		if err != nil {
+			t.Fatalf("WildmatToSQL(%q) error = %v", wildmat, err)
+		}
+		var got bool
+		if err := b.conn.GetContext(ctx, &got, "SELECT EXISTS (SELECT 1 FROM (SELECT ? AS group_name) WHERE "+cond+")", append([]interface{}{name}, args...)...); err != nil {
+			t.Fatalf("query of %q error = %v", cond, err)
+		}
+		if got != want {
+			t.Errorf("wildmat %q on %q: SQL %q matched = %v, regex %q matched = %v", wildmat, name, cond, got, r.String(), want)
+		}
+	})
+}
+
+func newFuzzBackend(f *testing.F) *SQLiteBackend {
+	f.Helper()
+	b, err := NewSQLiteBackend(config.SQLiteBackendConfig{Path: "file:fuzz_wildmat?mode=memory&cache=shared"})
+	if err != nil {
+		f.Fatal(err)
+	}
+	f.Cleanup(func() { b.Close() })
+	return b
+}
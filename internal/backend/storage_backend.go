@@ -1,27 +1,247 @@
 package backend
 
-import "github.com/ChronosX88/yans/internal/models"
+import (
+	"context"
+	"errors"
+	"github.com/ChronosX88/yans/internal/models"
+	"net/mail"
+	"time"
+)
 
 const (
-	SupportedBackendList = "sqlite"
+	SupportedBackendList = "sqlite, postgres"
+)
+
+var (
+	ErrNotSupported     = errors.New("operation is not supported by this backend")
+	ErrArticleExists    = errors.New("article with this message-id already exists")
+	ErrInvalidHeader    = errors.New("invalid header name")
+	ErrNotInGroup       = errors.New("article isn't in the group")
+	ErrInvalidSortField = errors.New("invalid sort field")
+	ErrAlreadyInGroup   = errors.New("article is already in the group")
+	ErrInvalidStatus    = errors.New("invalid posting status")
+	ErrNoNewArticles    = errors.New("no new articles")
 )
 
+// IsValidPostingStatus checks the group posting status flag, empty status means the default one
+func IsValidPostingStatus(status string) bool {
+	switch status {
+	case "", models.PostingAllowed, models.PostingNotAllowed, models.PostingModerated:
+		return true
+	}
+	return false
+}
+
+// DefaultPostingStatus returns the status, or the one matching the moderated flag if it's empty
+func DefaultPostingStatus(moderated bool, status string) string {
+	if status != "" {
+		return status
+	}
+	if moderated {
+		return models.PostingModerated
+	}
+	return models.PostingAllowed
+}
+
+// NewPosterStats splits the From header into the address and display name,
+// malformed headers are kept as is in place of the address
+func NewPosterStats(from string, count int) models.PosterStats {
+	ps := models.PosterStats{Email: from, ArticleCount: count}
+	if addr, err := mail.ParseAddress(from); err == nil {
+		ps.Email = addr.Address
+		ps.DisplayName = addr.Name
+	}
+	return ps
+}
+
 type StorageBackend interface {
-	ListGroups() ([]models.Group, error)
-	ListGroupsByPattern(pattern string) ([]models.Group, error)
-	GetGroup(groupName string) (models.Group, error)
-	GetNewGroupsSince(timestamp int64) ([]models.Group, error)
-	GetArticlesCount(g *models.Group) (int, error)
-	GetGroupLowWaterMark(g *models.Group) (int, error)
-	GetGroupHighWaterMark(g *models.Group) (int, error)
-	SaveArticle(article models.Article, groups []string) error
-	GetArticle(messageID string) (models.Article, error)
-	GetArticleByNumber(g *models.Group, num int) (models.Article, error)
-	GetArticleNumbers(g *models.Group, low, high int64) ([]int64, error)
-	GetNewArticlesSince(timestamp int64) ([]string, error)
-	GetLastArticleByNum(g *models.Group, a *models.Article) (models.Article, error)
-	GetNextArticleByNum(g *models.Group, a *models.Article) (models.Article, error)
-	GetArticlesByRange(g *models.Group, low, high int64) ([]models.Article, error)
-	GetNewThreads(g *models.Group, perPage int, pageNum int) ([]int, error)
-	GetThread(g *models.Group, threadNum int) ([]int, error)
+	UserBackend
+
+	Close() error
+	// BeginTx starts the transaction for running several backend calls atomically
+	BeginTx(ctx context.Context) (BackendTx, error)
+
+	ListGroups(ctx context.Context) ([]models.Group, error)
+	// GetGroupsSortedBy sorts the groups by group_name, created_at or article_count
+	GetGroupsSortedBy(ctx context.Context, field string, asc bool) ([]models.Group, error)
+	ListGroupsByPattern(ctx context.Context, pattern string) ([]models.Group, error)
+	GetGroupsByModeratedStatus(ctx context.Context, moderated bool) ([]models.Group, error)
+	// GetGroupCountsByHierarchy counts the groups by the first component of their names, e.g. comp for comp.lang.go
+	GetGroupCountsByHierarchy(ctx context.Context) (map[string]int, error)
+	// GetGroupMeta and SetGroupMeta keep arbitrary key-value settings of the group, e.g. for extensions,
+	// sql.ErrNoRows is returned if there is no such group
+	GetGroupMeta(ctx context.Context, groupName string) (map[string]string, error)
+	SetGroupMeta(ctx context.Context, groupName, key, value string) error
+	ListGroupsWithStats(ctx context.Context) ([]models.GroupStats, error)
+	GetGroup(ctx context.Context, groupName string) (models.Group, error)
+	GetGroupByID(ctx context.Context, id int) (models.Group, error)
+	GetNewGroupsSince(ctx context.Context, timestamp int64) ([]models.Group, error)
+	GetNewGroupsWithStatsSince(ctx context.Context, timestamp int64) ([]models.GroupStats, error)
+	CreateGroup(ctx context.Context, name, description string, moderated bool, postingStatus string) error
+	DeleteGroup(ctx context.Context, name string) error
+	GetGroupDescription(ctx context.Context, groupName string) (string, error)
+	UpdateGroupDescription(ctx context.Context, name, description string) error
+	GetGroupModeratorEmail(ctx context.Context, groupName string) (string, error)
+	UpdateGroupModeratorEmail(ctx context.Context, name, email string) error
+	// UpdateGroupPosting changes the posting status flag, ErrInvalidStatus is returned for unknown flags
+	UpdateGroupPosting(ctx context.Context, name string, status byte) error
+	RenameGroup(ctx context.Context, oldName, newName string) error
+	// ReindexGroup renumbers the group articles from 1 to close the gaps left by deletions.
+	// WARNING: it's destructive, article numbers known to clients and newsreaders become invalid,
+	// so it should only be run during maintenance windows.
+	ReindexGroup(ctx context.Context, g *models.Group) error
+	GetArticlesCount(ctx context.Context, g *models.Group) (int, error)
+	GetArticlesCountInRange(ctx context.Context, g *models.Group, low, high int64) (int, error)
+	// GetArticlesCountByDateRange counts the group articles posted in [from, to)
+	GetArticlesCountByDateRange(ctx context.Context, g *models.Group, from, to time.Time) (int, error)
+	// GetArticlesPerDay counts the group articles posted in [from, to) by UTC days, days without articles are omitted
+	GetArticlesPerDay(ctx context.Context, g *models.Group, from, to time.Time) ([]models.DailyCount, error)
+	GetGroupLowWaterMark(ctx context.Context, g *models.Group) (int, error)
+	GetGroupHighWaterMark(ctx context.Context, g *models.Group) (int, error)
+	// GetLowestArticleNumber and GetHighestArticleNumber return 0 if the group has no articles,
+	// the water mark methods above are the same
+	GetLowestArticleNumber(ctx context.Context, g *models.Group) (int64, error)
+	GetHighestArticleNumber(ctx context.Context, g *models.Group) (int64, error)
+	// GetGroupLastPostTime returns the time of the latest article of the group, or the zero time if it's empty, the result may be up to a minute old
+	GetGroupLastPostTime(ctx context.Context, groupName string) (time.Time, error)
+	SaveArticle(ctx context.Context, article models.Article, groups []string) error
+	BulkSaveArticles(ctx context.Context, articles []models.Article, groups []string) error
+	DeleteArticle(ctx context.Context, messageID string) error
+	// DuplicateArticleToGroup cross-posts the existing article, sql.ErrNoRows is returned if there's no such article or group
+	DuplicateArticleToGroup(ctx context.Context, messageID, targetGroup string) error
+	// ModerateArticle approves or rejects the article, unapproved articles are hidden in moderated groups
+	ModerateArticle(ctx context.Context, messageID string, approved bool, approvedBy string) error
+	// UpdateArticleHeader merges the fields into the stored header of the article, replacing the existing values.
+	// ErrInvalidHeader is returned for malformed field names and sql.ErrNoRows if there is no such article.
+	UpdateArticleHeader(ctx context.Context, messageID string, header map[string][]string) error
+	// GetArticle and the other message-id lookups skip the articles held for moderation
+	GetArticle(ctx context.Context, messageID string) (models.Article, error)
+	GetArticleInGroup(ctx context.Context, g *models.Group, messageID string) (models.Article, error)
+	// GetArticleReferences returns the message-ids from the References header of the article without fetching it,
+	// sql.ErrNoRows is returned if there is no such article
+	GetArticleReferences(ctx context.Context, messageID string) ([]string, error)
+	GetArticleByNumber(ctx context.Context, g *models.Group, num int) (models.Article, error)
+	GetLatestArticle(ctx context.Context, g *models.Group) (models.Article, error)
+	// GetArticleGroups returns the groups the article is shown in, held articles aren't shown in the moderated ones
+	GetArticleGroups(ctx context.Context, messageID string) ([]models.Group, error)
+	// HasArticle reports whether the message-id is stored, held articles included, to refuse duplicates
+	HasArticle(ctx context.Context, messageID string) (bool, error)
+	// ArticleExists returns the article number in the group, zero if the article is only in other groups or g is nil
+	ArticleExists(ctx context.Context, g *models.Group, messageID string) (int, bool, error)
+	// GetArticleNumberForMessageID returns sql.ErrNoRows if there's no such article and ErrNotInGroup if it's only in other groups
+	GetArticleNumberForMessageID(ctx context.Context, g *models.Group, messageID string) (int, error)
+	GetArticleHeaders(ctx context.Context, messageID string) (models.Article, error)
+	GetArticleHeadersByNumber(ctx context.Context, g *models.Group, num int) (models.Article, error)
+	// GetArticleLineCount returns the number of the body lines, computed by the database
+	GetArticleLineCount(ctx context.Context, articleID int64) (int, error)
+	// GetArticleByteCount returns the size of the article as sent by ARTICLE, precomputed by the database
+	GetArticleByteCount(ctx context.Context, articleID int64) (int, error)
+	// GetSpoolSize returns the total of the stored article sizes in bytes, GetSpoolSizeForGroup counts only the group articles
+	GetSpoolSize(ctx context.Context) (int64, error)
+	GetSpoolSizeForGroup(ctx context.Context, g *models.Group) (int64, error)
+	GetArticleBodyOnly(ctx context.Context, messageID string) ([]byte, error)
+	GetArticleBodyOnlyByNumber(ctx context.Context, g *models.Group, num int) ([]byte, error)
+	// GetArticlesByHeader returns articles whose first value of the header equals value, ErrInvalidHeader is returned for malformed names
+	GetArticlesByHeader(ctx context.Context, headerName, value string) ([]models.Article, error)
+	// GetArticlesByFromAddress returns the articles whose From header has the address, display names and case are ignored
+	GetArticlesByFromAddress(ctx context.Context, email string) ([]models.Article, error)
+	// GetDistinctFromAddresses returns the sorted unique normalized addresses of the group posters
+	GetDistinctFromAddresses(ctx context.Context, g *models.Group) ([]string, error)
+	// GetDistinctFromAddressesAll is GetDistinctFromAddresses over all the groups
+	GetDistinctFromAddressesAll(ctx context.Context) ([]string, error)
+	GetArticleNumbers(ctx context.Context, g *models.Group, low, high int64) ([]int64, error)
+	// ListArticleIDs returns message-ids of the group articles ordered by number, without fetching the articles
+	ListArticleIDs(ctx context.Context, g *models.Group) ([]string, error)
+	GetNewArticlesSince(ctx context.Context, timestamp int64, groups []string) ([]string, error)
+	GetNewArticlesFullSince(ctx context.Context, timestamp int64, groups []string) ([]models.Article, error)
+	GetLastArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error)
+	GetNextArticleByNum(ctx context.Context, g *models.Group, a *models.Article) (models.Article, error)
+	GetArticlesByRange(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error)
+	// GetArticlesSinceLastRead returns the group articles numbered above lastReadNum,
+	// ErrNoNewArticles is returned if there are none
+	GetArticlesSinceLastRead(ctx context.Context, g *models.Group, lastReadNum int64) ([]models.Article, error)
+	// GetLastNArticles returns n articles with the highest numbers in ascending order
+	GetLastNArticles(ctx context.Context, g *models.Group, n int) ([]models.Article, error)
+	GetArticlesSince(ctx context.Context, g *models.Group, since time.Time) ([]models.Article, error)
+	// GetArticlesByDateRange returns the group articles posted in [from, to], ordered by number
+	GetArticlesByDateRange(ctx context.Context, g *models.Group, from, to time.Time) ([]models.Article, error)
+	// GetRecentArticlesAcrossGroups returns n most recent articles of all the groups, newest first,
+	// cross-posted articles are returned once per group
+	GetRecentArticlesAcrossGroups(ctx context.Context, n int) ([]models.ArticleWithGroup, error)
+	// GetArticlesSortedByScore returns the group articles in the range rated by ReplyCountScore, the highest first
+	GetArticlesSortedByScore(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error)
+	GetArticlesWithAttachments(ctx context.Context, g *models.Group) ([]models.Article, error)
+	GetAttachmentContent(ctx context.Context, articleID int64, attachmentID string) ([]byte, string, error)
+	// GetUnreadArticles returns the group articles whose numbers aren't in readNumbers
+	GetUnreadArticles(ctx context.Context, g *models.Group, readNumbers []int64) ([]models.Article, error)
+	// GetArticlesByRangeWithHeaders skips the bodies, only their stored sizes and line counts are returned
+	GetArticlesByRangeWithHeaders(ctx context.Context, g *models.Group, low, high int64) ([]models.Article, error)
+	GetOverviewByRange(ctx context.Context, g *models.Group, low, high int64, extraHeaders []string) ([]models.Overview, error)
+	// GetHeaderFieldByRange returns the header of the group articles in the range, ErrInvalidHeader is returned for malformed names
+	GetHeaderFieldByRange(ctx context.Context, g *models.Group, field string, low, high int64) ([]models.HeaderField, error)
+	GetNewThreads(ctx context.Context, g *models.Group, perPage int, pageNum int) ([]int, error)
+	GetNewThreadsSince(ctx context.Context, g *models.Group, since time.Time, perPage, pageNum int) ([]int, error)
+	GetThread(ctx context.Context, g *models.Group, threadNum int) ([]int, error)
+	GetThreadCount(ctx context.Context, g *models.Group) (int, error)
+	// GetTopPosters returns n authors of the most articles in the group, grouped by From header
+	GetTopPosters(ctx context.Context, g *models.Group, n int) ([]models.PosterStats, error)
+	GetArticlesByThread(ctx context.Context, g *models.Group, threadID string) ([]models.Article, error)
+	// GetArticlesBySubject matches the subjects with "Re:" prefixes stripped, exactly or by substring if fuzzy is set
+	GetArticlesBySubject(ctx context.Context, g *models.Group, subject string, fuzzy bool) ([]models.Article, error)
+	// GetArticleReferencesTree maps message-ids of the thread articles to the message-ids of their replies
+	GetArticleReferencesTree(ctx context.Context, rootMessageID string) (map[string][]string, error)
+	SearchArticles(ctx context.Context, query string, groups []string) ([]models.Article, error)
+	// ExpireGroupArticles removes the articles created before the given time from the group,
+	// the articles left without any group are deleted and counted
+	ExpireGroupArticles(ctx context.Context, g *models.Group, before time.Time) (int, error)
+	// RunExpiration applies the retention_days of every group at once, like ExpireGroupArticles
+	RunExpiration(ctx context.Context) (int, error)
+	// GetOrphanedArticles returns the articles which aren't in any group, they are left only by bugs
+	GetOrphanedArticles(ctx context.Context) ([]models.Article, error)
+	// PruneOrphanedArticles deletes the articles which aren't in any group along with their attachments
+	PruneOrphanedArticles(ctx context.Context) (int, error)
+
+	// GetArticlesNotSeenByPeer returns articles created after since which haven't been fed to the peer yet, ordered by id
+	GetArticlesNotSeenByPeer(ctx context.Context, peerID string, since time.Time) ([]models.Article, error)
+	// SetPeerSyncState marks all the articles up to lastArticleID as fed to the peer
+	SetPeerSyncState(ctx context.Context, peerID string, lastArticleID int) error
+	// GetArticlesForPeer returns up to batchSize articles which haven't been fed to the peer yet, ordered by id
+	GetArticlesForPeer(ctx context.Context, peerID string, batchSize int) ([]models.Article, error)
+	// MarkArticlesSentToPeer records the articles as fed to the peer, so they aren't returned by GetArticlesForPeer anymore
+	MarkArticlesSentToPeer(ctx context.Context, peerID string, articleIDs []int64) error
+}
+
+// BackendTx is the backend whose methods run inside a single transaction, it must be finished with Commit or Rollback
+type BackendTx interface {
+	StorageBackend
+
+	Commit() error
+	Rollback() error
+}
+
+// IsValidHeaderName checks the header name consists of letters, digits and hyphens only,
+// so it's safe to be used in JSON paths
+func IsValidHeaderName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for _, c := range name {
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+type UserBackend interface {
+	CreateUser(ctx context.Context, username, password string) error
+	AuthenticateUser(ctx context.Context, username, password string) (bool, error)
+	GetUserID(ctx context.Context, username string) (int64, error)
+
+	// groups without any permission entries are open to everyone
+	CanRead(ctx context.Context, userID int64, groupName string) (bool, error)
+	CanPost(ctx context.Context, userID int64, groupName string) (bool, error)
+	// unlike the checks above, it requires an explicit moderator permission
+	IsModerator(ctx context.Context, userID int64, groupName string) (bool, error)
+	SetPermission(ctx context.Context, userID int64, groupName, role string) error
 }
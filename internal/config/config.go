@@ -1,28 +1,99 @@
 package config
 
 import (
+	"fmt"
 	"github.com/BurntSushi/toml"
 	"os"
 )
 
 const (
-	SQLiteBackendType = "sqlite"
+	SQLiteBackendType   = "sqlite"
+	PostgresBackendType = "postgres"
 )
 
 type Config struct {
-	Address     string              `toml:"address"`
-	Port        int                 `toml:"port"`
-	WSPort      int                 `toml:"ws_port"`
-	BackendType string              `toml:"backend_type"`
-	Domain      string              `toml:"domain"`
-	SQLite      SQLiteBackendConfig `toml:"sqlite"`
-	UploadPath  string              `toml:"upload_path"`
+	Address            string                `toml:"address"`
+	Port               int                   `toml:"port"`
+	WSPort             int                   `toml:"ws_port"`
+	BackendType        string                `toml:"backend_type"`
+	Domain             string                `toml:"domain"`
+	SQLite             SQLiteBackendConfig   `toml:"sqlite"`
+	Postgres           PostgresBackendConfig `toml:"postgres"`
+	UploadPath         string                `toml:"upload_path"`
+	AdminAddr          string                `toml:"admin_addr"`
+	HTTPAddr           string                `toml:"http_addr"` // public JSON API, disabled if empty
+	MetricsAddr        string                `toml:"metrics_addr"`
+	SpoolStatsInterval int                   `toml:"spool_stats_interval"` // in seconds, how often the spool size metrics are updated
+	LogLevel           string                `toml:"log_level"`            // debug, info (default), warn or error
+	LogFormat          string                `toml:"log_format"`           // text (default) or json
+	TLSPort            int                   `toml:"tls_port"`
+	TLSCertFile        string                `toml:"tls_cert_file"`
+	TLSKeyFile         string                `toml:"tls_key_file"`
+	ExpirationInterval int                   `toml:"expiration_interval"` // in minutes
+	Retention          []RetentionRule       `toml:"retention"`           // per-group retention, retention_days of the group takes priority
+	WildmatCacheSize   int                   `toml:"wildmat_cache_size"`
+	PostRateLimit      int                   `toml:"post_rate_limit"` // posts per minute per IP, 0 disables limiting
+	PostRateBurst      int                   `toml:"post_rate_burst"`
+	MaxArticleSize     int64                 `toml:"max_article_size"`      // in bytes, 0 means unlimited
+	MaxBytesPerSession int64                 `toml:"max_bytes_per_session"` // sent and received, the client is disconnected after the command exceeding it
+	AllowControl       bool                  `toml:"allow_control"`         // accept posted control messages, e.g. cancel
+	LegacyMode         bool                  `toml:"legacy_mode"`           // article number 0 refers to the latest article (RFC 977) instead of the current one
+	TimeZone           string                `toml:"time_zone"`             // IANA name of the server local time zone, UTC if empty
+	OverviewFmt        OverviewFmtConfig     `toml:"overview_fmt"`
+	AllowIHAVE         bool                  `toml:"allow_ihave"`      // accept articles from peers, enable only on trusted networks
+	FeedInterval       int                   `toml:"feed_interval"`    // in seconds
+	ShutdownTimeout    int                   `toml:"shutdown_timeout"` // in seconds
+	IdleTimeout        int                   `toml:"idle_timeout"`     // in seconds, connections sending no commands for this long are closed
+	Peers              []PeerFeed            `toml:"peers"`
+	SMTP               SMTPConfig            `toml:"smtp"`          // relay for forwarding posts to moderators
+	JWT                JWTConfig             `toml:"jwt"`           // tokens accepted as AUTHINFO passwords
+	AllowedCIDRs       []string              `toml:"allowed_cidrs"` // everyone is allowed if empty
+	DeniedCIDRs        []string              `toml:"denied_cidrs"`  // takes priority over allowed_cidrs
 }
 
 type SQLiteBackendConfig struct {
 	Path string `toml:"path"`
 }
 
+type PostgresBackendConfig struct {
+	DSN string `toml:"dsn"`
+}
+
+// PeerFeed describes a peer which new local articles are fed to
+type PeerFeed struct {
+	Name     string `toml:"name"` // identifies the peer feed state, defaults to address:port
+	Address  string `toml:"address"`
+	Port     int    `toml:"port"`
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	Groups   string `toml:"groups"` // wildmat, all groups are fed if empty
+}
+
+// RetentionRule keeps the articles of the groups matching the wildmat for the given number of days
+type RetentionRule struct {
+	Groups string `toml:"groups"`
+	Days   int    `toml:"days"`
+}
+
+// SMTPConfig describes the relay used to mail posts to moderators, forwarding is disabled if Address is empty
+type SMTPConfig struct {
+	Address  string `toml:"address"` // host:port
+	Username string `toml:"username"`
+	Password string `toml:"password"`
+	From     string `toml:"from"` // envelope sender, defaults to news@domain
+}
+
+// JWTConfig describes tokens issued by an external authentication system, they are accepted if Secret is set
+type JWTConfig struct {
+	Secret    string `toml:"secret"`
+	Algorithm string `toml:"algorithm"` // HS256 (default), HS384 or HS512
+}
+
+// OverviewFmtConfig lists headers which are appended to the mandatory OVER fields
+type OverviewFmtConfig struct {
+	ExtraHeaders []string `toml:"extra_headers"`
+}
+
 func ParseConfig(path string) (Config, error) {
 	cfg := Config{}
 
@@ -32,5 +103,32 @@ func ParseConfig(path string) (Config, error) {
 		return Config{}, err
 	}
 
+	if cfg.ExpirationInterval == 0 {
+		cfg.ExpirationInterval = 60
+	}
+	if cfg.FeedInterval == 0 {
+		cfg.FeedInterval = 60
+	}
+	if cfg.SpoolStatsInterval == 0 {
+		cfg.SpoolStatsInterval = 300
+	}
+	if cfg.ShutdownTimeout == 0 {
+		cfg.ShutdownTimeout = 30
+	}
+	if cfg.IdleTimeout == 0 {
+		cfg.IdleTimeout = 300
+	}
+	if cfg.SMTP.From == "" {
+		cfg.SMTP.From = fmt.Sprintf("news@%s", cfg.Domain)
+	}
+	for i, v := range cfg.Peers {
+		if v.Port == 0 {
+			cfg.Peers[i].Port = 119
+		}
+		if v.Name == "" {
+			cfg.Peers[i].Name = fmt.Sprintf("%s:%d", v.Address, cfg.Peers[i].Port)
+		}
+	}
+
 	return cfg, nil
 }
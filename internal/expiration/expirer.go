@@ -0,0 +1,78 @@
+package expiration
+
+import (
+	"context"
+	"github.com/ChronosX88/yans/internal/backend"
+	"log/slog"
+	"time"
+)
+
+// Expirer periodically removes the articles which are older than the retention of their groups
+type Expirer struct {
+	backend  backend.StorageBackend
+	policy   Policy
+	interval time.Duration
+}
+
+func NewExpirer(b backend.StorageBackend, policy Policy, interval time.Duration) *Expirer {
+	return &Expirer{
+		backend:  b,
+		policy:   policy,
+		interval: interval,
+	}
+}
+
+// Start runs the expiration goroutine until ctx is done
+func (e *Expirer) Start(ctx context.Context) {
+	go e.expireLoop(ctx)
+}
+
+func (e *Expirer) expireLoop(ctx context.Context) {
+	t := time.NewTicker(e.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			{
+				deleted, err := e.Run(ctx)
+				if err != nil {
+					slog.Error("Failed to expire articles", "error", err)
+					continue
+				}
+				if deleted > 0 {
+					slog.Info("Expired articles", "count", deleted)
+				}
+			}
+		}
+	}
+}
+
+// Run removes the expired articles from every group which has a retention.
+// Articles which are left without any group are deleted completely, their count is returned.
+func (e *Expirer) Run(ctx context.Context) (int, error) {
+	groups, err := e.backend.ListGroups(ctx)
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, v := range groups {
+		retention, err := e.policy.RetentionFor(ctx, &v)
+		if err != nil {
+			return deleted, err
+		}
+		if retention <= 0 {
+			continue
+		}
+
+		n, err := e.backend.ExpireGroupArticles(ctx, &v, time.Now().Add(-retention))
+		if err != nil {
+			return deleted, err
+		}
+		deleted += n
+	}
+	return deleted, nil
+}
@@ -0,0 +1,107 @@
+//go:build sqlite_fts5
+
+package expiration
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/backend/sqlite"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+)
+
+func intPtr(v int) *int {
+	return &v
+}
+
+func TestPolicies(t *testing.T) {
+	policy := Policies{NewDatabasePolicy(), NewConfigFilePolicy([]config.RetentionRule{{Groups: "test.config*", Days: 7}})}
+	tests := []struct {
+		group models.Group
+		want  time.Duration
+	}{
+		{models.Group{GroupName: "test.db", RetentionDays: intPtr(1)}, 24 * time.Hour},
+		// retention_days of the group takes priority
+		{models.Group{GroupName: "test.config", RetentionDays: intPtr(2)}, 48 * time.Hour},
+		{models.Group{GroupName: "test.config.sub"}, 7 * 24 * time.Hour},
+		{models.Group{GroupName: "test.forever"}, 0},
+	}
+	for _, tt := range tests {
+		got, err := policy.RetentionFor(context.Background(), &tt.group)
+		if err != nil {
+			t.Fatalf("RetentionFor(%s) error = %v", tt.group.GroupName, err)
+		}
+		if got != tt.want {
+			t.Errorf("RetentionFor(%s) = %v, want %v", tt.group.GroupName, got, tt.want)
+		}
+	}
+}
+
+func TestExpirerRun(t *testing.T) {
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	b, err := sqlite.NewSQLiteBackend(config.SQLiteBackendConfig{Path: dsn})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	// the articles are backdated and the retention is set directly, the backend has no methods for that
+	db, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	ctx := context.Background()
+
+	for _, v := range []string{"test.db", "test.config", "test.forever"} {
+		if err := b.CreateGroup(ctx, v, "", false, "y"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := db.ExecContext(ctx, "UPDATE groups SET retention_days = 1 WHERE group_name = 'test.db'"); err != nil {
+		t.Fatal(err)
+	}
+
+	old := time.Now().UTC().AddDate(0, 0, -3).Format("2006-01-02 15:04:05")
+	for _, group := range []string{"test.db", "test.config", "test.forever"} {
+		for _, age := range []string{"old", "new"} {
+			messageID := fmt.Sprintf("<%s@%s>", age, group)
+			a := models.Article{HeaderRaw: fmt.Sprintf(`{"Message-Id":[%q]}`, messageID), Body: "hello\n"}
+			if err := b.SaveArticle(ctx, a, []string{group}); err != nil {
+				t.Fatal(err)
+			}
+			if age == "old" {
+				if _, err := db.ExecContext(ctx, "UPDATE articles SET created_at = ? WHERE json_extract(header, '$.Message-Id[0]') = ?", old, messageID); err != nil {
+					t.Fatal(err)
+				}
+			}
+		}
+	}
+
+	policy := Policies{NewDatabasePolicy(), NewConfigFilePolicy([]config.RetentionRule{{Groups: "test.config", Days: 2}})}
+	e := NewExpirer(b, policy, time.Hour)
+	if deleted, err := e.Run(ctx); err != nil || deleted != 2 {
+		t.Fatalf("Run() = %d, %v, want 2", deleted, err)
+	}
+
+	for _, tt := range []struct{ group, want string }{
+		{"test.db", "[<new@test.db>]"},
+		{"test.config", "[<new@test.config>]"},
+		{"test.forever", "[<old@test.forever> <new@test.forever>]"},
+	} {
+		g, err := b.GetGroup(ctx, tt.group)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ids, err := b.ListArticleIDs(ctx, &g)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if fmt.Sprint(ids) != tt.want {
+			t.Errorf("articles of %s = %q, want %s", tt.group, ids, tt.want)
+		}
+	}
+}
@@ -0,0 +1,68 @@
+package expiration
+
+import (
+	"context"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+	"time"
+)
+
+// Policy decides how long the articles of a group are kept, zero retention means forever
+type Policy interface {
+	RetentionFor(ctx context.Context, g *models.Group) (time.Duration, error)
+}
+
+// DatabasePolicy takes the retention from the retention_days column of the group
+type DatabasePolicy struct{}
+
+func NewDatabasePolicy() *DatabasePolicy {
+	return &DatabasePolicy{}
+}
+
+func (p *DatabasePolicy) RetentionFor(ctx context.Context, g *models.Group) (time.Duration, error) {
+	if g.RetentionDays == nil {
+		return 0, nil
+	}
+	return time.Duration(*g.RetentionDays) * 24 * time.Hour, nil
+}
+
+// ConfigFilePolicy takes the retention from the first configured rule whose wildmat matches the group
+type ConfigFilePolicy struct {
+	rules []config.RetentionRule
+}
+
+func NewConfigFilePolicy(rules []config.RetentionRule) *ConfigFilePolicy {
+	return &ConfigFilePolicy{rules: rules}
+}
+
+func (p *ConfigFilePolicy) RetentionFor(ctx context.Context, g *models.Group) (time.Duration, error) {
+	for _, v := range p.rules {
+		r, err := utils.CompileWildmat(v.Groups)
+		if err != nil {
+			return 0, err
+		}
+		if ok, err := r.MatchString(g.GroupName); err != nil {
+			return 0, err
+		} else if ok {
+			return time.Duration(v.Days) * 24 * time.Hour, nil
+		}
+	}
+	return 0, nil
+}
+
+// Policies asks the policies in turn, the first non-zero retention is used
+type Policies []Policy
+
+func (p Policies) RetentionFor(ctx context.Context, g *models.Group) (time.Duration, error) {
+	for _, v := range p {
+		retention, err := v.RetentionFor(ctx, g)
+		if err != nil {
+			return 0, err
+		}
+		if retention != 0 {
+			return retention, nil
+		}
+	}
+	return 0, nil
+}
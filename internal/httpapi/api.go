@@ -0,0 +1,700 @@
+// Package httpapi provides read and post access to the newsgroups over HTTP with JSON payloads,
+// for web clients which can't speak NNTP.
+//
+// @title YANS HTTP API
+// @version 1.0
+// @description JSON endpoints mirroring the core NNTP operations.
+// @BasePath /
+package httpapi
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/jhillyerd/enmime"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultThreadsPerPage = 20
+	defaultRecentArticles = 20
+	maxRecentArticles     = 100
+
+	// room for the JSON syntax and escaping of the posted article fields
+	postRequestOverhead = 64 << 10
+	// post requests are limited even if the article size isn't
+	defaultMaxPostRequestSize = 32 << 20
+)
+
+// Poster saves articles posted by users, it's implemented by the NNTP command handler
+type Poster interface {
+	PostArticle(ctx context.Context, envelope *enmime.Envelope, userID int64) (models.Article, string, error)
+}
+
+// RateLimiter limits article posting per remote address
+type RateLimiter interface {
+	Allow(remoteAddr string) (bool, time.Duration)
+}
+
+// API serves the newsgroups to anonymous clients, so groups requiring authentication
+// or restricted by permissions aren't accessible through it.
+type API struct {
+	backend        backend.StorageBackend
+	poster         Poster
+	postLimiter    RateLimiter
+	maxArticleSize int64
+	server         *http.Server
+}
+
+type groupResponse struct {
+	Name          string `json:"name"`
+	Description   string `json:"description"`
+	Moderated     bool   `json:"moderated"`
+	LowWaterMark  int    `json:"low_water_mark"`
+	HighWaterMark int    `json:"high_water_mark"`
+	ArticleCount  int    `json:"article_count"`
+}
+
+type overviewResponse struct {
+	Number     int    `json:"number"`
+	Subject    string `json:"subject"`
+	From       string `json:"from"`
+	Date       string `json:"date"`
+	MessageID  string `json:"message_id"`
+	References string `json:"references"`
+	Bytes      int    `json:"bytes"`
+	Lines      int    `json:"lines"`
+}
+
+type scoredArticleResponse struct {
+	overviewResponse
+	Replies int `json:"replies"`
+}
+
+type recentArticleResponse struct {
+	Group string `json:"group"`
+	overviewResponse
+}
+
+type attachmentResponse struct {
+	ContentType string `json:"content_type"`
+	FileName    string `json:"file_name"`
+}
+
+type articleResponse struct {
+	Number      int                  `json:"number"`
+	MessageID   string               `json:"message_id"`
+	Header      map[string][]string  `json:"header"`
+	Body        string               `json:"body"`
+	Attachments []attachmentResponse `json:"attachments"`
+}
+
+type threadListResponse struct {
+	Total   int   `json:"total"`   // number of all threads in the group, regardless of since
+	Threads []int `json:"threads"` // numbers of the thread starting articles, newest first
+}
+
+type postArticleRequest struct {
+	From      string `json:"from"`
+	Subject   string `json:"subject"`
+	Body      string `json:"body"`
+	InReplyTo string `json:"in_reply_to"` // message-id of the parent article, optional
+}
+
+type postArticleResponse struct {
+	MessageID string `json:"message_id"`
+}
+
+type errorResponse struct {
+	Error string `json:"error"`
+}
+
+// NewAPI creates the API, postLimiter may be nil if posting isn't limited
+func NewAPI(b backend.StorageBackend, poster Poster, postLimiter RateLimiter, maxArticleSize int64, address string) *API {
+	api := &API{
+		backend:        b,
+		poster:         poster,
+		postLimiter:    postLimiter,
+		maxArticleSize: maxArticleSize,
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/groups", api.handleGroups)
+	mux.HandleFunc("/groups/", api.handleGroup)
+	mux.HandleFunc("/articles/recent", api.handleRecentArticles)
+
+	api.server = &http.Server{Addr: address, Handler: mux}
+	return api
+}
+
+func (api *API) Start() {
+	go func() {
+		slog.Info("HTTP API is listening", "address", api.server.Addr)
+		if err := api.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("HTTP API has failed", "error", err)
+		}
+	}()
+}
+
+func (api *API) Stop(ctx context.Context) error {
+	return api.server.Shutdown(ctx)
+}
+
+// handleGroups lists the newsgroups.
+//
+// @Summary List newsgroups
+// @Produce json
+// @Success 200 {array} groupResponse
+// @Failure 500 {object} errorResponse
+// @Router /groups [get]
+func (api *API) handleGroups(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	groups, err := api.backend.ListGroupsWithStats(r.Context())
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := []groupResponse{}
+	for _, v := range groups {
+		ok, err := api.canRead(r.Context(), &v.Group)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !ok {
+			continue
+		}
+		g := groupResponse{
+			Name:          v.GroupName,
+			Moderated:     v.Moderated,
+			LowWaterMark:  v.LowWaterMark,
+			HighWaterMark: v.HighWaterMark,
+			ArticleCount:  v.ArticleCount,
+		}
+		if v.Description != nil {
+			g.Description = *v.Description
+		}
+		res = append(res, g)
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleGroup routes /groups/{name}/articles, /groups/{name}/articles/{number},
+// /groups/{name}/articles/{number}/attachments/{id} and /groups/{name}/threads
+func (api *API) handleGroup(w http.ResponseWriter, r *http.Request) {
+	parts := strings.Split(strings.TrimPrefix(r.URL.Path, "/groups/"), "/")
+	isAttachment := len(parts) == 5 && parts[1] == "articles" && parts[3] == "attachments"
+	if (len(parts) < 2 || len(parts) > 3) && !isAttachment || parts[0] == "" || (parts[1] != "articles" && parts[1] != "threads") || (parts[1] == "threads" && len(parts) != 2) {
+		writeError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	g, err := api.backend.GetGroup(r.Context(), parts[0])
+	if err == nil {
+		var ok bool
+		ok, err = api.canRead(r.Context(), &g)
+		if err == nil && !ok {
+			err = sql.ErrNoRows
+		}
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "no such newsgroup")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if parts[1] == "threads" {
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		api.handleListThreads(w, r, &g)
+		return
+	}
+
+	if len(parts) >= 3 {
+		num, err := strconv.Atoi(parts[2])
+		if err != nil {
+			writeError(w, http.StatusNotFound, "not found")
+			return
+		}
+		if r.Method != http.MethodGet {
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+			return
+		}
+		if isAttachment {
+			api.handleGetAttachment(w, r, &g, num, parts[4])
+			return
+		}
+		api.handleGetArticle(w, r, &g, num)
+		return
+	}
+
+	switch r.Method {
+	case http.MethodGet:
+		{
+			api.handleListArticles(w, r, &g)
+		}
+	case http.MethodPost:
+		{
+			api.handlePostArticle(w, r, &g)
+		}
+	default:
+		{
+			writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		}
+	}
+}
+
+// handleListArticles returns the overview of the group articles, the whole group is listed by default.
+// The articles can be selected either by number or by posting date range, not both.
+// Sorting by score adds the reply count of the article thread to the overview.
+//
+// @Summary List articles in the newsgroup
+// @Produce json
+// @Param name path string true "Newsgroup name"
+// @Param low query int false "Lowest article number"
+// @Param high query int false "Highest article number"
+// @Param from query string false "Earliest posting date, RFC 3339"
+// @Param to query string false "Latest posting date, RFC 3339, now by default"
+// @Param sort query string false "score to list the articles of the threads with more replies first, by number only"
+// @Success 200 {array} overviewResponse
+// @Failure 400 {object} errorResponse
+// @Failure 404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Router /groups/{name}/articles [get]
+func (api *API) handleListArticles(w http.ResponseWriter, r *http.Request, g *models.Group) {
+	q := r.URL.Query()
+	if q.Get("from") != "" || q.Get("to") != "" {
+		if q.Get("low") != "" || q.Get("high") != "" {
+			writeError(w, http.StatusBadRequest, "article numbers and dates can't be combined")
+			return
+		}
+		if q.Get("sort") != "" {
+			writeError(w, http.StatusBadRequest, "only articles selected by number can be sorted")
+			return
+		}
+		api.handleListArticlesByDate(w, r, g)
+		return
+	}
+
+	low, high := int64(1), int64(-1)
+	var err error
+	if v := r.URL.Query().Get("low"); v != "" {
+		if low, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid low article number")
+			return
+		}
+	}
+	if v := r.URL.Query().Get("high"); v != "" {
+		if high, err = strconv.ParseInt(v, 10, 64); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid high article number")
+			return
+		}
+	} else {
+		highWaterMark, err := api.backend.GetGroupHighWaterMark(r.Context(), g)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		high = int64(highWaterMark)
+	}
+
+	switch q.Get("sort") {
+	case "":
+	case "score":
+		{
+			api.handleListArticlesByScore(w, r, g, low, high)
+			return
+		}
+	default:
+		{
+			writeError(w, http.StatusBadRequest, "sort must be score")
+			return
+		}
+	}
+
+	overview, err := api.backend.GetOverviewByRange(r.Context(), g, low, high, nil)
+	if err != nil && err != sql.ErrNoRows {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := []overviewResponse{}
+	for _, v := range overview {
+		res = append(res, overviewResponse{
+			Number:     v.ArticleNumber,
+			Subject:    v.Subject,
+			From:       v.From,
+			Date:       v.Date,
+			MessageID:  v.MessageID,
+			References: v.References,
+			Bytes:      v.Bytes,
+			Lines:      v.Lines,
+		})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (api *API) handleListArticlesByScore(w http.ResponseWriter, r *http.Request, g *models.Group, low, high int64) {
+	articles, err := api.backend.GetArticlesSortedByScore(r.Context(), g, low, high)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := []scoredArticleResponse{}
+	for i := range articles {
+		res = append(res, scoredArticleResponse{
+			overviewResponse: articleOverview(&articles[i]),
+			Replies:          articles[i].ReplyCount,
+		})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+func (api *API) handleListArticlesByDate(w http.ResponseWriter, r *http.Request, g *models.Group) {
+	from, to := time.Unix(0, 0), time.Now()
+	var err error
+	if v := r.URL.Query().Get("from"); v != "" {
+		if from, err = time.Parse(time.RFC3339, v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid from date")
+			return
+		}
+	}
+	if v := r.URL.Query().Get("to"); v != "" {
+		if to, err = time.Parse(time.RFC3339, v); err != nil {
+			writeError(w, http.StatusBadRequest, "invalid to date")
+			return
+		}
+	}
+
+	articles, err := api.backend.GetArticlesByDateRange(r.Context(), g, from, to)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := []overviewResponse{}
+	for i := range articles {
+		res = append(res, articleOverview(&articles[i]))
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleRecentArticles returns the most recent articles of all the readable groups, newest first.
+//
+// @Summary List recent articles across newsgroups
+// @Produce json
+// @Param limit query int false "Number of articles, at most 100" default(20)
+// @Success 200 {array} recentArticleResponse
+// @Failure 400 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Router /articles/recent [get]
+func (api *API) handleRecentArticles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		writeError(w, http.StatusMethodNotAllowed, "method not allowed")
+		return
+	}
+
+	limit := defaultRecentArticles
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit < 1 || limit > maxRecentArticles {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+	}
+
+	articles, err := api.backend.GetRecentArticlesAcrossGroups(r.Context(), limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// articles of the groups which aren't readable are skipped, so fewer of them may be returned
+	readable := map[int]bool{}
+	res := []recentArticleResponse{}
+	for i := range articles {
+		groupID := articles[i].GroupID
+		ok, checked := readable[groupID]
+		if !checked {
+			g, err := api.backend.GetGroupByID(r.Context(), groupID)
+			if err == nil {
+				ok, err = api.canRead(r.Context(), &g)
+			}
+			if err != nil {
+				writeError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			readable[groupID] = ok
+		}
+		if !ok {
+			continue
+		}
+		res = append(res, recentArticleResponse{Group: articles[i].GroupName, overviewResponse: articleOverview(&articles[i].Article)})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleGetArticle returns the article with its headers and body.
+//
+// @Summary Get article by number
+// @Produce json
+// @Param name path string true "Newsgroup name"
+// @Param number path int true "Article number"
+// @Success 200 {object} articleResponse
+// @Failure 404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Router /groups/{name}/articles/{number} [get]
+func (api *API) handleGetArticle(w http.ResponseWriter, r *http.Request, g *models.Group, num int) {
+	a, err := api.backend.GetArticleByNumber(r.Context(), g, num)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "no article with that number")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := articleResponse{
+		Number:      a.ArticleNumber,
+		MessageID:   a.Header.Get("Message-Id"),
+		Header:      a.Header,
+		Body:        a.Body,
+		Attachments: []attachmentResponse{},
+	}
+	for _, v := range a.Attachments {
+		res.Attachments = append(res.Attachments, attachmentResponse{ContentType: v.ContentType, FileName: v.FileName})
+	}
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handleGetAttachment sends the attachment data as is, with its content type.
+//
+// @Summary Download article attachment
+// @Produce octet-stream
+// @Param name path string true "Newsgroup name"
+// @Param number path int true "Article number"
+// @Param id path string true "Attachment file name"
+// @Success 200 {file} binary
+// @Failure 404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Router /groups/{name}/articles/{number}/attachments/{id} [get]
+func (api *API) handleGetAttachment(w http.ResponseWriter, r *http.Request, g *models.Group, num int, attachmentID string) {
+	a, err := api.backend.GetArticleHeadersByNumber(r.Context(), g, num)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "no article with that number")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	content, contentType, err := api.backend.GetAttachmentContent(r.Context(), int64(a.ID), attachmentID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			writeError(w, http.StatusNotFound, "no such attachment")
+			return
+		}
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.WriteHeader(http.StatusOK)
+	if _, err := w.Write(content); err != nil {
+		slog.Warn("Failed to write response", "error", err)
+	}
+}
+
+// handleListThreads returns a page of the group threads along with the total thread count.
+//
+// @Summary List threads in the newsgroup
+// @Produce json
+// @Param name path string true "Newsgroup name"
+// @Param per_page query int false "Threads per page" default(20)
+// @Param page query int false "Page number, starting from 1" default(1)
+// @Param since query int false "Only threads started after this unix timestamp"
+// @Success 200 {object} threadListResponse
+// @Failure 400 {object} errorResponse
+// @Failure 404 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Router /groups/{name}/threads [get]
+func (api *API) handleListThreads(w http.ResponseWriter, r *http.Request, g *models.Group) {
+	perPage, pageNum := defaultThreadsPerPage, 1
+	var err error
+	if v := r.URL.Query().Get("per_page"); v != "" {
+		if perPage, err = strconv.Atoi(v); err != nil || perPage < 1 {
+			writeError(w, http.StatusBadRequest, "invalid per_page")
+			return
+		}
+	}
+	if v := r.URL.Query().Get("page"); v != "" {
+		if pageNum, err = strconv.Atoi(v); err != nil || pageNum < 1 {
+			writeError(w, http.StatusBadRequest, "invalid page")
+			return
+		}
+	}
+
+	var threads []int
+	if v := r.URL.Query().Get("since"); v != "" {
+		since, err := strconv.ParseInt(v, 10, 64)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid since")
+			return
+		}
+		threads, err = api.backend.GetNewThreadsSince(r.Context(), g, time.Unix(since, 0), perPage, pageNum)
+	} else {
+		threads, err = api.backend.GetNewThreads(r.Context(), g, perPage, pageNum)
+	}
+	if err != nil && err != sql.ErrNoRows {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	total, err := api.backend.GetThreadCount(r.Context(), g)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	res := threadListResponse{Total: total, Threads: []int{}}
+	res.Threads = append(res.Threads, threads...)
+	writeJSON(w, http.StatusOK, res)
+}
+
+// handlePostArticle posts a plain text article to the group, the same way as POST command does.
+//
+// @Summary Post article to the newsgroup
+// @Accept json
+// @Produce json
+// @Param name path string true "Newsgroup name"
+// @Param article body postArticleRequest true "Article"
+// @Success 201 {object} postArticleResponse
+// @Failure 400 {object} errorResponse
+// @Failure 404 {object} errorResponse
+// @Failure 413 {object} errorResponse
+// @Failure 429 {object} errorResponse
+// @Failure 500 {object} errorResponse
+// @Router /groups/{name}/articles [post]
+func (api *API) handlePostArticle(w http.ResponseWriter, r *http.Request, g *models.Group) {
+	if api.postLimiter != nil {
+		if ok, retryAfter := api.postLimiter.Allow(r.RemoteAddr); !ok {
+			seconds := int(math.Ceil(retryAfter.Seconds()))
+			w.Header().Set("Retry-After", strconv.Itoa(seconds))
+			writeError(w, http.StatusTooManyRequests, fmt.Sprintf("posting rate limit exceeded, retry after %d seconds", seconds))
+			return
+		}
+	}
+
+	limit := int64(defaultMaxPostRequestSize)
+	if api.maxArticleSize > 0 {
+		limit = api.maxArticleSize + postRequestOverhead
+	}
+	var req postArticleRequest
+	if err := json.NewDecoder(http.MaxBytesReader(w, r.Body, limit)).Decode(&req); err != nil {
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("request exceeds maximum size of %d bytes", limit))
+			return
+		}
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if req.From == "" || req.Subject == "" {
+		writeError(w, http.StatusBadRequest, "from and subject are required")
+		return
+	}
+	if strings.ContainsAny(req.From+req.Subject+req.InReplyTo, "\r\n") {
+		writeError(w, http.StatusBadRequest, "header values must not contain line breaks")
+		return
+	}
+	if api.maxArticleSize > 0 && int64(len(req.From)+len(req.Subject)+len(req.InReplyTo)+len(req.Body)) > api.maxArticleSize {
+		writeError(w, http.StatusRequestEntityTooLarge, fmt.Sprintf("article exceeds maximum size of %d bytes", api.maxArticleSize))
+		return
+	}
+
+	var sb strings.Builder
+	sb.WriteString("From: " + req.From + "\r\n")
+	sb.WriteString("Newsgroups: " + g.GroupName + "\r\n")
+	sb.WriteString("Subject: " + req.Subject + "\r\n")
+	if req.InReplyTo != "" {
+		sb.WriteString("In-Reply-To: " + req.InReplyTo + "\r\n")
+		sb.WriteString("References: " + req.InReplyTo + "\r\n")
+	}
+	sb.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+	sb.WriteString(req.Body)
+
+	envelope, err := enmime.ReadEnvelope(strings.NewReader(sb.String()))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	// anonymous clients have zero user id, same as unauthenticated NNTP sessions
+	a, reason, err := api.poster.PostArticle(r.Context(), envelope, 0)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if reason != "" {
+		writeError(w, http.StatusBadRequest, reason)
+		return
+	}
+	slog.Info("Article saved", "remote_addr", r.RemoteAddr, "command", "HTTP POST", "message_id", a.Header.Get("Message-Id"), "newsgroups", g.GroupName)
+	writeJSON(w, http.StatusCreated, postArticleResponse{MessageID: a.Header.Get("Message-Id")})
+}
+
+// canRead tells whether the group is readable by anonymous clients
+func (api *API) canRead(ctx context.Context, g *models.Group) (bool, error) {
+	if g.RequiresAuth {
+		return false, nil
+	}
+	return api.backend.CanRead(ctx, 0, g.GroupName)
+}
+
+// articleOverview computes overview fields of the article fetched with its body
+func articleOverview(a *models.Article) overviewResponse {
+	return overviewResponse{
+		Number:     a.ArticleNumber,
+		Subject:    a.Header.Get("Subject"),
+		From:       a.Header.Get("From"),
+		Date:       a.Header.Get("Date"),
+		MessageID:  a.Header.Get("Message-Id"),
+		References: a.Header.Get("References"),
+		Bytes:      a.WireSize(),
+		Lines:      strings.Count(a.Body, "\n"),
+	}
+}
+
+func writeJSON(w http.ResponseWriter, status int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Warn("Failed to write response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, errorResponse{Error: message})
+}
@@ -0,0 +1,62 @@
+package httpapi
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/jhillyerd/enmime"
+)
+
+// testPoster accepts every article without saving it
+type testPoster struct {
+	posted int
+}
+
+func (p *testPoster) PostArticle(ctx context.Context, envelope *enmime.Envelope, userID int64) (models.Article, string, error) {
+	p.posted++
+	return models.Article{Header: map[string][]string{"Message-Id": {"<posted@example.com>"}}}, "", nil
+}
+
+func TestHandlePostArticleSizeLimit(t *testing.T) {
+	tests := []struct {
+		name           string
+		maxArticleSize int64
+		body           string
+		wantStatus     int
+	}{
+		{"small article", 1024, `{"from":"a@example.com","subject":"s","body":"hello"}`, http.StatusCreated},
+		{"article over the limit", 1024, `{"from":"a@example.com","subject":"s","body":"` + strings.Repeat("x", 2048) + `"}`, http.StatusRequestEntityTooLarge},
+		{"request over the limit", 1024, `{"from":"a@example.com","subject":"s","body":"` + strings.Repeat("x", 1024+postRequestOverhead) + `"}`, http.StatusRequestEntityTooLarge},
+		{"unlimited article size", 0, `{"from":"a@example.com","subject":"s","body":"` + strings.Repeat("x", 1024+postRequestOverhead) + `"}`, http.StatusCreated},
+		{"malformed request", 1024, `{"from":`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			poster := &testPoster{}
+			api := &API{poster: poster, maxArticleSize: tt.maxArticleSize}
+
+			w := httptest.NewRecorder()
+			api.handlePostArticle(w, httptest.NewRequest(http.MethodPost, "/groups/test.group/articles", strings.NewReader(tt.body)), &models.Group{GroupName: "test.group"})
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+			if wantPosted := tt.wantStatus == http.StatusCreated; (poster.posted == 1) != wantPosted {
+				t.Errorf("posted %d articles", poster.posted)
+			}
+		})
+	}
+}
+
+func TestHandleListArticlesByDateInvalid(t *testing.T) {
+	for _, query := range []string{"from=yesterday", "to=2026-01-01", "from=2026-01-01T00:00:00Z&to=tomorrow"} {
+		w := httptest.NewRecorder()
+		(&API{}).handleListArticlesByDate(w, httptest.NewRequest(http.MethodGet, "/groups/test.group/articles?"+query, nil), &models.Group{GroupName: "test.group"})
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: status = %d, want %d", query, w.Code, http.StatusBadRequest)
+		}
+	}
+}
@@ -0,0 +1,42 @@
+package logging
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strings"
+)
+
+const (
+	TextFormat = "text"
+	JSONFormat = "json"
+)
+
+// Setup makes the default slog logger write to stderr with the given level and format
+func Setup(level, format string) error {
+	var l slog.Level
+	if level != "" {
+		if err := l.UnmarshalText([]byte(level)); err != nil {
+			return fmt.Errorf("invalid log level %q, must be one of: debug, info, warn, error", level)
+		}
+	}
+
+	opts := &slog.HandlerOptions{Level: l}
+	var h slog.Handler
+	switch strings.ToLower(format) {
+	case "", TextFormat:
+		{
+			h = slog.NewTextHandler(os.Stderr, opts)
+		}
+	case JSONFormat:
+		{
+			h = slog.NewJSONHandler(os.Stderr, opts)
+		}
+	default:
+		{
+			return fmt.Errorf("invalid log format %q, must be one of: text, json", format)
+		}
+	}
+	slog.SetDefault(slog.New(h))
+	return nil
+}
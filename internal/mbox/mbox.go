@@ -0,0 +1,247 @@
+package mbox
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+	"github.com/ChronosX88/yans/internal/validation"
+	"github.com/google/uuid"
+	"github.com/jhillyerd/enmime"
+	"io"
+	"io/ioutil"
+	"net/mail"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// lines which have to be quoted in mboxrd, so they aren't taken as message separators
+var fromLineRegex = regexp.MustCompile(`^>*From `)
+
+// Archiver moves group articles from and to Unix mbox files (mboxrd flavour)
+type Archiver struct {
+	backend    backend.StorageBackend
+	uploadPath string
+}
+
+func NewArchiver(b backend.StorageBackend, uploadPath string) *Archiver {
+	return &Archiver{
+		backend:    b,
+		uploadPath: uploadPath,
+	}
+}
+
+// ExportGroup writes all the articles of the group to w, ordered by article number
+func (ar *Archiver) ExportGroup(ctx context.Context, g *models.Group, w io.Writer) error {
+	numbers, err := ar.backend.GetArticleNumbers(ctx, g, 0, 0)
+	if err != nil {
+		return err
+	}
+
+	bw := bufio.NewWriter(w)
+	for _, v := range numbers {
+		a, err := ar.backend.GetArticleByNumber(ctx, g, int(v))
+		if err != nil {
+			return err
+		}
+		if err := ar.writeMessage(bw, &a); err != nil {
+			return err
+		}
+	}
+	return bw.Flush()
+}
+
+func (ar *Archiver) writeMessage(w *bufio.Writer, a *models.Article) error {
+	builder := utils.Builder()
+	for k, v := range a.Header {
+		for _, j := range v {
+			builder = builder.Header(k, j)
+		}
+	}
+	builder = builder.Text([]byte(a.Body))
+	for _, v := range a.Attachments {
+		builder = builder.AddFileAttachment(path.Join(ar.uploadPath, v.FileName))
+	}
+	p, err := builder.Build()
+	if err != nil {
+		return err
+	}
+	var buf bytes.Buffer
+	if err := p.Encode(&buf); err != nil {
+		return err
+	}
+
+	sender := "MAILER-DAEMON"
+	if addr, err := mail.ParseAddress(a.Header.Get("From")); err == nil {
+		sender = addr.Address
+	}
+	if _, err := fmt.Fprintf(w, "From %s %s\n", sender, a.CreatedAt.UTC().Format(time.ANSIC)); err != nil {
+		return err
+	}
+
+	raw := strings.TrimRight(strings.ReplaceAll(buf.String(), "\r\n", "\n"), "\n")
+	for _, line := range strings.Split(raw, "\n") {
+		if fromLineRegex.MatchString(line) {
+			line = ">" + line
+		}
+		if _, err := w.WriteString(line + "\n"); err != nil {
+			return err
+		}
+	}
+	// messages are separated by an empty line
+	_, err = w.WriteString("\n")
+	return err
+}
+
+// ImportGroup reads the messages from r in the format written by ExportGroup and saves them into the group.
+// Articles which already exist on the server are skipped.
+func (ar *Archiver) ImportGroup(ctx context.Context, g *models.Group, r io.Reader) error {
+	messages, err := readMessages(r)
+	if err != nil {
+		return err
+	}
+
+	var envelopes []*enmime.Envelope
+	var messageIDs []string
+	for _, v := range messages {
+		envelope, err := enmime.ReadEnvelope(bytes.NewReader(v))
+		if err != nil {
+			return err
+		}
+		envelopes = append(envelopes, envelope)
+		messageIDs = append(messageIDs, envelope.GetHeader("Message-ID"))
+	}
+
+	// articles which are already stored are skipped, including the ones held for moderation
+	stored := map[string]bool{}
+	for _, v := range messageIDs {
+		exists, err := ar.backend.HasArticle(ctx, v)
+		if err != nil {
+			return err
+		}
+		stored[v] = exists
+	}
+
+	var articles []models.Article
+	threads := map[string]sql.NullString{} // thread of each imported article, by message-id
+	for _, envelope := range envelopes {
+		messageID := envelope.GetHeader("Message-ID")
+		if _, ok := threads[messageID]; ok || stored[messageID] {
+			continue
+		}
+
+		a, err := ar.buildArticle(ctx, envelope, threads)
+		if err != nil {
+			return err
+		}
+		threads[messageID] = a.Thread
+		articles = append(articles, a)
+	}
+
+	if len(articles) == 0 {
+		return nil
+	}
+	return ar.backend.BulkSaveArticles(ctx, articles, []string{g.GroupName})
+}
+
+// readMessages splits the mbox into the raw messages, undoing the quoting of From lines
+func readMessages(r io.Reader) ([][]byte, error) {
+	var messages [][]byte
+	var current *bytes.Buffer
+
+	br := bufio.NewReader(r)
+	for {
+		line, err := br.ReadString('\n')
+		if err != nil && err != io.EOF {
+			return nil, err
+		}
+		if line != "" {
+			line = strings.TrimRight(line, "\r\n")
+			if strings.HasPrefix(line, "From ") {
+				if current != nil {
+					messages = append(messages, current.Bytes())
+				}
+				current = &bytes.Buffer{}
+			} else if current == nil {
+				return nil, fmt.Errorf("mbox must start with a From line")
+			} else {
+				if fromLineRegex.MatchString(line) {
+					line = line[1:]
+				}
+				current.WriteString(line + "\r\n")
+			}
+		}
+		if err == io.EOF {
+			break
+		}
+	}
+	if current != nil {
+		messages = append(messages, current.Bytes())
+	}
+
+	// drop the empty lines separating the messages
+	for i, v := range messages {
+		messages[i] = append(bytes.TrimRight(v, "\r\n"), "\r\n"...)
+	}
+	return messages, nil
+}
+
+// buildArticle makes the article from the envelope, the threads of articles imported before it are looked up in threads
+func (ar *Archiver) buildArticle(ctx context.Context, envelope *enmime.Envelope, threads map[string]sql.NullString) (models.Article, error) {
+	headerJson, err := json.Marshal(envelope.Root.Header)
+	if err != nil {
+		return models.Article{}, err
+	}
+
+	a := models.Article{}
+	a.HeaderRaw = string(headerJson)
+	a.Header = envelope.Root.Header
+	a.Body = envelope.Text
+	if err := validation.ValidateArticle(&a, true); err != nil {
+		return a, fmt.Errorf("%s: %w", a.Header.Get("Message-ID"), err)
+	}
+
+	if parentID := envelope.GetHeader("In-Reply-To"); parentID != "" {
+		thread, found := threads[parentID]
+		if !found {
+			parent, err := ar.backend.GetArticle(ctx, parentID)
+			if err != nil && err != sql.ErrNoRows {
+				return a, err
+			}
+			found = err == nil
+			thread = parent.Thread
+		}
+		if found && thread.Valid {
+			a.Thread = thread
+		} else if found {
+			// the parent starts the thread
+			a.Thread = sql.NullString{String: parentID, Valid: true}
+		}
+	}
+
+	for _, v := range envelope.Attachments {
+		if v.ContentType != "image/jpeg" && v.ContentType != "image/png" && v.ContentType != "image/gif" {
+			return a, fmt.Errorf("%s: disallowed attachment type", a.Header.Get("Message-ID"))
+		}
+		ext_ := strings.Split(v.FileName, ".")
+		ext := ext_[len(ext_)-1]
+		fileName := uuid.New().String() + "." + ext
+		if err := ioutil.WriteFile(path.Join(ar.uploadPath, fileName), v.Content, 0644); err != nil {
+			return a, err
+		}
+		a.Attachments = append(a.Attachments, models.Attachment{
+			ContentType: v.ContentType,
+			FileName:    fileName,
+			Content:     v.Content,
+		})
+	}
+
+	return a, nil
+}
@@ -0,0 +1,75 @@
+//go:build sqlite_fts5
+
+package mbox
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/ChronosX88/yans/internal/backend/sqlite"
+	"github.com/ChronosX88/yans/internal/config"
+)
+
+// the delivery date of the From line is the time the article was stored, so it changes on import
+var fromLineDateRegex = regexp.MustCompile(`(?m)^(From \S+) .*$`)
+
+func TestExportImportGolden(t *testing.T) {
+	golden, err := os.ReadFile("testdata/group.mbox")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	b, err := sqlite.NewSQLiteBackend(config.SQLiteBackendConfig{Path: "file:" + t.Name() + "?mode=memory&cache=shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer b.Close()
+	ctx := context.Background()
+	if err := b.CreateGroup(ctx, "test.group", "", false, "y"); err != nil {
+		t.Fatal(err)
+	}
+	g, err := b.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ar := NewArchiver(b, t.TempDir())
+
+	if err := ar.ImportGroup(ctx, &g, bytes.NewReader(golden)); err != nil {
+		t.Fatalf("ImportGroup() error = %v", err)
+	}
+	// importing again skips the stored articles
+	if err := ar.ImportGroup(ctx, &g, bytes.NewReader(golden)); err != nil {
+		t.Fatalf("ImportGroup() of the same mbox error = %v", err)
+	}
+	if count, err := b.GetArticlesCount(ctx, &g); err != nil || count != 2 {
+		t.Fatalf("GetArticlesCount() = %d, %v, want 2", count, err)
+	}
+	reply, err := b.GetArticle(ctx, "<reply@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	first, err := b.GetArticle(ctx, "<first@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "Hello, group.\n>From the archive, quoted once.\nFrom here on, quoted.\n"; strings.ReplaceAll(first.Body, "\r\n", "\n") != want {
+		t.Errorf("imported body = %q, want the From lines unquoted", first.Body)
+	}
+	if reply.Thread.String != "<first@example.com>" {
+		t.Errorf("reply thread = %q, want %q", reply.Thread.String, "<first@example.com>")
+	}
+
+	var buf bytes.Buffer
+	if err := ar.ExportGroup(ctx, &g, &buf); err != nil {
+		t.Fatalf("ExportGroup() error = %v", err)
+	}
+	got := fromLineDateRegex.ReplaceAllString(buf.String(), "$1")
+	want := fromLineDateRegex.ReplaceAllString(string(golden), "$1")
+	if got != want {
+		t.Errorf("exported mbox differs from the golden one:\n%s", got)
+	}
+}
@@ -0,0 +1,152 @@
+package metrics
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"github.com/jmoiron/sqlx"
+	"strings"
+	"time"
+)
+
+// DB is a sqlx.DB which records duration of every executed query.
+// Queries and transactions are also cancelled on Close, in addition to their own contexts.
+type DB struct {
+	*sqlx.DB
+	ctx    context.Context
+	cancel context.CancelFunc
+}
+
+// Conn is implemented by both DB and Tx, so the same queries can run either on the database or inside a transaction
+type Conn interface {
+	GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error
+	ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error)
+	BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error)
+	Rebind(query string) string
+}
+
+// Tx is a transaction which is rolled back when its context is done or the database is closed
+type Tx struct {
+	*sqlx.Tx
+	release func()
+
+	// set for the transactions nested into another one, which are savepoints of the outer transaction
+	savepoint string
+	depth     int
+	done      bool
+}
+
+func WrapDB(db *sqlx.DB) *DB {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &DB{DB: db, ctx: ctx, cancel: cancel}
+}
+
+func (db *DB) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, release := db.withClose(ctx)
+	defer release()
+	defer observeQuery(query, time.Now())
+	return db.DB.GetContext(ctx, dest, query, args...)
+}
+
+func (db *DB) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	ctx, release := db.withClose(ctx)
+	defer release()
+	defer observeQuery(query, time.Now())
+	return db.DB.SelectContext(ctx, dest, query, args...)
+}
+
+func (db *DB) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	ctx, release := db.withClose(ctx)
+	defer release()
+	defer observeQuery(query, time.Now())
+	return db.DB.ExecContext(ctx, query, args...)
+}
+
+func (db *DB) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	ctx, release := db.withClose(ctx)
+	tx, err := db.DB.BeginTxx(ctx, opts)
+	if err != nil {
+		release()
+		return nil, err
+	}
+	return &Tx{Tx: tx, release: release}, nil
+}
+
+// Close cancels the queries in progress and closes the database
+func (db *DB) Close() error {
+	db.cancel()
+	return db.DB.Close()
+}
+
+// withClose derives the context which is also cancelled on Close, release must be called once it's not needed
+func (db *DB) withClose(ctx context.Context) (context.Context, func()) {
+	ctx, cancel := context.WithCancel(ctx)
+	stop := context.AfterFunc(db.ctx, cancel)
+	return ctx, func() {
+		stop()
+		cancel()
+	}
+}
+
+func (tx *Tx) GetContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	defer observeQuery(query, time.Now())
+	return tx.Tx.GetContext(ctx, dest, query, args...)
+}
+
+func (tx *Tx) SelectContext(ctx context.Context, dest interface{}, query string, args ...interface{}) error {
+	defer observeQuery(query, time.Now())
+	return tx.Tx.SelectContext(ctx, dest, query, args...)
+}
+
+func (tx *Tx) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	defer observeQuery(query, time.Now())
+	return tx.Tx.ExecContext(ctx, query, args...)
+}
+
+// BeginTxx starts a savepoint, which is released on Commit and rolled back to on Rollback, opts are ignored
+func (tx *Tx) BeginTxx(ctx context.Context, opts *sql.TxOptions) (*Tx, error) {
+	savepoint := fmt.Sprintf("sp%d", tx.depth+1)
+	if _, err := tx.Tx.ExecContext(ctx, "SAVEPOINT "+savepoint); err != nil {
+		return nil, err
+	}
+	return &Tx{Tx: tx.Tx, release: func() {}, savepoint: savepoint, depth: tx.depth + 1}, nil
+}
+
+func (tx *Tx) Commit() error {
+	defer tx.release()
+	if tx.savepoint != "" {
+		if tx.done {
+			return sql.ErrTxDone
+		}
+		tx.done = true
+		_, err := tx.Tx.Exec("RELEASE SAVEPOINT " + tx.savepoint)
+		return err
+	}
+	return tx.Tx.Commit()
+}
+
+func (tx *Tx) Rollback() error {
+	defer tx.release()
+	if tx.savepoint != "" {
+		if tx.done {
+			return sql.ErrTxDone
+		}
+		tx.done = true
+		if _, err := tx.Tx.Exec("ROLLBACK TO SAVEPOINT " + tx.savepoint); err != nil {
+			return err
+		}
+		_, err := tx.Tx.Exec("RELEASE SAVEPOINT " + tx.savepoint)
+		return err
+	}
+	return tx.Tx.Rollback()
+}
+
+// observeQuery labels the query by its statement type to keep cardinality low
+func observeQuery(query string, start time.Time) {
+	operation := "other"
+	if fields := strings.Fields(query); len(fields) > 0 {
+		operation = strings.ToLower(fields[0])
+	}
+	BackendQueryDuration.WithLabelValues(operation).Observe(time.Since(start).Seconds())
+}
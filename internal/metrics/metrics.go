@@ -0,0 +1,99 @@
+package metrics
+
+import (
+	"context"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+	"log/slog"
+	"net/http"
+)
+
+const namespace = "yans"
+
+var (
+	ActiveConnections = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "active_connections",
+		Help:      "Number of currently open client connections.",
+	})
+	CommandsTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "commands_total",
+		Help:      "Total number of processed NNTP commands.",
+	}, []string{"command"})
+	CommandDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "command_duration_seconds",
+		Help:      "Time spent processing NNTP commands.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"command"})
+	ArticlesPostedTotal = prometheus.NewCounter(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "articles_posted_total",
+		Help:      "Total number of successfully posted articles.",
+	})
+	TransferredBytesTotal = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: namespace,
+		Name:      "transferred_bytes_total",
+		Help:      "Total number of bytes received from (in) and sent to (out) clients.",
+	}, []string{"direction"})
+	ConnectionBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "connection_bytes",
+		Help:      "Number of bytes transferred by the open connections, updated after every command.",
+	}, []string{"direction"})
+	SpoolBytes = prometheus.NewGauge(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "spool_bytes",
+		Help:      "Total size of the stored articles, updated periodically.",
+	})
+	GroupSpoolBytes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: namespace,
+		Name:      "group_spool_bytes",
+		Help:      "Size of the stored articles in each group, updated periodically.",
+	}, []string{"group"})
+	BackendQueryDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: namespace,
+		Name:      "backend_query_duration_seconds",
+		Help:      "Time spent executing storage backend queries.",
+		Buckets:   prometheus.DefBuckets,
+	}, []string{"operation"})
+)
+
+func init() {
+	prometheus.MustRegister(
+		ActiveConnections,
+		CommandsTotal,
+		CommandDuration,
+		ArticlesPostedTotal,
+		TransferredBytesTotal,
+		ConnectionBytes,
+		SpoolBytes,
+		GroupSpoolBytes,
+		BackendQueryDuration,
+	)
+}
+
+// Server serves collected metrics in Prometheus text format on /metrics
+type Server struct {
+	server *http.Server
+}
+
+func NewServer(address string) *Server {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	return &Server{server: &http.Server{Addr: address, Handler: mux}}
+}
+
+func (ms *Server) Start() {
+	go func() {
+		slog.Info("Metrics are served", "address", ms.server.Addr)
+		if err := ms.server.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Metrics server has failed", "error", err)
+		}
+	}()
+}
+
+func (ms *Server) Stop(ctx context.Context) error {
+	return ms.server.Shutdown(ctx)
+}
@@ -4,6 +4,7 @@ import (
 	"database/sql"
 	"github.com/jhillyerd/enmime"
 	"net/textproto"
+	"strings"
 	"time"
 )
 
@@ -14,13 +15,65 @@ type Article struct {
 	Body      string         `db:"body"`
 	Thread    sql.NullString `db:"thread"`
 
+	// articles of moderated groups are hidden from readers until approved
+	Approved   bool           `db:"approved"`
+	ApprovedBy sql.NullString `db:"approved_by"`
+
+	// lowercased address from the From header, set by the backend on saving
+	FromEmail string `db:"from_email"`
+
+	// authenticated user who has posted the article to this server, it authorizes cancelling the article
+	UserID sql.NullInt64 `db:"user_id"`
+
+	// size of the article as sent by ARTICLE, set by the database on saving the same way as WireSize does
+	ByteCount int `db:"byte_count"`
+	// number of the body lines, set by the database on saving
+	LineCount int `db:"line_count"`
+
 	Header        textproto.MIMEHeader `db:"-"`
 	Envelope      *enmime.Envelope     `db:"-"`
-	ArticleNumber int                  `db:"-"`
+	ArticleNumber int                  `db:"article_number"`
 	Attachments   []Attachment
+
+	// filled only by the group article listings, which don't fetch the attachments themselves
+	HasAttachments bool `db:"has_attachments"`
+
+	// matched body fragment, filled only by full-text search
+	Snippet string `db:"snippet"`
+
+	// number of replies in the article's thread, filled only by GetArticlesSortedByScore
+	ReplyCount int `db:"reply_count"`
+}
+
+// WireSize returns the size of the article in bytes as it's sent over the wire: the header lines
+// and the body lines terminated with CRLF and the empty line between them, without dot-stuffing
+func (a *Article) WireSize() int {
+	size := 2
+	for k, v := range a.Header {
+		for _, j := range v {
+			size += len(k) + len(": ") + len(j) + 2
+		}
+	}
+	// every line feed turns into CRLF, the last line gets one if it's missing
+	body := strings.ReplaceAll(a.Body, "\r\n", "\n")
+	size += len(body) + strings.Count(body, "\n")
+	if body != "" && !strings.HasSuffix(body, "\n") {
+		size += 2
+	}
+	return size
+}
+
+// ArticleWithGroup is an article along with the name of one of the groups it's posted to
+type ArticleWithGroup struct {
+	Article
+	GroupID   int    `db:"group_id"`
+	GroupName string `db:"group_name"`
 }
 
 type Attachment struct {
 	ContentType string `db:"content_type"`
 	FileName    string `db:"attachment_id"`
+
+	// stored in the attachments table on saving if set, it isn't fetched along with the article
+	Content []byte `db:"-"`
 }
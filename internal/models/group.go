@@ -2,9 +2,42 @@ package models
 
 import "time"
 
+// posting status flags of groups (RFC 3977 §7.6.3)
+const (
+	PostingAllowed    = "y"
+	PostingNotAllowed = "n"
+	PostingModerated  = "m"
+)
+
 type Group struct {
-	ID          int       `db:"id"`
-	GroupName   string    `db:"group_name"`
-	Description *string   `db:"description"`
-	CreatedAt   time.Time `db:"created_at"`
+	ID             int       `db:"id"`
+	GroupName      string    `db:"group_name"`
+	Description    *string   `db:"description"`
+	Moderated      bool      `db:"moderated"`
+	PostingStatus  string    `db:"posting_status"`  // flag shown by LIST ACTIVE, one of Posting* constants
+	ModeratorEmail *string   `db:"moderator_email"` // posts are forwarded there instead of being held for approval
+	RequiresAuth   bool      `db:"requires_auth"`
+	RetentionDays  *int      `db:"retention_days"` // nil means articles are kept forever
+	CreatedAt      time.Time `db:"created_at"`
+}
+
+// GroupStats is a group along with its article numbering info
+type GroupStats struct {
+	Group
+	LowWaterMark  int `db:"low_water_mark"`
+	HighWaterMark int `db:"high_water_mark"`
+	ArticleCount  int `db:"article_count"`
+}
+
+// PosterStats is the number of articles posted to a group by a single author
+type PosterStats struct {
+	Email        string
+	DisplayName  string
+	ArticleCount int
+}
+
+// DailyCount is the number of articles posted to a group during a single UTC day
+type DailyCount struct {
+	Date  time.Time
+	Count int
 }
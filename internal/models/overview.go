@@ -0,0 +1,21 @@
+package models
+
+// Overview contains the mandatory OVER fields (RFC 3977 §8.3)
+type Overview struct {
+	ArticleNumber int    `db:"article_number"`
+	Subject       string `db:"subject"`
+	From          string `db:"from_header"`
+	Date          string `db:"date"`
+	MessageID     string `db:"message_id"`
+	References    string `db:"references_header"`
+	Bytes         int    `db:"bytes"`
+	Lines         int    `db:"lines"`
+
+	Extra []string `db:"-"` // values of the extra headers listed in OVERVIEW.FMT, in the same order
+}
+
+// HeaderField is the first value of a single header of the article, as returned by XHDR
+type HeaderField struct {
+	ArticleNumber int    `db:"article_number"`
+	Value         string `db:"value"`
+}
@@ -0,0 +1,8 @@
+package models
+
+// Roles which can be granted to a user in a group
+const (
+	RoleReader    = "reader"
+	RolePoster    = "poster"
+	RoleModerator = "moderator"
+)
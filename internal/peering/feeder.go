@@ -0,0 +1,246 @@
+package peering
+
+import (
+	"context"
+	"fmt"
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/ChronosX88/yans/internal/utils"
+	"log/slog"
+	"net/textproto"
+	"path"
+	"strings"
+	"time"
+)
+
+// articles older than this are never offered to peers
+const feedHorizon = 24 * time.Hour
+
+// number of articles fetched from the backend at once
+const feedBatchSize = 100
+
+// Feeder periodically pushes new local articles to the configured peers using IHAVE (RFC 3977 §6.3.2)
+type Feeder struct {
+	backend    backend.StorageBackend
+	peers      []config.PeerFeed
+	uploadPath string
+	interval   time.Duration
+}
+
+func NewFeeder(b backend.StorageBackend, peers []config.PeerFeed, uploadPath string, interval time.Duration) *Feeder {
+	return &Feeder{
+		backend:    b,
+		peers:      peers,
+		uploadPath: uploadPath,
+		interval:   interval,
+	}
+}
+
+func (f *Feeder) ListPeerFeeds() []config.PeerFeed {
+	return f.peers
+}
+
+// Start runs a feeding goroutine for each peer until ctx is done
+func (f *Feeder) Start(ctx context.Context) {
+	for _, v := range f.peers {
+		slog.Info("Feeding articles to peer", "peer", v.Name)
+		go f.feedLoop(ctx, v)
+	}
+}
+
+func (f *Feeder) feedLoop(ctx context.Context, p config.PeerFeed) {
+	t := time.NewTicker(f.interval)
+	defer t.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+			{
+				if err := f.feed(ctx, p); err != nil {
+					slog.Error("Failed to feed peer", "peer", p.Name, "error", err)
+				}
+			}
+		}
+	}
+}
+
+func (f *Feeder) feed(ctx context.Context, p config.PeerFeed) error {
+	articles, err := f.backend.GetArticlesForPeer(ctx, p.Name, feedBatchSize)
+	if err != nil {
+		return err
+	}
+	if len(articles) == 0 {
+		return nil
+	}
+
+	conn, err := textproto.Dial("tcp", fmt.Sprintf("%s:%d", p.Address, p.Port))
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	if _, _, err := conn.ReadCodeLine(20); err != nil {
+		return err
+	}
+	if p.Username != "" {
+		if err := authenticate(conn, p.Username, p.Password); err != nil {
+			return err
+		}
+	}
+
+	horizon := time.Now().Add(-feedHorizon)
+	for len(articles) > 0 {
+		// the articles deferred by the peer stay unmarked and are offered again on the next run
+		var sent []int64
+		deferred := false
+		for _, v := range articles {
+			wanted, err := f.isWanted(p, &v)
+			if err != nil {
+				return err
+			}
+			if wanted && !v.CreatedAt.Before(horizon) {
+				ok, err := f.offer(conn, &v)
+				if err != nil {
+					if markErr := f.backend.MarkArticlesSentToPeer(ctx, p.Name, sent); markErr != nil {
+						slog.Error("Failed to save peer feed state", "peer", p.Name, "error", markErr)
+					}
+					return err
+				}
+				if !ok {
+					deferred = true
+					continue
+				}
+			}
+			sent = append(sent, int64(v.ID))
+		}
+		if err := f.backend.MarkArticlesSentToPeer(ctx, p.Name, sent); err != nil {
+			return err
+		}
+		if deferred || len(articles) < feedBatchSize {
+			break
+		}
+
+		if articles, err = f.backend.GetArticlesForPeer(ctx, p.Name, feedBatchSize); err != nil {
+			return err
+		}
+	}
+
+	_, err = conn.Cmd("QUIT")
+	return err
+}
+
+// isWanted checks whether the article is posted to any group matched by the peer's wildmat
+func (f *Feeder) isWanted(p config.PeerFeed, a *models.Article) (bool, error) {
+	if p.Groups == "" {
+		return true, nil
+	}
+	r, err := utils.CompileWildmat(p.Groups)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range strings.Split(a.Header.Get("Newsgroups"), ",") {
+		ok, err := r.MatchString(strings.TrimSpace(v))
+		if err != nil {
+			return false, err
+		}
+		if ok {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// offer sends the article to the peer, the articles which the peer refused are skipped.
+// It returns false if the peer asked to retry the transfer later.
+func (f *Feeder) offer(conn *textproto.Conn, a *models.Article) (bool, error) {
+	messageID := a.Header.Get("Message-ID")
+
+	id, err := conn.Cmd("IHAVE %s", messageID)
+	if err != nil {
+		return false, err
+	}
+	conn.StartResponse(id)
+	code, msg, err := conn.ReadCodeLine(0)
+	conn.EndResponse(id)
+	if err != nil {
+		return false, err
+	}
+	switch code {
+	case 435:
+		return true, nil // peer already has it
+	case 436:
+		slog.Info("Peer deferred article", "message_id", messageID, "reason", msg)
+		return false, nil
+	case 437:
+		slog.Info("Peer rejected article", "message_id", messageID, "reason", msg)
+		return true, nil
+	}
+	if code != 335 {
+		return false, fmt.Errorf("peer refused %s: %d %s", messageID, code, msg)
+	}
+
+	builder := utils.Builder()
+	for k, v := range a.Header {
+		for _, j := range v {
+			builder = builder.Header(k, j)
+		}
+	}
+	builder = builder.Text([]byte(a.Body))
+	for _, v := range a.Attachments {
+		builder = builder.AddFileAttachment(path.Join(f.uploadPath, v.FileName))
+	}
+	part, err := builder.Build()
+	if err != nil {
+		return false, err
+	}
+
+	dw := conn.DotWriter()
+	if err := part.Encode(dw); err != nil {
+		return false, err
+	}
+	if err := dw.Close(); err != nil {
+		return false, err
+	}
+
+	code, msg, err = conn.ReadCodeLine(0)
+	if err != nil {
+		return false, err
+	}
+	switch code {
+	case 235:
+		return true, nil
+	case 436:
+		slog.Info("Peer deferred article", "message_id", messageID, "reason", msg)
+		return false, nil
+	case 437:
+		slog.Info("Peer rejected article", "message_id", messageID, "reason", msg)
+		return true, nil
+	default:
+		return false, fmt.Errorf("failed to transfer %s: %d %s", messageID, code, msg)
+	}
+}
+
+func authenticate(conn *textproto.Conn, username, password string) error {
+	id, err := conn.Cmd("AUTHINFO USER %s", username)
+	if err != nil {
+		return err
+	}
+	conn.StartResponse(id)
+	_, _, err = conn.ReadCodeLine(381)
+	conn.EndResponse(id)
+	if err != nil {
+		return err
+	}
+
+	id, err = conn.Cmd("AUTHINFO PASS %s", password)
+	if err != nil {
+		return err
+	}
+	conn.StartResponse(id)
+	defer conn.EndResponse(id)
+	_, _, err = conn.ReadCodeLine(281)
+	return err
+}
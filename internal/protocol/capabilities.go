@@ -18,8 +18,30 @@ const (
 	ListCapability
 	ImplementationCapability
 	ModeReaderCapability
+	AuthInfoCapability
+	StartTLSCapability
+	StreamingCapability
+
+	// types of the capabilities added with NewCapabilityType start here
+	customCapabilityBase
 )
 
+// names of the capabilities added with NewCapabilityType, indexed from customCapabilityBase
+var customCapabilityNames []string
+
+// NewCapabilityType returns the type for the capability which isn't known to the protocol package,
+// the same type is returned for the same name. It isn't safe for concurrent use, so it's meant
+// to be called during initialization.
+func NewCapabilityType(name string) CapabilityType {
+	for i, v := range customCapabilityNames {
+		if v == name {
+			return customCapabilityBase + CapabilityType(i)
+		}
+	}
+	customCapabilityNames = append(customCapabilityNames, name)
+	return customCapabilityBase + CapabilityType(len(customCapabilityNames)-1)
+}
+
 func (ct CapabilityType) String() string {
 	switch ct {
 	case VersionCapability:
@@ -42,7 +64,16 @@ func (ct CapabilityType) String() string {
 		return CapabilityNameImplementation
 	case ModeReaderCapability:
 		return CapabilityNameModeReader
+	case AuthInfoCapability:
+		return CapabilityNameAuthInfo
+	case StartTLSCapability:
+		return CapabilityNameStartTLS
+	case StreamingCapability:
+		return CapabilityNameStreaming
 	default:
+		if i := int(ct - customCapabilityBase); ct >= customCapabilityBase && i < len(customCapabilityNames) {
+			return customCapabilityNames[i]
+		}
 		return ""
 	}
 }
@@ -66,6 +66,12 @@ const (
 	CommandNext         = "NEXT"
 	CommandOver         = "OVER"
 	CommandXover        = "XOVER"
+	CommandXhdr         = "XHDR"
+	CommandAuthInfo     = "AUTHINFO"
+	CommandStartTLS     = "STARTTLS"
+	CommandIHave        = "IHAVE"
+	CommandCheck        = "CHECK"
+	CommandTakeThis     = "TAKETHIS"
 )
 
 const (
@@ -79,4 +85,7 @@ const (
 	CapabilityNameList           = "LIST"
 	CapabilityNameImplementation = "IMPLEMENTATION"
 	CapabilityNameModeReader     = "MODE-READER"
+	CapabilityNameAuthInfo       = "AUTHINFO"
+	CapabilityNameStartTLS       = "STARTTLS"
+	CapabilityNameStreaming      = "STREAMING"
 )
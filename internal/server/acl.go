@@ -0,0 +1,65 @@
+package server
+
+import (
+	"net"
+	"strings"
+)
+
+// ConnACL decides which remote addresses may connect. Denied ranges take priority,
+// and all addresses are allowed if no allowed ranges are set.
+type ConnACL struct {
+	allowed []*net.IPNet
+	denied  []*net.IPNet
+}
+
+func NewConnACL(allowed, denied []string) (*ConnACL, error) {
+	acl := &ConnACL{}
+	var err error
+	if acl.allowed, err = parseCIDRs(allowed); err != nil {
+		return nil, err
+	}
+	if acl.denied, err = parseCIDRs(denied); err != nil {
+		return nil, err
+	}
+	return acl, nil
+}
+
+func parseCIDRs(cidrs []string) ([]*net.IPNet, error) {
+	var res []*net.IPNet
+	for _, v := range cidrs {
+		_, n, err := net.ParseCIDR(v)
+		if err != nil {
+			return nil, err
+		}
+		res = append(res, n)
+	}
+	return res, nil
+}
+
+// Allow reports whether the client with the given address (host or host:port) may connect
+func (acl *ConnACL) Allow(remoteAddr string) bool {
+	host, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		// IPv6 addresses may be bracketed without a port as well
+		host = strings.TrimSuffix(strings.TrimPrefix(remoteAddr, "["), "]")
+	}
+	ip := net.ParseIP(host)
+	if ip == nil {
+		return false
+	}
+
+	for _, v := range acl.denied {
+		if v.Contains(ip) {
+			return false
+		}
+	}
+	if len(acl.allowed) == 0 {
+		return true
+	}
+	for _, v := range acl.allowed {
+		if v.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,46 @@
+package server
+
+import "testing"
+
+func TestConnACLAllow(t *testing.T) {
+	tests := []struct {
+		name       string
+		allowed    []string
+		denied     []string
+		remoteAddr string
+		want       bool
+	}{
+		{name: "no ranges", remoteAddr: "192.0.2.1:119", want: true},
+		{name: "allowed", allowed: []string{"192.0.2.0/24"}, remoteAddr: "192.0.2.1:119", want: true},
+		{name: "not allowed", allowed: []string{"192.0.2.0/24"}, remoteAddr: "198.51.100.1:119", want: false},
+		{name: "denied", denied: []string{"192.0.2.0/24"}, remoteAddr: "192.0.2.1:119", want: false},
+		{name: "not denied", denied: []string{"192.0.2.0/24"}, remoteAddr: "198.51.100.1:119", want: true},
+		{name: "deny wins over allow", allowed: []string{"192.0.2.0/24"}, denied: []string{"192.0.2.128/25"}, remoteAddr: "192.0.2.200:119", want: false},
+		{name: "allowed outside the denied subrange", allowed: []string{"192.0.2.0/24"}, denied: []string{"192.0.2.128/25"}, remoteAddr: "192.0.2.1:119", want: true},
+		{name: "host without port", allowed: []string{"192.0.2.0/24"}, remoteAddr: "192.0.2.1", want: true},
+		{name: "bracketed IPv6 with port", allowed: []string{"2001:db8::/32"}, remoteAddr: "[2001:db8::1]:119", want: true},
+		{name: "bracketed IPv6 denied", denied: []string{"2001:db8::/32"}, remoteAddr: "[2001:db8::1]:119", want: false},
+		{name: "bracketed IPv6 without port", allowed: []string{"2001:db8::/32"}, remoteAddr: "[2001:db8::1]", want: true},
+		{name: "bare IPv6", allowed: []string{"2001:db8::/32"}, remoteAddr: "2001:db8::1", want: true},
+		{name: "IPv6 not in IPv4 range", allowed: []string{"192.0.2.0/24"}, remoteAddr: "[2001:db8::1]:119", want: false},
+		{name: "IPv4-mapped IPv6", allowed: []string{"192.0.2.0/24"}, remoteAddr: "[::ffff:192.0.2.1]:119", want: true},
+		{name: "unparsable address", remoteAddr: "example.com:119", want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			acl, err := NewConnACL(tt.allowed, tt.denied)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := acl.Allow(tt.remoteAddr); got != tt.want {
+				t.Errorf("Allow(%q) = %v, want %v", tt.remoteAddr, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewConnACLInvalidRange(t *testing.T) {
+	if _, err := NewConnACL([]string{"192.0.2.1"}, nil); err == nil {
+		t.Error("NewConnACL() of an address without prefix length succeeded")
+	}
+}
@@ -0,0 +1,43 @@
+package server
+
+import (
+	"net"
+	"sync/atomic"
+)
+
+// ConnStats counts the bytes transferred over a client connection, including the TLS overhead
+type ConnStats struct {
+	bytesRead    int64 // accessed atomically
+	bytesWritten int64 // accessed atomically
+}
+
+func (cs *ConnStats) BytesRead() int64 {
+	return atomic.LoadInt64(&cs.bytesRead)
+}
+
+func (cs *ConnStats) BytesWritten() int64 {
+	return atomic.LoadInt64(&cs.bytesWritten)
+}
+
+// Total returns the number of bytes transferred in both directions
+func (cs *ConnStats) Total() int64 {
+	return cs.BytesRead() + cs.BytesWritten()
+}
+
+// statsConn counts the bytes passing through the wrapped connection
+type statsConn struct {
+	net.Conn
+	stats *ConnStats
+}
+
+func (c *statsConn) Read(b []byte) (int, error) {
+	n, err := c.Conn.Read(b)
+	atomic.AddInt64(&c.stats.bytesRead, int64(n))
+	return n, err
+}
+
+func (c *statsConn) Write(b []byte) (int, error) {
+	n, err := c.Conn.Write(b)
+	atomic.AddInt64(&c.stats.bytesWritten, int64(n))
+	return n, err
+}
@@ -3,31 +3,81 @@ package server
 import (
 	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
 	"database/sql"
 	"encoding/json"
 	"fmt"
+	"github.com/ChronosX88/yans/internal/auth"
 	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/metrics"
 	"github.com/ChronosX88/yans/internal/models"
 	"github.com/ChronosX88/yans/internal/protocol"
 	"github.com/ChronosX88/yans/internal/utils"
+	"github.com/ChronosX88/yans/internal/validation"
+	"github.com/dlclark/regexp2"
 	"github.com/google/uuid"
 	"github.com/jhillyerd/enmime"
+	"io"
 	"io/ioutil"
+	"log/slog"
+	"math"
 	"net/mail"
+	"net/textproto"
 	"path"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
 )
 
+// postInReaderMode tells whether POST is accepted after MODE READER, which isn't supported yet
+const postInReaderMode = false
+
+// commandUsages describes the arguments of the commands for HELP, commands without arguments aren't listed
+var commandUsages = map[string]string{
+	protocol.CommandArticle:      "[message-ID|number]",
+	protocol.CommandAuthInfo:     "USER name|PASS password",
+	protocol.CommandBody:         "[message-ID|number]",
+	protocol.CommandCapabilities: "[keyword]",
+	protocol.CommandCheck:        "message-ID",
+	protocol.CommandGroup:        "newsgroup",
+	protocol.CommandHead:         "[message-ID|number]",
+	protocol.CommandIHave:        "message-ID",
+	protocol.CommandList:         "[ACTIVE [wildmat]|NEWSGROUPS [wildmat]|OVERVIEW.FMT]",
+	protocol.CommandListGroup:    "[newsgroup [range]]",
+	protocol.CommandMode:         "READER|STREAM",
+	protocol.CommandNewGroups:    "[yy]yymmdd hhmmss [GMT]",
+	protocol.CommandNewNews:      "wildmat [yy]yymmdd hhmmss [GMT]",
+	protocol.CommandOver:         "[message-ID|range]",
+	protocol.CommandStat:         "[message-ID|number]",
+	protocol.CommandTakeThis:     "message-ID",
+	protocol.CommandXhdr:         "header [message-ID|range]",
+	protocol.CommandXover:        "[range]",
+	"NEWTHREADS":                 "per-page page",
+	"THREAD":                     "number",
+}
+
 type Handler struct {
 	handlers     map[string]func(s *Session, command string, arguments []string, id uint) error
 	backend      backend.StorageBackend
 	serverDomain string
 	uploadPath   string
+	tlsConfig    *tls.Config
+	postLimiter  *PostRateLimiter
+	jwtValidator *auth.JWTValidator // nil if tokens aren't accepted
+
+	overviewHeaders []string
+	maxArticleSize  int64
+	allowIHave      bool
+	allowControl    bool
+	legacyMode      bool
+	location        *time.Location // server local time of NEWGROUPS and NEWNEWS dates
+	smtp            config.SMTPConfig
 }
 
-func NewHandler(b backend.StorageBackend, serverDomain, uploadPath string) *Handler {
+func NewHandler(b backend.StorageBackend, cfg config.Config, tlsConfig *tls.Config, postLimiter *PostRateLimiter, jwtValidator *auth.JWTValidator) *Handler {
 	h := &Handler{}
 	h.backend = b
 	h.handlers = map[string]func(s *Session, command string, arguments []string, id uint) error{
@@ -35,7 +85,7 @@ func NewHandler(b backend.StorageBackend, serverDomain, uploadPath string) *Hand
 		protocol.CommandDate:         h.handleDate,
 		protocol.CommandQuit:         h.handleQuit,
 		protocol.CommandList:         h.handleList,
-		protocol.CommandMode:         h.handleModeReader,
+		protocol.CommandMode:         h.handleMode,
 		protocol.CommandGroup:        h.handleGroup,
 		protocol.CommandNewGroups:    h.handleNewGroups,
 		protocol.CommandPost:         h.handlePost,
@@ -43,20 +93,43 @@ func NewHandler(b backend.StorageBackend, serverDomain, uploadPath string) *Hand
 		protocol.CommandArticle:      h.handleArticle,
 		protocol.CommandHead:         h.handleArticle,
 		protocol.CommandBody:         h.handleArticle,
-		protocol.CommandStat:         h.handleArticle,
+		protocol.CommandStat:         h.handleStat,
 		protocol.CommandHelp:         h.handleHelp,
 		protocol.CommandNewNews:      h.handleNewNews,
 		protocol.CommandLast:         h.handleLast,
 		protocol.CommandNext:         h.handleNext,
 		protocol.CommandOver:         h.handleOver,
 		protocol.CommandXover:        h.handleOver,
+		protocol.CommandXhdr:         h.handleXhdr,
+		protocol.CommandAuthInfo:     h.handleAuthInfo,
+		protocol.CommandStartTLS:     h.handleStartTLS,
+		protocol.CommandIHave:        h.handleIHave,
+		protocol.CommandCheck:        h.handleCheck,
+		protocol.CommandTakeThis:     h.handleTakeThis,
 
 		// project-specific extensions
 		"NEWTHREADS": h.handleNewThreads,
 		"THREAD":     h.handleThread,
 	}
-	h.serverDomain = serverDomain
-	h.uploadPath = uploadPath
+	h.serverDomain = cfg.Domain
+	h.uploadPath = cfg.UploadPath
+	h.tlsConfig = tlsConfig
+	h.postLimiter = postLimiter
+	h.jwtValidator = jwtValidator
+	h.maxArticleSize = cfg.MaxArticleSize
+	h.allowIHave = cfg.AllowIHAVE
+	h.allowControl = cfg.AllowControl
+	h.legacyMode = cfg.LegacyMode
+	h.smtp = cfg.SMTP
+	// the time zone is validated on the server creation
+	if loc, err := time.LoadLocation(cfg.TimeZone); err == nil {
+		h.location = loc
+	} else {
+		h.location = time.UTC
+	}
+	for _, v := range cfg.OverviewFmt.ExtraHeaders {
+		h.overviewHeaders = append(h.overviewHeaders, textproto.CanonicalMIMEHeaderKey(v))
+	}
 	return h
 }
 
@@ -66,6 +139,7 @@ func (h *Handler) handleCapabilities(s *Session, command string, arguments []str
 	return s.tconn.PrintfLine(s.capabilities.String())
 }
 
+// handleDate responds with the current time, it's always in UTC regardless of the server time zone (RFC 3977 §7.1)
 func (h *Handler) handleDate(s *Session, command string, arguments []string, id uint) error {
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
@@ -87,43 +161,40 @@ func (h *Handler) handleList(s *Session, command string, arguments []string, id
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
 
-	switch listType {
+	switch strings.ToUpper(listType) {
 	case "":
 		fallthrough
 	case "ACTIVE":
 		{
-			dw := s.tconn.DotWriter()
-			var groups []models.Group
-			var err error
-			if len(arguments) == 2 {
-				groups, err = h.backend.ListGroupsByPattern(arguments[1])
-			} else {
-				groups, err = h.backend.ListGroups()
-			}
-
+			groups, err := h.backend.ListGroupsWithStats(s.ctx)
 			if err != nil {
 				return err
 			}
-			dw.Write([]byte(protocol.NNTPResponse{Code: 215, Message: "list of newsgroups follows"}.String() + protocol.CRLF))
-			for _, v := range groups {
-				// TODO set actual post permission status
-				c, err := h.backend.GetArticlesCount(&v)
+			var pattern *regexp2.Regexp
+			if len(arguments) == 2 {
+				pattern, err = utils.CompileWildmat(arguments[1])
 				if err != nil {
 					return err
 				}
-				if c > 0 {
-					highWaterMark, err := h.backend.GetGroupHighWaterMark(&v)
-					if err != nil {
-						return err
-					}
-					lowWaterMark, err := h.backend.GetGroupLowWaterMark(&v)
-					if err != nil {
+			}
+
+			dw := s.tconn.DotWriter()
+			dw.Write([]byte(protocol.NNTPResponse{Code: 215, Message: "list of newsgroups follows"}.String() + protocol.CRLF))
+			for _, v := range groups {
+				if pattern != nil {
+					if ok, err := pattern.MatchString(v.GroupName); err != nil {
 						return err
+					} else if !ok {
+						continue
 					}
-					dw.Write([]byte(fmt.Sprintf("%s %d %d y"+protocol.CRLF, v.GroupName, highWaterMark, lowWaterMark)))
-				} else {
-					dw.Write([]byte(fmt.Sprintf("%s 0 1 y"+protocol.CRLF, v.GroupName)))
 				}
+				if ok, err := h.canRead(s, &v.Group); err != nil {
+					return err
+				} else if !ok {
+					continue
+				}
+
+				dw.Write([]byte(activeLine(&v) + protocol.CRLF))
 			}
 			return dw.Close()
 		}
@@ -133,13 +204,17 @@ func (h *Handler) handleList(s *Session, command string, arguments []string, id
 			var groups []models.Group
 			var err error
 			if len(arguments) == 2 {
-				groups, err = h.backend.ListGroupsByPattern(arguments[1])
+				groups, err = h.backend.ListGroupsByPattern(s.ctx, arguments[1])
 			} else {
-				groups, err = h.backend.ListGroups()
+				groups, err = h.backend.ListGroups(s.ctx)
 			}
 			if err != nil {
 				return err
 			}
+			groups, err = h.visibleGroups(s, groups)
+			if err != nil {
+				return err
+			}
 
 			dw.Write([]byte(protocol.NNTPResponse{Code: 215, Message: "list of newsgroups follows"}.String() + protocol.CRLF))
 			for _, v := range groups {
@@ -165,6 +240,9 @@ func (h *Handler) handleList(s *Session, command string, arguments []string, id
 			dw.Write([]byte("References:" + protocol.CRLF))
 			dw.Write([]byte(":bytes" + protocol.CRLF))
 			dw.Write([]byte(":lines" + protocol.CRLF))
+			for _, v := range h.overviewHeaders {
+				dw.Write([]byte(v + ":full" + protocol.CRLF))
+			}
 
 			return dw.Close()
 		}
@@ -175,11 +253,15 @@ func (h *Handler) handleList(s *Session, command string, arguments []string, id
 	}
 }
 
-func (h *Handler) handleModeReader(s *Session, command string, arguments []string, id uint) error {
+func (h *Handler) handleMode(s *Session, command string, arguments []string, id uint) error {
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
 
-	if len(arguments) == 0 || arguments[0] != "READER" {
+	if len(arguments) == 1 && strings.ToUpper(arguments[0]) == "STREAM" && h.allowIHave {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 203, Message: "Streaming permitted"}.String())
+	}
+
+	if len(arguments) == 0 || strings.ToUpper(arguments[0]) != "READER" {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
@@ -189,7 +271,10 @@ func (h *Handler) handleModeReader(s *Session, command string, arguments []strin
 	(&s.capabilities).Add(protocol.Capability{Type: protocol.ListCapability, Params: "ACTIVE NEWSGROUPS OVERVIEW.FMT"})
 	s.mode = SessionModeReader
 
-	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 201, Message: "Reader mode, posting prohibited"}.String()) // TODO vary on auth status
+	if postInReaderMode {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 200, Message: "Reader mode, posting permitted"}.String())
+	}
+	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 201, Message: "Reader mode, posting prohibited"}.String())
 }
 
 func (h *Handler) handleGroup(s *Session, command string, arguments []string, id uint) error {
@@ -200,7 +285,7 @@ func (h *Handler) handleGroup(s *Session, command string, arguments []string, id
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	g, err := h.backend.GetGroup(arguments[0])
+	g, err := h.backend.GetGroup(s.ctx, arguments[0])
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 411, Message: "No such newsgroup"}.String())
@@ -208,23 +293,29 @@ func (h *Handler) handleGroup(s *Session, command string, arguments []string, id
 			return err
 		}
 	}
-	highWaterMark, err := h.backend.GetGroupHighWaterMark(&g)
+	if ok, err := h.canRead(s, &g); err != nil {
+		return err
+	} else if !ok {
+		return s.tconn.PrintfLine(accessDenied(s))
+	}
+	highWaterMark, err := h.backend.GetGroupHighWaterMark(s.ctx, &g)
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
-	lowWaterMark, err := h.backend.GetGroupLowWaterMark(&g)
+	lowWaterMark, err := h.backend.GetGroupLowWaterMark(s.ctx, &g)
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
-	articlesCount, err := h.backend.GetArticlesCount(&g)
+	articlesCount, err := h.backend.GetArticlesCountInRange(s.ctx, &g, int64(lowWaterMark), int64(highWaterMark))
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
 
 	s.currentGroup = &g
+	s.currentArticle = nil
 
 	if lowWaterMark != 0 {
-		a, err := h.backend.GetArticleByNumber(&g, lowWaterMark)
+		a, err := h.backend.GetArticleByNumber(s.ctx, &g, lowWaterMark)
 		if err != nil {
 			return err
 		}
@@ -238,6 +329,27 @@ func (h *Handler) handleGroup(s *Session, command string, arguments []string, id
 	}.String())
 }
 
+// parseDateTime parses the date and time arguments of NEWGROUPS and NEWNEWS (RFC 3977 §7.3.2),
+// they are in the server time zone unless followed by GMT
+func (h *Handler) parseDateTime(date, clock string, rest []string) (time.Time, bool) {
+	loc := h.location
+	if len(rest) == 1 {
+		if rest[0] != "GMT" {
+			return time.Time{}, false
+		}
+		loc = time.UTC
+	}
+
+	layout := "20060102 150405"
+	if len(date) == 6 {
+		layout = "060102 150405"
+	} else if len(date) != 8 {
+		return time.Time{}, false
+	}
+	t, err := time.ParseInLocation(layout, date+" "+clock, loc)
+	return t, err == nil
+}
+
 func (h *Handler) handleNewGroups(s *Session, command string, arguments []string, id uint) error {
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
@@ -246,64 +358,57 @@ func (h *Handler) handleNewGroups(s *Session, command string, arguments []string
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	dateString := arguments[0] + " " + arguments[1]
-	//isGMT := false
-	//if len(arguments) == 3 {
-	//	isGMT = true
-	//}
-
-	var date time.Time
-
-	var err error
-	if len(dateString) == 15 {
-		date, err = time.Parse("20060102 150405", dateString)
-		if err != nil {
-			return err
-		}
-	} else if len(dateString) == 13 {
-		date, err = time.Parse("060102 150405", dateString)
-		if err != nil {
-			return err
-		}
-	} else {
+	date, ok := h.parseDateTime(arguments[0], arguments[1], arguments[2:])
+	if !ok {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	g, err := h.backend.GetNewGroupsSince(date.Unix())
+	groups, err := h.backend.GetNewGroupsWithStatsSince(s.ctx, date.Unix())
 	if err != nil {
 		return err
 	}
 
 	dw := s.tconn.DotWriter()
 	dw.Write([]byte(protocol.NNTPResponse{Code: 231, Message: "list of new newsgroups follows"}.String() + protocol.CRLF))
-	for _, v := range g {
-		// TODO set actual post permission status
-		c, err := h.backend.GetArticlesCount(&v)
-		if err != nil {
+	for _, v := range groups {
+		if ok, err := h.canRead(s, &v.Group); err != nil {
 			return err
+		} else if !ok {
+			continue
 		}
-		if c > 0 {
-			highWaterMark, err := h.backend.GetGroupHighWaterMark(&v)
-			if err != nil {
-				return err
-			}
-			lowWaterMark, err := h.backend.GetGroupLowWaterMark(&v)
-			if err != nil {
-				return err
-			}
-			dw.Write([]byte(fmt.Sprintf("%s %d %d n"+protocol.CRLF, v.GroupName, highWaterMark, lowWaterMark)))
-		} else {
-			dw.Write([]byte(fmt.Sprintf("%s 0 1 n"+protocol.CRLF, v.GroupName)))
-		}
+		dw.Write([]byte(activeLine(&v) + protocol.CRLF))
 	}
 
 	return dw.Close()
 }
 
+// activeLine formats the group in the format of LIST ACTIVE and NEWGROUPS responses (RFC 3977 §7.6.3)
+func activeLine(g *models.GroupStats) string {
+	status := backend.DefaultPostingStatus(g.Moderated, g.PostingStatus)
+	if g.Moderated && status == models.PostingAllowed {
+		status = models.PostingModerated
+	}
+	// empty groups are reported with high water mark one less than the low one (RFC 3977 §6.1.1.2)
+	if g.ArticleCount == 0 {
+		return fmt.Sprintf("%s 0 1 %s", g.GroupName, status)
+	}
+	return fmt.Sprintf("%s %d %d %s", g.GroupName, g.HighWaterMark, g.LowWaterMark, status)
+}
+
 func (h *Handler) handlePost(s *Session, command string, arguments []string, id uint) error {
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
 
+	if s.mode == SessionModeReader && !postInReaderMode || s.readOnly {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 440, Message: "Posting not permitted"}.String())
+	}
+
+	if h.postLimiter != nil {
+		if ok, retryAfter := h.postLimiter.Allow(s.remoteAddr); !ok {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 400, Message: fmt.Sprintf("Posting rate limit exceeded, retry after %d seconds", int(math.Ceil(retryAfter.Seconds())))}.String())
+		}
+	}
+
 	if len(arguments) != 0 {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
@@ -312,13 +417,30 @@ func (h *Handler) handlePost(s *Session, command string, arguments []string, id
 		return err
 	}
 
-	dr := s.tconn.DotReader()
+	envelope, reason, err := h.readArticle(s)
+	if err != nil {
+		return err
+	}
+	if reason != "" {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 441, Message: reason}.String())
+	}
 
-	envelope, err := enmime.ReadEnvelope(dr)
+	a, reason, err := h.PostArticle(s.ctx, envelope, s.authUserID)
 	if err != nil {
 		return err
 	}
+	if reason != "" {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 441, Message: reason}.String())
+	}
+	slog.Info("Article saved", "remote_addr", s.remoteAddr, "command", command, "message_id", a.Header.Get("Message-ID"), "newsgroups", a.Header.Get("Newsgroups"))
+
+	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 240, Message: "Article received OK"}.String())
+}
 
+// PostArticle stamps the article posted by the user with the server headers and saves it.
+// Posts to moderated groups are mailed to the moderator instead, if it has an address.
+// Reason is set if the article has been rejected.
+func (h *Handler) PostArticle(ctx context.Context, envelope *enmime.Envelope, userID int64) (models.Article, string, error) {
 	// generate message id
 	messageID := fmt.Sprintf("<%s@%s>", uuid.New().String(), h.serverDomain)
 	envelope.SetHeader("Message-ID", []string{messageID})
@@ -329,32 +451,412 @@ func (h *Handler) handlePost(s *Session, command string, arguments []string, id
 	// set date header
 	envelope.AddHeader("Date", time.Now().UTC().Format(time.RFC1123Z))
 
-	headerJson, err := json.Marshal(envelope.Root.Header)
+	a, reason, err := h.buildArticle(ctx, envelope, true)
 	if err != nil {
+		return a, "", err
+	}
+	if reason != "" {
+		return a, reason, nil
+	}
+	if err := validation.ValidateArticle(&a, h.allowControl); err != nil {
+		return a, err.Error(), nil
+	}
+
+	newsgroups := strings.Split(a.Header.Get("Newsgroups"), ",")
+	for _, v := range newsgroups {
+		ok, err := h.backend.CanPost(ctx, userID, v)
+		if err != nil {
+			return a, "", err
+		}
+		if !ok {
+			return a, fmt.Sprintf("posting to %s is not permitted", v), nil
+		}
+	}
+
+	if userID != 0 {
+		a.UserID = sql.NullInt64{Int64: userID, Valid: true}
+	}
+	if reason, err := h.checkControl(ctx, &a, userID); err != nil || reason != "" {
+		return a, reason, err
+	}
+
+	approved, err := h.isApproved(ctx, &a, newsgroups, userID)
+	if err != nil {
+		return a, "", err
+	}
+	if !approved {
+		if forwarded, err := h.forwardToModerator(ctx, &a, newsgroups); err != nil || forwarded {
+			return a, "", err
+		}
+	}
+
+	// the article is saved along with the injected headers and the approval, or not at all
+	tx, err := h.backend.BeginTx(ctx)
+	if err != nil {
+		return a, "", err
+	}
+	defer tx.Rollback()
+
+	if err := tx.SaveArticle(ctx, a, newsgroups); err != nil {
+		return a, err.Error(), nil
+	}
+	// the injecting agent records when the article has entered the network (RFC 5537 §3.5)
+	injected := map[string][]string{"Injection-Date": {time.Now().UTC().Format(time.RFC1123Z)}}
+	if err := h.injectHeaders(ctx, tx, &a, injected); err != nil {
+		return a, "", err
+	}
+	if approved {
+		if err := tx.ModerateArticle(ctx, a.Header.Get("Message-ID"), true, a.Header.Get("Approved")); err != nil {
+			return a, "", err
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		return a, "", err
+	}
+
+	if err := h.processControl(ctx, &a); err != nil {
+		return a, "", err
+	}
+
+	metrics.ArticlesPostedTotal.Inc()
+
+	return a, "", nil
+}
+
+// checkControl makes sure the user may issue the control message, reason is set if it's rejected.
+// Only cancel is supported, it's allowed to the authenticated user who has posted the cancelled article
+// and to moderators of its groups. From isn't checked, anyone can copy it.
+func (h *Handler) checkControl(ctx context.Context, a *models.Article, userID int64) (string, error) {
+	if a.Header.Get("Control") == "" {
+		return "", nil
+	}
+	control := strings.Fields(a.Header.Get("Control"))
+	if len(control) != 2 || !strings.EqualFold(control[0], "cancel") {
+		return "unsupported control message", nil
+	}
+
+	target, err := h.backend.GetArticle(ctx, control[1])
+	if err != nil {
+		if err == sql.ErrNoRows {
+			// nothing to cancel
+			return "", nil
+		}
+		return "", err
+	}
+	if target.UserID.Valid && target.UserID.Int64 == userID {
+		return "", nil
+	}
+	for _, v := range strings.Split(target.Header.Get("Newsgroups"), ",") {
+		ok, err := h.backend.IsModerator(ctx, userID, strings.TrimSpace(v))
+		if err != nil {
+			return "", err
+		}
+		if ok {
+			return "", nil
+		}
+	}
+	return fmt.Sprintf("cancelling %s is not permitted", control[1]), nil
+}
+
+// processControl executes the control message of the saved article (RFC 1036 §3.4)
+func (h *Handler) processControl(ctx context.Context, a *models.Article) error {
+	control := strings.Fields(a.Header.Get("Control"))
+	if len(control) != 2 || !strings.EqualFold(control[0], "cancel") {
+		return nil
+	}
+
+	if err := h.backend.DeleteArticle(ctx, control[1]); err != nil {
+		if err == sql.ErrNoRows {
+			return nil
+		}
 		return err
 	}
+	slog.Info("Article cancelled", "message_id", control[1], "cancelled_by", a.Header.Get("Message-ID"))
+	return nil
+}
 
-	a := models.Article{}
-	a.HeaderRaw = string(headerJson)
-	a.Header = envelope.Root.Header
-	a.Envelope = envelope
+func (h *Handler) handleIHave(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	if !h.allowIHave {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 502, Message: "Transit service not permitted"}.String())
+	}
 
+	if len(arguments) != 1 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+	messageID := arguments[0]
+
+	if exists, err := h.backend.HasArticle(s.ctx, messageID); err != nil {
+		return err
+	} else if exists {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 435, Message: "Article not wanted"}.String())
+	}
+
+	if err := s.tconn.PrintfLine(protocol.NNTPResponse{Code: 335, Message: "Send article to be transferred"}.String()); err != nil {
+		return err
+	}
+
+	envelope, reason, err := h.readArticle(s)
 	if err != nil {
 		return err
 	}
+	if reason != "" {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 437, Message: reason}.String())
+	}
+
+	if envelope.GetHeader("Message-ID") == "" {
+		envelope.SetHeader("Message-ID", []string{messageID})
+	} else if envelope.GetHeader("Message-ID") != messageID {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 437, Message: "Message-ID doesn't match"}.String())
+	}
+
+	code, message, err := h.saveTransitArticle(s.ctx, envelope)
+	if err != nil {
+		return err
+	}
+	if code == 0 {
+		slog.Info("Article saved", "remote_addr", s.remoteAddr, "command", command, "message_id", messageID)
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 235, Message: "Article transferred OK"}.String())
+	}
+	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: code, Message: message}.String())
+}
+
+// saveTransitArticle saves the article received from a peer into the local groups it's posted to.
+// Articles with the Approved header are shown in moderated groups right away.
+// Zero code is returned on success, 437 if the article is rejected and 436 if its transfer should be retried.
+func (h *Handler) saveTransitArticle(ctx context.Context, envelope *enmime.Envelope) (int, string, error) {
+	// prepend ourselves to the path (RFC 5537 §3.2.1)
+	if p := envelope.GetHeader("Path"); p != "" {
+		envelope.SetHeader("Path", []string{fmt.Sprintf("%s!%s", h.serverDomain, p)})
+	} else {
+		envelope.SetHeader("Path", []string{fmt.Sprintf("%s!not-for-mail", h.serverDomain)})
+	}
+
+	a, reason, err := h.buildArticle(ctx, envelope, false)
+	if err != nil {
+		return 0, "", err
+	}
+	if reason != "" {
+		return 437, reason, nil
+	}
+
+	// groups which don't exist here are skipped
+	var newsgroups []string
+	for _, v := range strings.Split(a.Header.Get("Newsgroups"), ",") {
+		v = strings.TrimSpace(v)
+		if _, err := h.backend.GetGroup(ctx, v); err == nil {
+			newsgroups = append(newsgroups, v)
+		} else if err != sql.ErrNoRows {
+			return 0, "", err
+		}
+	}
+	if len(newsgroups) == 0 {
+		return 437, "No wanted newsgroups", nil
+	}
+
+	tx, err := h.backend.BeginTx(ctx)
+	if err != nil {
+		return 0, "", err
+	}
+	defer tx.Rollback()
+
+	if err := tx.SaveArticle(ctx, a, newsgroups); err != nil {
+		if err == backend.ErrArticleExists {
+			return 437, "Duplicate article", nil
+		}
+		return 436, err.Error(), nil
+	}
+	if err := h.injectHeaders(ctx, tx, &a, nil); err != nil {
+		return 0, "", err
+	}
+	// peers relay posts to moderated groups only once the moderator has approved them
+	if a.Header.Get("Approved") != "" {
+		if err := tx.ModerateArticle(ctx, a.Header.Get("Message-ID"), true, a.Header.Get("Approved")); err != nil {
+			return 0, "", err
+		}
+	}
+	return 0, "", tx.Commit()
+}
+
+// injectHeaders adds the fields and the Received trace of this server to the saved article, both to the stored
+// header and to a.Header. Received is prepended to the ones set by the previous servers.
+func (h *Handler) injectHeaders(ctx context.Context, b backend.StorageBackend, a *models.Article, fields map[string][]string) error {
+	injected := map[string][]string{
+		"Received": append([]string{fmt.Sprintf("by %s with NNTP; %s", h.serverDomain, time.Now().UTC().Format(time.RFC1123Z))}, a.Header.Values("Received")...),
+	}
+	for k, v := range fields {
+		injected[k] = v
+	}
+
+	if err := b.UpdateArticleHeader(ctx, a.Header.Get("Message-ID"), injected); err != nil {
+		return err
+	}
+	for k, v := range injected {
+		a.Header[textproto.CanonicalMIMEHeaderKey(k)] = v
+	}
+	return nil
+}
+
+// handleCheck handles CHECK command of the streaming extension (RFC 4644 §2.4)
+func (h *Handler) handleCheck(s *Session, command string, arguments []string, id uint) error {
+	if !h.allowIHave || len(arguments) != 1 {
+		s.tconn.StartResponse(id)
+		defer s.tconn.EndResponse(id)
+		if !h.allowIHave {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 502, Message: "Transit service not permitted"}.String())
+		}
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+	messageID := arguments[0]
+
+	s.stream(func() {
+		s.tconn.StartResponse(id)
+		defer s.tconn.EndResponse(id)
+
+		exists, err := h.backend.HasArticle(s.ctx, messageID)
+		switch {
+		case err != nil:
+			slog.Error("Failed to look up article", "remote_addr", s.remoteAddr, "command", command, "message_id", messageID, "error", err)
+			err = s.tconn.PrintfLine(protocol.NNTPResponse{Code: 431, Message: messageID}.String())
+		case exists:
+			err = s.tconn.PrintfLine(protocol.NNTPResponse{Code: 438, Message: messageID}.String())
+		default:
+			err = s.tconn.PrintfLine(protocol.NNTPResponse{Code: 238, Message: messageID}.String())
+		}
+		if err != nil {
+			slog.Warn("Failed to write response", "remote_addr", s.remoteAddr, "command", command, "error", err)
+		}
+	})
+	return nil
+}
+
+// handleTakeThis handles TAKETHIS command of the streaming extension (RFC 4644 §2.5).
+// The article is read here, but it's parsed and saved by the streaming worker.
+func (h *Handler) handleTakeThis(s *Session, command string, arguments []string, id uint) error {
+	if len(arguments) != 1 {
+		s.tconn.StartResponse(id)
+		defer s.tconn.EndResponse(id)
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+	messageID := arguments[0]
+
+	// the article is sent without waiting for response, so it must be read in any case
+	raw, reason, err := h.readRawArticle(s)
+	if err != nil {
+		return err
+	}
+
+	if !h.allowIHave {
+		s.tconn.StartResponse(id)
+		defer s.tconn.EndResponse(id)
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 502, Message: "Transit service not permitted"}.String())
+	}
+
+	s.stream(func() {
+		s.tconn.StartResponse(id)
+		defer s.tconn.EndResponse(id)
+
+		code := 439
+		if reason == "" {
+			var err error
+			code, reason, err = h.takeArticle(s.ctx, raw, messageID)
+			if err != nil {
+				slog.Error("Failed to save article", "remote_addr", s.remoteAddr, "command", command, "message_id", messageID, "error", err)
+				code = 439
+			}
+		}
+		if reason != "" {
+			slog.Info("Rejected article", "remote_addr", s.remoteAddr, "command", command, "message_id", messageID, "reason", reason)
+		} else if code == 239 {
+			slog.Info("Article saved", "remote_addr", s.remoteAddr, "command", command, "message_id", messageID)
+		}
+		if err := s.tconn.PrintfLine(protocol.NNTPResponse{Code: code, Message: messageID}.String()); err != nil {
+			slog.Warn("Failed to write response", "remote_addr", s.remoteAddr, "command", command, "error", err)
+		}
+	})
+	return nil
+}
+
+// takeArticle saves the article received by TAKETHIS, returning 239 code if it's accepted and 439 if it isn't
+func (h *Handler) takeArticle(ctx context.Context, raw []byte, messageID string) (int, string, error) {
+	envelope, err := enmime.ReadEnvelope(bytes.NewReader(raw))
+	if err != nil {
+		return 439, err.Error(), nil
+	}
+	if envelope.GetHeader("Message-ID") != messageID {
+		return 439, "Message-ID doesn't match", nil
+	}
+
+	code, reason, err := h.saveTransitArticle(ctx, envelope)
+	if err != nil {
+		return 0, "", err
+	}
+	if code != 0 {
+		return 439, reason, nil
+	}
+	return 239, "", nil
+}
+
+// readArticle reads the article sent by client, reason is set if the article has to be rejected
+func (h *Handler) readArticle(s *Session) (*enmime.Envelope, string, error) {
+	raw, reason, err := h.readRawArticle(s)
+	if err != nil || reason != "" {
+		return nil, reason, err
+	}
+
+	envelope, err := enmime.ReadEnvelope(bytes.NewReader(raw))
+	if err != nil {
+		return nil, "", err
+	}
+	return envelope, "", nil
+}
+
+// readRawArticle reads the article sent by client without parsing it
+func (h *Handler) readRawArticle(s *Session) ([]byte, string, error) {
+	dr := s.tconn.DotReader()
+	lr := &articleSizeLimiter{r: dr, limit: h.maxArticleSize}
+
+	raw, err := ioutil.ReadAll(lr)
+	if lr.exceeded {
+		// skip the rest of the article to keep the connection usable
+		if _, err := io.Copy(ioutil.Discard, dr); err != nil {
+			return nil, "", err
+		}
+		return nil, fmt.Sprintf("Article exceeds maximum size of %d bytes", h.maxArticleSize), nil
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	return raw, "", nil
+}
+
+// buildArticle makes the article from the envelope, resolving its thread and saving the attachments.
+// If requireParent is set, replies to unknown articles are rejected, otherwise they start a new thread.
+func (h *Handler) buildArticle(ctx context.Context, envelope *enmime.Envelope, requireParent bool) (models.Article, string, error) {
+	headerJson, err := json.Marshal(envelope.Root.Header)
+	if err != nil {
+		return models.Article{}, "", err
+	}
+
+	a := models.Article{}
+	a.HeaderRaw = string(headerJson)
+	a.Header = envelope.Root.Header
+	a.Envelope = envelope
 	a.Body = envelope.Text
 
 	// set thread property
 	if envelope.GetHeader("In-Reply-To") != "" {
-		parentMessage, err := h.backend.GetArticle(envelope.GetHeader("In-Reply-To"))
-		if err != nil {
-			if err == sql.ErrNoRows {
-				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 441, Message: "no such message you are replying to"}.String())
-			} else {
-				return err
-			}
+		parentMessage, err := h.backend.GetArticle(ctx, envelope.GetHeader("In-Reply-To"))
+		if err != nil && err != sql.ErrNoRows {
+			return a, "", err
 		}
-		if !parentMessage.Thread.Valid {
+		if err == sql.ErrNoRows {
+			if requireParent {
+				return a, "no such message you are replying to", nil
+			}
+		} else if !parentMessage.Thread.Valid {
 			var parentHeader mail.Header
 			err = json.Unmarshal([]byte(parentMessage.HeaderRaw), &parentHeader)
 			parentMessageID := parentHeader.Get("Message-ID")
@@ -368,28 +870,42 @@ func (h *Handler) handlePost(s *Session, command string, arguments []string, id
 		// save attachments
 		for _, v := range envelope.Attachments {
 			if v.ContentType != "image/jpeg" && v.ContentType != "image/png" && v.ContentType != "image/gif" {
-				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 441, Message: "disallowed attachment type"}.String())
+				return a, "disallowed attachment type", nil
 			}
 			ext_ := strings.Split(v.FileName, ".")
 			ext := ext_[len(ext_)-1]
 			fileName := uuid.New().String() + "." + ext
 			err = ioutil.WriteFile(path.Join(h.uploadPath, fileName), v.Content, 0644)
 			if err != nil {
-				return err
+				return a, "", err
 			}
 			a.Attachments = append(a.Attachments, models.Attachment{
 				ContentType: v.ContentType,
 				FileName:    fileName,
+				Content:     v.Content,
 			})
 		}
 	}
 
-	err = h.backend.SaveArticle(a, strings.Split(a.Header.Get("Newsgroups"), ","))
-	if err != nil {
-		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 441, Message: err.Error()}.String())
-	}
+	return a, "", nil
+}
 
-	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 240, Message: "Article received OK"}.String())
+// articleSizeLimiter fails reading once more than limit bytes have been read, zero limit disables the check
+type articleSizeLimiter struct {
+	r        io.Reader
+	limit    int64
+	read     int64
+	exceeded bool
+}
+
+func (l *articleSizeLimiter) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	l.read += int64(n)
+	if l.limit > 0 && l.read > l.limit {
+		l.exceeded = true
+		return 0, fmt.Errorf("article exceeds %d bytes", l.limit)
+	}
+	return n, err
 }
 
 func (h *Handler) handleListgroup(s *Session, command string, arguments []string, id uint) error {
@@ -399,13 +915,13 @@ func (h *Handler) handleListgroup(s *Session, command string, arguments []string
 	currentGroup := s.currentGroup
 	var low, high int64
 	if len(arguments) == 1 {
-		g, err := h.backend.GetGroup(arguments[0])
+		g, err := h.backend.GetGroup(s.ctx, arguments[0])
 		if err != nil {
 			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 411, Message: "No such newsgroup"}.String())
 		}
 		currentGroup = &g
 	} else if len(arguments) == 2 {
-		g, err := h.backend.GetGroup(arguments[0])
+		g, err := h.backend.GetGroup(s.ctx, arguments[0])
 		if err != nil {
 			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 411, Message: "No such newsgroup"}.String())
 		}
@@ -413,37 +929,55 @@ func (h *Handler) handleListgroup(s *Session, command string, arguments []string
 
 		low, high, err = utils.ParseRange(arguments[1])
 		if err != nil {
-			low = 0
-			high = 0
+			return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 		}
 		if high != -1 && low > high {
 			low = -1
 			high = -1
 		}
+	} else if len(arguments) > 2 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
 	if currentGroup == nil {
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 412, Message: "No newsgroup selected"}.String())
 	}
 
-	highWaterMark, err := h.backend.GetGroupHighWaterMark(currentGroup)
+	if ok, err := h.canRead(s, currentGroup); err != nil {
+		return err
+	} else if !ok {
+		return s.tconn.PrintfLine(accessDenied(s))
+	}
+
+	highWaterMark, err := h.backend.GetGroupHighWaterMark(s.ctx, currentGroup)
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
-	lowWaterMark, err := h.backend.GetGroupLowWaterMark(currentGroup)
+	lowWaterMark, err := h.backend.GetGroupLowWaterMark(s.ctx, currentGroup)
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
-	articlesCount, err := h.backend.GetArticlesCount(currentGroup)
+	articlesCount, err := h.backend.GetArticlesCount(s.ctx, currentGroup)
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
 
-	nums, err := h.backend.GetArticleNumbers(currentGroup, low, high)
+	nums, err := h.backend.GetArticleNumbers(s.ctx, currentGroup, low, high)
 	if err != nil && err != sql.ErrNoRows {
 		return err
 	}
 
+	// the group is selected and the current article is set to its first one regardless of the range (RFC 3977 §6.1.2)
+	s.currentGroup = currentGroup
+	s.currentArticle = nil
+	if lowWaterMark != 0 {
+		a, err := h.backend.GetArticleByNumber(s.ctx, currentGroup, lowWaterMark)
+		if err != nil {
+			return err
+		}
+		s.currentArticle = &a
+	}
+
 	dw := s.tconn.DotWriter()
 	dw.Write([]byte(protocol.NNTPResponse{Code: 211, Message: fmt.Sprintf("%d %d %d %s list follows%s", articlesCount, lowWaterMark, highWaterMark, currentGroup.GroupName, protocol.CRLF)}.String()))
 	for _, v := range nums {
@@ -456,20 +990,13 @@ func (h *Handler) handleArticle(s *Session, command string, arguments []string,
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
 
-	var err error
-	getByArticleNum := true
-	if len(arguments) == 0 {
-		if s.currentArticle == nil {
-			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 420, Message: "No current article selected"}.String())
-		}
-		getByArticleNum = false
-	}
-
 	if len(arguments) > 1 {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
+	var err error
 	var num int
+	getByArticleNum := len(arguments) == 1
 	if getByArticleNum {
 		num, err = strconv.Atoi(arguments[0])
 		if err != nil {
@@ -477,14 +1004,37 @@ func (h *Handler) handleArticle(s *Session, command string, arguments []string,
 		}
 	}
 
+	// article number 0 refers to the current article, the same as no argument,
+	// unless legacy clients expecting the latest one are served
+	latest := h.legacyMode && getByArticleNum && num == 0
+	useCurrent := len(arguments) == 0 || (getByArticleNum && num == 0 && !latest)
+	if useCurrent {
+		if s.currentArticle == nil {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 420, Message: "No current article selected"}.String())
+		}
+		getByArticleNum = false
+	}
+
 	if getByArticleNum && s.currentGroup == nil {
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 412, Message: "No newsgroup selected"}.String())
 	}
 
 	var a *models.Article
 
+	// HEAD doesn't need the body, so it isn't fetched, and BODY fetches it without parsing the headers
+	headersOnly := command == protocol.CommandHead
+	bodyOnly := command == protocol.CommandBody
+
 	if getByArticleNum {
-		article, err := h.backend.GetArticleByNumber(s.currentGroup, num)
+		var article models.Article
+		if latest {
+			article, err = h.backend.GetLatestArticle(s.ctx, s.currentGroup)
+			num = article.ArticleNumber
+		} else if headersOnly || bodyOnly {
+			article, err = h.backend.GetArticleHeadersByNumber(s.ctx, s.currentGroup, num)
+		} else {
+			article, err = h.backend.GetArticleByNumber(s.ctx, s.currentGroup, num)
+		}
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No article with that number"}.String())
@@ -494,8 +1044,41 @@ func (h *Handler) handleArticle(s *Session, command string, arguments []string,
 		}
 		a = &article
 		s.currentArticle = &article
-	} else if len(arguments) > 0 {
-		article, err := h.backend.GetArticle(arguments[0])
+		if bodyOnly && !latest {
+			// the current article is kept without the body, the same way as if it was selected by HEAD
+			body, err := h.backend.GetArticleBodyOnlyByNumber(s.ctx, s.currentGroup, num)
+			if err != nil {
+				return err
+			}
+			withBody := article
+			withBody.Body = string(body)
+			a = &withBody
+		}
+	} else if !useCurrent {
+		// articles of the groups which the session can't read are reported as missing
+		if ok, err := h.canReadArticle(s, arguments[0]); err != nil {
+			return err
+		} else if !ok {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No Such Article Found"}.String())
+		}
+		var article models.Article
+		var err error
+		if s.currentGroup != nil {
+			// the number is reported relative to the current group, it's zero for articles of the other groups
+			num, err = h.backend.GetArticleNumberForMessageID(s.ctx, s.currentGroup, arguments[0])
+			if err == backend.ErrNotInGroup {
+				num, err = 0, nil
+			}
+		}
+		if err == nil && headersOnly {
+			article, err = h.backend.GetArticleHeaders(s.ctx, arguments[0])
+		} else if err == nil && bodyOnly {
+			var body []byte
+			body, err = h.backend.GetArticleBodyOnly(s.ctx, arguments[0])
+			article = models.Article{Header: textproto.MIMEHeader{"Message-Id": {arguments[0]}}, Body: string(body)}
+		} else if err == nil {
+			article, err = h.backend.GetArticle(s.ctx, arguments[0])
+		}
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No Such Article Found"}.String())
@@ -503,11 +1086,27 @@ func (h *Handler) handleArticle(s *Session, command string, arguments []string,
 				return err
 			}
 		}
+		// selecting by message-id doesn't change the current article (RFC 3977 §6.2.1.2)
 		a = &article
-		s.currentArticle = &article
 	} else {
 		a = s.currentArticle
 		num = s.currentArticle.ArticleNumber
+		// current article could have been selected by HEAD
+		if bodyOnly && s.currentGroup != nil && a.Body == "" {
+			body, err := h.backend.GetArticleBodyOnlyByNumber(s.ctx, s.currentGroup, num)
+			if err != nil {
+				return err
+			}
+			article := *a
+			article.Body = string(body)
+			a = &article
+		} else if !headersOnly && s.currentGroup != nil && a.Body == "" {
+			article, err := h.backend.GetArticleByNumber(s.ctx, s.currentGroup, num)
+			if err != nil {
+				return err
+			}
+			a = &article
+		}
 	}
 
 	switch command {
@@ -583,37 +1182,78 @@ func (h *Handler) handleArticle(s *Session, command string, arguments []string,
 
 			return dw.Close()
 		}
-	case protocol.CommandStat:
-		{
+	}
+
+	return nil
+}
+
+// handleStat checks the article existence without fetching its headers and body (RFC 3977 §6.2.4)
+func (h *Handler) handleStat(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	if len(arguments) > 1 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+
+	if len(arguments) == 1 {
+		num, err := strconv.Atoi(arguments[0])
+		if err != nil {
+			// selecting by message-id doesn't change the current article
+			num, ok, err := h.backend.ArticleExists(s.ctx, s.currentGroup, arguments[0])
+			if err != nil {
+				return err
+			}
+			if ok {
+				if ok, err = h.canReadArticle(s, arguments[0]); err != nil {
+					return err
+				}
+			}
+			if !ok {
+				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No Such Article Found"}.String())
+			}
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 223, Message: fmt.Sprintf("%d %s", num, arguments[0])}.String())
+		}
+
+		if num != 0 || h.legacyMode {
+			if s.currentGroup == nil {
+				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 412, Message: "No newsgroup selected"}.String())
+			}
+			var a models.Article
+			if num == 0 {
+				// legacy clients refer to the latest article this way
+				a, err = h.backend.GetLatestArticle(s.ctx, s.currentGroup)
+				num = a.ArticleNumber
+			} else {
+				a, err = h.backend.GetArticleHeadersByNumber(s.ctx, s.currentGroup, num)
+			}
+			if err != nil {
+				if err == sql.ErrNoRows {
+					return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No article with that number"}.String())
+				}
+				return err
+			}
+			s.currentArticle = &a
 			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 223, Message: fmt.Sprintf("%d %s", num, a.Header.Get("Message-ID"))}.String())
 		}
 	}
 
-	return nil
+	// article number 0 refers to the current article outside of legacy mode, the same as no argument
+	if s.currentArticle == nil {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 420, Message: "No current article selected"}.String())
+	}
+	return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 223, Message: fmt.Sprintf("%d %s", s.currentArticle.ArticleNumber, s.currentArticle.Header.Get("Message-ID"))}.String())
 }
 
 func (h *Handler) handleHelp(s *Session, command string, arguments []string, id uint) error {
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
 
-	help :=
-		"  ARTICLE [message-ID|number]\r\n" +
-			"  BODY [message-ID|number]\r\n" +
-			"  CAPABILITIES [keyword]\r\n" +
-			"  DATE\r\n" +
-			"  GROUP newsgroup\r\n" +
-			"  HEAD [message-ID|number]\r\n" +
-			"  HELP\r\n" +
-			"  LAST\r\n" +
-			"  LIST [ACTIVE [wildmat]|NEWSGROUPS [wildmat]]\r\n" +
-			"  LISTGROUP [newsgroup [range]]\r\n" +
-			"  MODE READER\r\n" +
-			"  NEWGROUPS [yy]yymmdd hhmmss [GMT]\r\n" +
-			"  NEWNEWS [yy]yymmdd hhmmss [GMT]\r\n" +
-			"  NEXT\r\n" +
-			"  POST\r\n" +
-			"  QUIT\r\n" +
-			"  STAT [message-ID|number]\r\n"
+	commands := make([]string, 0, len(h.handlers))
+	for k := range h.handlers {
+		commands = append(commands, k)
+	}
+	sort.Strings(commands)
 
 	dw := s.tconn.DotWriter()
 	w := bufio.NewWriter(dw)
@@ -623,9 +1263,14 @@ func (h *Handler) handleHelp(s *Session, command string, arguments []string, id
 		return err
 	}
 
-	_, err = w.Write([]byte(help))
-	if err != nil {
-		return err
+	for _, v := range commands {
+		line := "  " + v
+		if usage, ok := commandUsages[v]; ok {
+			line += " " + usage
+		}
+		if _, err := w.Write([]byte(line + protocol.CRLF)); err != nil {
+			return err
+		}
 	}
 
 	err = w.Flush()
@@ -640,40 +1285,40 @@ func (h *Handler) handleNewNews(s *Session, command string, arguments []string,
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
 
-	if len(arguments) < 2 || len(arguments) > 3 {
+	if len(arguments) < 3 || len(arguments) > 4 {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	dateString := arguments[0] + " " + arguments[1]
-
-	var date time.Time
-
-	var err error
-	if len(dateString) == 15 {
-		date, err = time.Parse("20060102 150405", dateString)
-		if err != nil {
-			return err
-		}
-	} else if len(dateString) == 13 {
-		date, err = time.Parse("060102 150405", dateString)
-		if err != nil {
-			return err
-		}
-	} else {
+	date, ok := h.parseDateTime(arguments[1], arguments[2], arguments[3:])
+	if !ok {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	a, err := h.backend.GetNewArticlesSince(date.Unix())
+	// the articles are listed only from the groups which the session can read
+	groups, err := h.backend.ListGroupsByPattern(s.ctx, arguments[0])
 	if err != nil {
 		return err
 	}
+	if groups, err = h.visibleGroups(s, groups); err != nil {
+		return err
+	}
+	var messageIDs []string
+	if len(groups) != 0 {
+		names := make([]string, 0, len(groups))
+		for _, v := range groups {
+			names = append(names, v.GroupName)
+		}
+		if messageIDs, err = h.backend.GetNewArticlesSince(s.ctx, date.Unix(), names); err != nil {
+			return err
+		}
+	}
 
 	dw := s.tconn.DotWriter()
 	_, err = dw.Write([]byte(protocol.NNTPResponse{Code: 230, Message: "list of new articles by message-id follows"}.String() + protocol.CRLF))
 	if err != nil {
 		return err
 	}
-	for _, v := range a {
+	for _, v := range messageIDs {
 		_, err = dw.Write([]byte(v + protocol.CRLF))
 		if err != nil {
 			return err
@@ -699,7 +1344,7 @@ func (h *Handler) handleLast(s *Session, command string, arguments []string, id
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 420, Message: "No current article selected"}.String())
 	}
 
-	low, err := h.backend.GetGroupLowWaterMark(s.currentGroup)
+	low, err := h.backend.GetGroupLowWaterMark(s.ctx, s.currentGroup)
 	if err != nil {
 		return err
 	}
@@ -708,7 +1353,7 @@ func (h *Handler) handleLast(s *Session, command string, arguments []string, id
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 422, Message: "No previous article to retrieve"}.String())
 	}
 
-	a, err := h.backend.GetLastArticleByNum(s.currentGroup, s.currentArticle)
+	a, err := h.backend.GetLastArticleByNum(s.ctx, s.currentGroup, s.currentArticle)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 422, Message: "No previous article to retrieve"}.String())
@@ -737,7 +1382,7 @@ func (h *Handler) handleNext(s *Session, command string, arguments []string, id
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 420, Message: "No current article selected"}.String())
 	}
 
-	high, err := h.backend.GetGroupHighWaterMark(s.currentGroup)
+	high, err := h.backend.GetGroupHighWaterMark(s.ctx, s.currentGroup)
 	if err != nil {
 		return err
 	}
@@ -746,7 +1391,7 @@ func (h *Handler) handleNext(s *Session, command string, arguments []string, id
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 421, Message: "No next article to retrieve"}.String())
 	}
 
-	a, err := h.backend.GetNextArticleByNum(s.currentGroup, s.currentArticle)
+	a, err := h.backend.GetNextArticleByNum(s.ctx, s.currentGroup, s.currentArticle)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 421, Message: "No next article to retrieve"}.String())
@@ -786,7 +1431,7 @@ func (h *Handler) handleOver(s *Session, command string, arguments []string, id
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	var articles []models.Article
+	var overview []models.Overview
 
 	if byRange {
 		if s.currentGroup == nil {
@@ -800,16 +1445,21 @@ func (h *Handler) handleOver(s *Session, command string, arguments []string, id
 		if low > high {
 			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "Empty range"}.String())
 		}
-		a, err := h.backend.GetArticlesByRange(s.currentGroup, low, high)
+		o, err := h.backend.GetOverviewByRange(s.ctx, s.currentGroup, low, high, h.overviewHeaders)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No articles in that range"}.String())
 			}
 			return err
 		}
-		articles = append(articles, a...)
+		overview = append(overview, o...)
 	} else if byMsgID {
-		a, err := h.backend.GetArticle(arguments[0])
+		if ok, err := h.canReadArticle(s, arguments[0]); err != nil {
+			return err
+		} else if !ok {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No such article with that message-id"}.String())
+		}
+		a, err := h.backend.GetArticleHeaders(s.ctx, arguments[0])
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No such article with that message-id"}.String())
@@ -817,59 +1467,176 @@ func (h *Handler) handleOver(s *Session, command string, arguments []string, id
 			return err
 		}
 		a.ArticleNumber = 0
-		articles = append(articles, a)
+		o, err := h.storedArticleOverview(s, &a)
+		if err != nil {
+			return err
+		}
+		overview = append(overview, o)
 	} else if byNum {
 		num, _ := strconv.Atoi(arguments[0])
-		a, err := h.backend.GetArticleByNumber(s.currentGroup, num)
+		a, err := h.backend.GetArticleHeadersByNumber(s.ctx, s.currentGroup, num)
 		if err != nil {
 			if err == sql.ErrNoRows {
 				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No such article in this group"}.String())
 			}
 			return err
 		}
-		articles = append(articles, a)
+		o, err := h.storedArticleOverview(s, &a)
+		if err != nil {
+			return err
+		}
+		overview = append(overview, o)
 	} else if curArticle {
-		articles = append(articles, *s.currentArticle)
+		// the current article may be loaded without its body, e.g. by STAT
+		o, err := h.storedArticleOverview(s, s.currentArticle)
+		if err != nil {
+			return err
+		}
+		overview = append(overview, o)
 	}
 
 	dw := s.tconn.DotWriter()
 	dw.Write([]byte(protocol.NNTPResponse{Code: 224, Message: "Overview information follows" + protocol.CRLF}.String()))
-	for _, v := range articles {
+	for _, v := range overview {
 		dw.Write([]byte(strconv.Itoa(v.ArticleNumber) + "	"))
-		dw.Write([]byte(v.Header.Get("Subject") + "	"))
-		dw.Write([]byte(v.Header.Get("From") + "	"))
-		dw.Write([]byte(v.Header.Get("Date") + "	"))
-		dw.Write([]byte(v.Header.Get("Message-ID") + "	"))
-		dw.Write([]byte(v.Header.Get("References") + "	"))
-
-		// count bytes for message
-		builder := utils.Builder()
-		for k, v := range v.Header {
-			for _, j := range v {
-				builder = builder.Header(k, j)
-			}
-		}
-		builder = builder.Text([]byte(v.Body)) // FIXME currently only plain text is supported
-		b := bytes.NewBuffer([]byte{})
-		p, err := builder.Build()
-		if err != nil {
+		dw.Write([]byte(v.Subject + "	"))
+		dw.Write([]byte(v.From + "	"))
+		dw.Write([]byte(v.Date + "	"))
+		dw.Write([]byte(v.MessageID + "	"))
+		dw.Write([]byte(v.References + "	"))
+		dw.Write([]byte(strconv.Itoa(v.Bytes) + "	"))
+		dw.Write([]byte(strconv.Itoa(v.Lines)))
+		for i, k := range h.overviewHeaders {
+			if i < len(v.Extra) && v.Extra[i] != "" {
+				dw.Write([]byte("	" + k + ": " + v.Extra[i]))
+			} else {
+				dw.Write([]byte("	"))
+			}
+		}
+		dw.Write([]byte(protocol.CRLF))
+	}
+
+	return dw.Close()
+}
+
+// articleOverview computes overview fields the same way as backend does for ranges
+func (h *Handler) articleOverview(a *models.Article) models.Overview {
+	o := models.Overview{
+		ArticleNumber: a.ArticleNumber,
+		Subject:       a.Header.Get("Subject"),
+		From:          a.Header.Get("From"),
+		Date:          a.Header.Get("Date"),
+		MessageID:     a.Header.Get("Message-ID"),
+		References:    a.Header.Get("References"),
+		Bytes:         a.WireSize(),
+		Lines:         strings.Count(a.Body, "\n"),
+	}
+	for _, v := range h.overviewHeaders {
+		o.Extra = append(o.Extra, a.Header.Get(v))
+	}
+	return o
+}
+
+// storedArticleOverview computes overview fields of the article fetched without its body, leaving the counting to the backend
+func (h *Handler) storedArticleOverview(s *Session, a *models.Article) (models.Overview, error) {
+	lines, err := h.backend.GetArticleLineCount(s.ctx, int64(a.ID))
+	if err != nil {
+		return models.Overview{}, err
+	}
+	bytes, err := h.backend.GetArticleByteCount(s.ctx, int64(a.ID))
+	if err != nil {
+		return models.Overview{}, err
+	}
+
+	o := h.articleOverview(a)
+	o.Bytes = bytes
+	o.Lines = lines
+	return o, nil
+}
+
+// handleXhdr returns a single header of the articles (RFC 2980 §2.6)
+func (h *Handler) handleXhdr(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	if len(arguments) < 1 || len(arguments) > 2 || !backend.IsValidHeaderName(arguments[0]) {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+	field := arguments[0]
+
+	var lines []string
+	if len(arguments) == 2 && strings.ContainsAny(arguments[1], "<>") {
+		if ok, err := h.canReadArticle(s, arguments[1]); err != nil {
 			return err
+		} else if !ok {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No such article with that message-id"}.String())
 		}
-		err = p.Encode(b)
+		a, err := h.backend.GetArticleHeaders(s.ctx, arguments[1])
 		if err != nil {
+			if err == sql.ErrNoRows {
+				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 430, Message: "No such article with that message-id"}.String())
+			}
 			return err
 		}
+		lines = append(lines, arguments[1]+" "+xhdrValue(a.Header.Get(field)))
+	} else {
+		if s.currentGroup == nil {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 412, Message: "No newsgroup selected"}.String())
+		}
 
-		bytesMetadata := b.Len()
-		linesMetadata := strings.Count(v.Body, "\n")
+		var low, high int64
+		if len(arguments) == 1 {
+			if s.currentArticle == nil {
+				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 420, Message: "No current article selected"}.String())
+			}
+			low, high = int64(s.currentArticle.ArticleNumber), int64(s.currentArticle.ArticleNumber)
+		} else {
+			var err error
+			low, high, err = utils.ParseRange(arguments[1])
+			if err != nil {
+				return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+			}
+			if low == -1 {
+				// single article number
+				low = high
+			}
+			if high == -1 {
+				high = math.MaxInt64
+			}
+		}
 
-		dw.Write([]byte(strconv.Itoa(bytesMetadata) + "	"))
-		dw.Write([]byte(strconv.Itoa(linesMetadata) + protocol.CRLF))
+		fields, err := h.backend.GetHeaderFieldByRange(s.ctx, s.currentGroup, field, low, high)
+		if err != nil {
+			return err
+		}
+		if len(fields) == 0 {
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 423, Message: "No articles in that range"}.String())
+		}
+		for _, v := range fields {
+			lines = append(lines, strconv.Itoa(v.ArticleNumber)+" "+xhdrValue(v.Value))
+		}
 	}
 
+	dw := s.tconn.DotWriter()
+	if _, err := dw.Write([]byte(protocol.NNTPResponse{Code: 221, Message: field + " fields follow"}.String() + protocol.CRLF)); err != nil {
+		return err
+	}
+	for _, v := range lines {
+		if _, err := dw.Write([]byte(v + protocol.CRLF)); err != nil {
+			return err
+		}
+	}
 	return dw.Close()
 }
 
+// xhdrValue replaces the missing header value with the placeholder used by XHDR
+func xhdrValue(v string) string {
+	if v == "" {
+		return "(none)"
+	}
+	return v
+}
+
 func (h *Handler) handleNewThreads(s *Session, command string, arguments []string, id uint) error {
 	s.tconn.StartResponse(id)
 	defer s.tconn.EndResponse(id)
@@ -878,7 +1645,7 @@ func (h *Handler) handleNewThreads(s *Session, command string, arguments []strin
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 412, Message: "no newsgroup selected"}.String())
 	}
 
-	if len(arguments) == 0 {
+	if len(arguments) != 2 {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
@@ -886,12 +1653,13 @@ func (h *Handler) handleNewThreads(s *Session, command string, arguments []strin
 	if err != nil {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
+	// pages are numbered from 1
 	pageNum, err := strconv.Atoi(arguments[1])
-	if err != nil {
+	if err != nil || pageNum < 1 {
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	threadNums, err := h.backend.GetNewThreads(s.currentGroup, perPage, pageNum)
+	threadNums, err := h.backend.GetNewThreads(s.ctx, s.currentGroup, perPage, pageNum)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return err
@@ -923,7 +1691,7 @@ func (h *Handler) handleThread(s *Session, command string, arguments []string, i
 		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
 	}
 
-	threadNums, err := h.backend.GetThread(s.currentGroup, threadNumber)
+	threadNums, err := h.backend.GetThread(s.ctx, s.currentGroup, threadNumber)
 	if err != nil {
 		if err != sql.ErrNoRows {
 			return err
@@ -938,6 +1706,167 @@ func (h *Handler) handleThread(s *Session, command string, arguments []string, i
 	return dw.Close()
 }
 
+func (h *Handler) handleAuthInfo(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+	defer s.tconn.EndResponse(id)
+
+	if len(arguments) < 2 {
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+
+	if s.authenticated {
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 502, Message: "Command unavailable"}.String())
+	}
+
+	switch strings.ToUpper(arguments[0]) {
+	case "USER":
+		{
+			s.authUsername = arguments[1]
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 381, Message: "Password required"}.String())
+		}
+	case "PASS":
+		{
+			if s.authUsername == "" {
+				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 482, Message: "Authentication commands issued out of sequence"}.String())
+			}
+
+			password := strings.Join(arguments[1:], " ")
+			if h.jwtValidator != nil && strings.Count(password, ".") == 2 {
+				ok, err := h.authenticateJWT(s, password)
+				if err != nil {
+					return err
+				}
+				if ok {
+					return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 281, Message: "Authentication accepted"}.String())
+				}
+				// not a valid token, it may be a password which looks like one
+			}
+
+			ok, err := h.backend.AuthenticateUser(s.ctx, s.authUsername, password)
+			if err != nil {
+				return err
+			}
+			if !ok {
+				s.authUsername = ""
+				return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 481, Message: "Authentication failed"}.String())
+			}
+
+			userID, err := h.backend.GetUserID(s.ctx, s.authUsername)
+			if err != nil {
+				return err
+			}
+
+			s.authUserID = userID
+			s.authenticated = true
+			(&s.capabilities).Remove(protocol.AuthInfoCapability)
+			return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 281, Message: "Authentication accepted"}.String())
+		}
+	default:
+		{
+			return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+		}
+	}
+}
+
+// authenticateJWT authenticates the session with the token whose subject is the AUTHINFO USER name.
+// Subjects without a local account get the permissions of anonymous users, but may read groups requiring authentication.
+func (h *Handler) authenticateJWT(s *Session, token string) (bool, error) {
+	claims, err := h.jwtValidator.ValidateJWT(token)
+	if err != nil {
+		slog.Debug("Token is rejected", "username", s.authUsername, "error", err)
+		return false, nil
+	}
+	if claims.Subject != s.authUsername {
+		return false, nil
+	}
+
+	userID, err := h.backend.GetUserID(s.ctx, claims.Subject)
+	if err != nil && err != sql.ErrNoRows {
+		return false, err
+	}
+
+	s.authUserID = userID
+	s.authenticated = true
+	s.readOnly = !claims.HasScope(auth.ScopePost)
+	(&s.capabilities).Remove(protocol.AuthInfoCapability)
+	return true, nil
+}
+
+func (h *Handler) handleStartTLS(s *Session, command string, arguments []string, id uint) error {
+	s.tconn.StartResponse(id)
+
+	if h.tlsConfig == nil || s.tls || s.authenticated {
+		defer s.tconn.EndResponse(id)
+		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 502, Message: "Command unavailable"}.String())
+	}
+
+	if len(arguments) != 0 {
+		defer s.tconn.EndResponse(id)
+		return s.tconn.PrintfLine(protocol.ErrSyntaxError.String())
+	}
+
+	err := s.tconn.PrintfLine(protocol.NNTPResponse{Code: 382, Message: "Continue with TLS negotiation"}.String())
+	// response must be finished on the plaintext connection before it's replaced
+	s.tconn.EndResponse(id)
+	if err != nil {
+		return err
+	}
+
+	tlsConn := tls.Server(s.conn, h.tlsConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		return err
+	}
+	s.upgradeTLS(tlsConn)
+	(&s.capabilities).Remove(protocol.StartTLSCapability)
+
+	return nil
+}
+
+// visibleGroups filters out the groups which the session isn't allowed to read
+func (h *Handler) visibleGroups(s *Session, groups []models.Group) ([]models.Group, error) {
+	var res []models.Group
+	for _, v := range groups {
+		ok, err := h.canRead(s, &v)
+		if err != nil {
+			return nil, err
+		}
+		if ok {
+			res = append(res, v)
+		}
+	}
+	return res, nil
+}
+
+// canRead checks both the group auth requirement and the group permissions of the session user
+func (h *Handler) canRead(s *Session, g *models.Group) (bool, error) {
+	if g.RequiresAuth && !s.authenticated {
+		return false, nil
+	}
+	return h.backend.CanRead(s.ctx, s.authUserID, g.GroupName)
+}
+
+// canReadArticle checks whether the session may read any of the groups the article is shown in, it's false for unknown articles
+func (h *Handler) canReadArticle(s *Session, messageID string) (bool, error) {
+	groups, err := h.backend.GetArticleGroups(s.ctx, messageID)
+	if err != nil {
+		return false, err
+	}
+	for _, v := range groups {
+		if ok, err := h.canRead(s, &v); err != nil || ok {
+			return ok, err
+		}
+	}
+	return false, nil
+}
+
+// accessDenied returns the response for a group which the session isn't allowed to access
+func accessDenied(s *Session) string {
+	if !s.authenticated {
+		return protocol.NNTPResponse{Code: 480, Message: "Authentication required"}.String()
+	}
+	return protocol.NNTPResponse{Code: 502, Message: "Access denied"}.String()
+}
+
 func (h *Handler) Handle(s *Session, message string, id uint) error {
 	splittedMessage := strings.Split(message, " ")
 	for i, v := range splittedMessage {
@@ -946,9 +1875,21 @@ func (h *Handler) Handle(s *Session, message string, id uint) error {
 	cmdName := splittedMessage[0]
 	handler, ok := h.handlers[cmdName]
 	if !ok {
+		metrics.CommandsTotal.WithLabelValues("unknown").Inc()
 		s.tconn.StartResponse(id)
 		defer s.tconn.EndResponse(id)
 		return s.tconn.PrintfLine(protocol.NNTPResponse{Code: 500, Message: "Unknown command"}.String())
 	}
-	return handler(s, cmdName, splittedMessage[1:], id)
+
+	start := time.Now()
+	err := handler(s, cmdName, splittedMessage[1:], id)
+	duration := time.Since(start)
+	metrics.CommandsTotal.WithLabelValues(cmdName).Inc()
+	metrics.CommandDuration.WithLabelValues(cmdName).Observe(duration.Seconds())
+	if err != nil {
+		slog.Error("Command failed", "remote_addr", s.remoteAddr, "command", cmdName, "duration_ms", duration.Milliseconds(), "error", err)
+	} else {
+		slog.Debug("Command processed", "remote_addr", s.remoteAddr, "command", cmdName, "duration_ms", duration.Milliseconds())
+	}
+	return err
 }
@@ -0,0 +1,556 @@
+//go:build sqlite_fts5
+
+package server
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/backend/sqlite"
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/metrics"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/jhillyerd/enmime"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+// newTestHandler serves a fresh in-memory database with the groups created
+func newTestHandler(t *testing.T, groups ...string) *Handler {
+	t.Helper()
+	return newTestHandlerWithConfig(t, config.Config{Domain: "news.example.com"}, groups...)
+}
+
+func newTestHandlerWithConfig(t *testing.T, cfg config.Config, groups ...string) *Handler {
+	t.Helper()
+	name := strings.NewReplacer("/", "_", " ", "_").Replace(t.Name())
+	b, err := sqlite.NewSQLiteBackend(config.SQLiteBackendConfig{Path: "file:" + name + "?mode=memory&cache=shared"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { b.Close() })
+	for _, v := range groups {
+		if err := b.CreateGroup(context.Background(), v, "", false, "y"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return NewHandler(b, cfg, nil, nil, nil)
+}
+
+// newTestSession connects a client to a session served by h, the greeting is already read
+func newTestSession(t *testing.T, h *Handler) *textproto.Conn {
+	t.Helper()
+	c, _ := newLimitedTestSession(t, h, 0)
+	return c
+}
+
+// newLimitedTestSession is newTestSession with the byte limit, closed is done once the session ends
+func newLimitedTestSession(t *testing.T, h *Handler, maxBytes int64) (*textproto.Conn, <-chan bool) {
+	t.Helper()
+	server, client := net.Pipe()
+	closed := make(chan bool)
+	if _, err := NewSession(context.Background(), server, "pipe", (&NNTPServer{}).sessionCapabilities(false), t.Name(), closed, h, time.Minute, maxBytes); err != nil {
+		t.Fatal(err)
+	}
+	c := textproto.NewConn(client)
+	t.Cleanup(func() {
+		c.Close()
+		<-closed
+	})
+	if _, _, err := c.ReadCodeLine(201); err != nil {
+		t.Fatal(err)
+	}
+	return c, closed
+}
+
+// testCommand sends the command and returns the response line, expecting the code
+func testCommand(t *testing.T, c *textproto.Conn, code int, command string) string {
+	t.Helper()
+	if err := c.PrintfLine("%s", command); err != nil {
+		t.Fatal(err)
+	}
+	_, message, err := c.ReadCodeLine(code)
+	if err != nil {
+		t.Fatalf("%s: %v", command, err)
+	}
+	return message
+}
+
+func readTestEnvelope(t *testing.T, article string) *enmime.Envelope {
+	t.Helper()
+	envelope, err := enmime.ReadEnvelope(strings.NewReader(strings.ReplaceAll(article, "\n", "\r\n")))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return envelope
+}
+
+func TestPostArticleInjectsHeaders(t *testing.T) {
+	h := newTestHandler(t, "test.group")
+	ctx := context.Background()
+
+	envelope := readTestEnvelope(t, "From: poster@example.com\nNewsgroups: test.group\nSubject: injected\nReceived: by client.example.com; Thu, 01 Jan 2026 00:00:00 +0000\n\nhello\n")
+	a, reason, err := h.PostArticle(ctx, envelope, 0)
+	if err != nil || reason != "" {
+		t.Fatalf("PostArticle() = %q, %v", reason, err)
+	}
+
+	stored, err := h.backend.GetArticle(ctx, a.Header.Get("Message-ID"))
+	if err != nil {
+		t.Fatalf("GetArticle() error = %v", err)
+	}
+	if stored.Header.Get("Injection-Date") == "" {
+		t.Error("Injection-Date isn't stored")
+	}
+	received := stored.Header.Values("Received")
+	if len(received) != 2 || !strings.HasPrefix(received[0], "by news.example.com with NNTP; ") || received[1] != "by client.example.com; Thu, 01 Jan 2026 00:00:00 +0000" {
+		t.Errorf("stored Received = %q, want this server prepended to the client one", received)
+	}
+	if got := stored.Header.Get("Path"); got != "news.example.com!not-for-mail" {
+		t.Errorf("stored Path = %q", got)
+	}
+	if stored.Header.Get("Injection-Date") != a.Header.Get("Injection-Date") {
+		t.Errorf("returned Injection-Date = %q, stored %q", a.Header.Get("Injection-Date"), stored.Header.Get("Injection-Date"))
+	}
+}
+
+func TestSaveTransitArticleInjectsReceived(t *testing.T) {
+	h := newTestHandler(t, "test.group")
+	ctx := context.Background()
+
+	envelope := readTestEnvelope(t, "Message-ID: <transit@peer.example.com>\nPath: peer.example.com!not-for-mail\nFrom: poster@example.com\nNewsgroups: test.group\nSubject: transit\nDate: Thu, 01 Jan 2026 00:00:00 +0000\n\nhello\n")
+	if code, message, err := h.saveTransitArticle(ctx, envelope); err != nil || code != 0 {
+		t.Fatalf("saveTransitArticle() = %d %q, %v", code, message, err)
+	}
+
+	stored, err := h.backend.GetArticle(ctx, "<transit@peer.example.com>")
+	if err != nil {
+		t.Fatalf("GetArticle() error = %v", err)
+	}
+	if received := stored.Header.Values("Received"); len(received) != 1 || !strings.HasPrefix(received[0], "by news.example.com with NNTP; ") {
+		t.Errorf("stored Received = %q", received)
+	}
+	// only the injecting agent sets it
+	if stored.Header.Get("Injection-Date") != "" {
+		t.Errorf("transit article got Injection-Date %q", stored.Header.Get("Injection-Date"))
+	}
+	if got := stored.Header.Get("Path"); got != "news.example.com!peer.example.com!not-for-mail" {
+		t.Errorf("stored Path = %q", got)
+	}
+}
+
+func TestSaveTransitArticleApproved(t *testing.T) {
+	h := newTestHandler(t)
+	ctx := context.Background()
+	if err := h.backend.CreateGroup(ctx, "test.moderated", "", true, "m"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, v := range []string{"<held@peer.example.com>", "<approved@peer.example.com>"} {
+		article := "Message-ID: " + v + "\nPath: peer.example.com!not-for-mail\nFrom: poster@example.com\nNewsgroups: test.moderated\nSubject: transit\nDate: Thu, 01 Jan 2026 00:00:00 +0000\n"
+		if v == "<approved@peer.example.com>" {
+			article += "Approved: moderator@example.com\n"
+		}
+		if code, message, err := h.saveTransitArticle(ctx, readTestEnvelope(t, article+"\nhello\n")); err != nil || code != 0 {
+			t.Fatalf("saveTransitArticle(%s) = %d %q, %v", v, code, message, err)
+		}
+	}
+
+	if _, err := h.backend.GetArticle(ctx, "<held@peer.example.com>"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("GetArticle() of the unapproved article error = %v, want sql.ErrNoRows", err)
+	}
+	stored, err := h.backend.GetArticle(ctx, "<approved@peer.example.com>")
+	if err != nil {
+		t.Fatalf("GetArticle() of the approved article error = %v", err)
+	}
+	if !stored.Approved || stored.ApprovedBy.String != "moderator@example.com" {
+		t.Errorf("stored approval = %v by %q", stored.Approved, stored.ApprovedBy.String)
+	}
+}
+
+func TestUpdateGroupPosting(t *testing.T) {
+	h := newTestHandler(t, "test.group")
+	ctx := context.Background()
+	c := newTestSession(t, h)
+
+	listActive := func() []string {
+		t.Helper()
+		testCommand(t, c, 215, "LIST ACTIVE test.group")
+		lines, err := c.ReadDotLines()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lines
+	}
+
+	if lines := listActive(); len(lines) != 1 || lines[0] != "test.group 0 1 y" {
+		t.Fatalf("LIST ACTIVE = %q before the update", lines)
+	}
+	if err := h.backend.UpdateGroupPosting(ctx, "test.group", models.PostingModerated[0]); err != nil {
+		t.Fatalf("UpdateGroupPosting() error = %v", err)
+	}
+	if lines := listActive(); len(lines) != 1 || lines[0] != "test.group 0 1 m" {
+		t.Errorf("LIST ACTIVE = %q after the update", lines)
+	}
+	if message := testCommand(t, c, 211, "GROUP test.group"); message != "0 0 0 test.group" {
+		t.Errorf("GROUP = %q after the update", message)
+	}
+
+	if err := h.backend.UpdateGroupPosting(ctx, "test.group", 'x'); !errors.Is(err, backend.ErrInvalidStatus) {
+		t.Errorf("UpdateGroupPosting('x') error = %v, want ErrInvalidStatus", err)
+	}
+	if err := h.backend.UpdateGroupPosting(ctx, "no.such.group", 'n'); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("UpdateGroupPosting() of a missing group error = %v, want sql.ErrNoRows", err)
+	}
+}
+
+func TestPostArticleCancel(t *testing.T) {
+	h := newTestHandler(t, "test.group")
+	h.allowControl = true
+	ctx := context.Background()
+
+	users := map[string]int64{}
+	for _, v := range []string{"poster", "other", "moderator"} {
+		if err := h.backend.CreateUser(ctx, v, "secret"); err != nil {
+			t.Fatal(err)
+		}
+		id, err := h.backend.GetUserID(ctx, v)
+		if err != nil {
+			t.Fatal(err)
+		}
+		role := models.RolePoster
+		if v == "moderator" {
+			role = models.RoleModerator
+		}
+		if err := h.backend.SetPermission(ctx, id, "test.group", role); err != nil {
+			t.Fatal(err)
+		}
+		users[v] = id
+	}
+
+	post := func(article, user string) (models.Article, string) {
+		t.Helper()
+		a, reason, err := h.PostArticle(ctx, readTestEnvelope(t, article), users[user])
+		if err != nil {
+			t.Fatalf("PostArticle() error = %v", err)
+		}
+		return a, reason
+	}
+	cancel := func(from, messageID, user string) string {
+		t.Helper()
+		_, reason := post("From: "+from+"\nNewsgroups: test.group\nSubject: cmsg cancel "+messageID+"\nControl: cancel "+messageID+"\n\ncancel\n", user)
+		return reason
+	}
+	first, _ := post("From: poster@example.com\nNewsgroups: test.group\nSubject: first\n\nhello\n", "poster")
+	second, _ := post("From: poster@example.com\nNewsgroups: test.group\nSubject: second\n\nhello\n", "poster")
+	firstID, secondID := first.Header.Get("Message-ID"), second.Header.Get("Message-ID")
+
+	// From is copied from the article, but another user has posted the cancel
+	if reason := cancel("Poster <poster@example.com>", firstID, "other"); reason == "" {
+		t.Fatal("cancel by another user with the copied From is accepted")
+	}
+	if _, err := h.backend.GetArticle(ctx, firstID); err != nil {
+		t.Fatalf("GetArticle() of the article after the rejected cancel error = %v", err)
+	}
+	if reason := cancel("another-address@example.com", firstID, "poster"); reason != "" {
+		t.Fatalf("cancel by the poster is rejected: %s", reason)
+	}
+	if reason := cancel("moderator@example.com", secondID, "moderator"); reason != "" {
+		t.Fatalf("cancel by the moderator is rejected: %s", reason)
+	}
+
+	for _, v := range []string{firstID, secondID} {
+		if _, err := h.backend.GetArticle(ctx, v); !errors.Is(err, sql.ErrNoRows) {
+			t.Errorf("GetArticle() of the cancelled article error = %v, want sql.ErrNoRows", err)
+		}
+	}
+	g, err := h.backend.GetGroup(ctx, "test.group")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// only the cancel messages themselves are left as the articles 3 and 4
+	if low, err := h.backend.GetGroupLowWaterMark(ctx, &g); err != nil || low != 3 {
+		t.Errorf("GetGroupLowWaterMark() = %d, %v, want 3", low, err)
+	}
+	if high, err := h.backend.GetGroupHighWaterMark(ctx, &g); err != nil || high != 4 {
+		t.Errorf("GetGroupHighWaterMark() = %d, %v, want 4", high, err)
+	}
+	if count, err := h.backend.GetArticlesCount(ctx, &g); err != nil || count != 2 {
+		t.Errorf("GetArticlesCount() = %d, %v, want 2", count, err)
+	}
+}
+
+func TestMessageIDAccess(t *testing.T) {
+	h := newTestHandler(t, "test.group", "test.private")
+	ctx := context.Background()
+	if err := h.backend.CreateUser(ctx, "member", "secret"); err != nil {
+		t.Fatal(err)
+	}
+	member, err := h.backend.GetUserID(ctx, "member")
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the group is closed to everyone else once it has permissions
+	if err := h.backend.SetPermission(ctx, member, "test.private", models.RolePoster); err != nil {
+		t.Fatal(err)
+	}
+
+	post := func(newsgroups string) string {
+		t.Helper()
+		a, reason, err := h.PostArticle(ctx, readTestEnvelope(t, "From: member@example.com\nNewsgroups: "+newsgroups+"\nSubject: access\n\nhello\n"), member)
+		if err != nil || reason != "" {
+			t.Fatalf("PostArticle() = %q, %v", reason, err)
+		}
+		return a.Header.Get("Message-ID")
+	}
+	private := post("test.private")
+	crossPosted := post("test.private,test.group")
+
+	c := newTestSession(t, h)
+	for _, v := range []struct {
+		command string
+		code    int
+	}{{"ARTICLE", 220}, {"HEAD", 221}, {"BODY", 222}, {"STAT", 223}, {"OVER", 224}, {"XHDR Subject", 221}} {
+		testCommand(t, c, 430, v.command+" "+private)
+		// it's readable in the other group
+		testCommand(t, c, v.code, v.command+" "+crossPosted)
+		if v.command != "STAT" {
+			if _, err := c.ReadDotLines(); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	testCommand(t, c, 230, "NEWNEWS test.* 19700101 000000")
+	lines, err := c.ReadDotLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 || lines[0] != crossPosted {
+		t.Errorf("NEWNEWS = %q, want only the cross-posted article", lines)
+	}
+}
+
+func TestArticleByMessageIDInOtherGroup(t *testing.T) {
+	h := newTestHandler(t, "test.one", "test.two")
+	ctx := context.Background()
+	a, reason, err := h.PostArticle(ctx, readTestEnvelope(t, "From: poster@example.com\nNewsgroups: test.two\nSubject: other\n\nhello\n"), 0)
+	if err != nil || reason != "" {
+		t.Fatalf("PostArticle() = %q, %v", reason, err)
+	}
+	messageID := a.Header.Get("Message-ID")
+
+	c := newTestSession(t, h)
+	testCommand(t, c, 211, "GROUP test.one")
+	for _, v := range []struct {
+		command string
+		code    int
+	}{{"ARTICLE", 220}, {"HEAD", 221}, {"BODY", 222}} {
+		// the article isn't in the selected group, so it has no number there
+		if got := testCommand(t, c, v.code, v.command+" "+messageID); !strings.HasPrefix(got, "0 "+messageID) {
+			t.Errorf("%s response = %q, want number 0", v.command, got)
+		}
+		if _, err := c.ReadDotLines(); err != nil {
+			t.Fatal(err)
+		}
+		testCommand(t, c, 430, v.command+" <missing@example.com>")
+	}
+}
+
+func TestListOverviewFmt(t *testing.T) {
+	h := newTestHandlerWithConfig(t, config.Config{Domain: "news.example.com", OverviewFmt: config.OverviewFmtConfig{ExtraHeaders: []string{"x-spam-status"}}}, "test.group")
+	envelope := readTestEnvelope(t, "From: poster@example.com\nNewsgroups: test.group\nSubject: overview\nX-Spam-Status: No, score=0.1\n\nhello\nworld\n")
+	if _, reason, err := h.PostArticle(context.Background(), envelope, 0); err != nil || reason != "" {
+		t.Fatalf("PostArticle() = %q, %v", reason, err)
+	}
+	c := newTestSession(t, h)
+
+	testCommand(t, c, 215, "LIST OVERVIEW.FMT")
+	fields, err := c.ReadDotLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"Subject:", "From:", "Date:", "Message-ID:", "References:", ":bytes", ":lines", "X-Spam-Status:full"}
+	if strings.Join(fields, "\n") != strings.Join(want, "\n") {
+		t.Fatalf("LIST OVERVIEW.FMT = %q, want %q", fields, want)
+	}
+
+	// every OVER line has the article number followed by the listed fields
+	testCommand(t, c, 211, "GROUP test.group")
+	testCommand(t, c, 224, "OVER 1")
+	lines, err := c.ReadDotLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) != 1 {
+		t.Fatalf("OVER returned %d lines, want 1", len(lines))
+	}
+	values := strings.Split(lines[0], "\t")
+	if len(values) != len(fields)+1 {
+		t.Fatalf("OVER line has %d fields, want %d: %q", len(values), len(fields)+1, lines[0])
+	}
+	if values[0] != "1" || values[1] != "overview" || values[2] != "poster@example.com" || values[7] != "2" {
+		t.Errorf("OVER line = %q", lines[0])
+	}
+	if values[8] != "X-Spam-Status: No, score=0.1" {
+		t.Errorf("extra OVER field = %q, want the full header", values[8])
+	}
+}
+
+func TestOverviewBytes(t *testing.T) {
+	h := newTestHandler(t, "test.group")
+	// the article is already plain text MIME, so ARTICLE sends the stored header without adding any
+	envelope := readTestEnvelope(t, "From: poster@example.com\nNewsgroups: test.group\nSubject: bytes\nMIME-Version: 1.0\nContent-Type: text/plain; charset=utf-8\n\nhello\n.dots\nlast\n")
+	a, reason, err := h.PostArticle(context.Background(), envelope, 0)
+	if err != nil || reason != "" {
+		t.Fatalf("PostArticle() = %q, %v", reason, err)
+	}
+	stored, err := h.backend.GetArticle(context.Background(), a.Header.Get("Message-ID"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.ByteCount != stored.WireSize() {
+		t.Errorf("stored byte_count = %d, WireSize() = %d", stored.ByteCount, stored.WireSize())
+	}
+	c := newTestSession(t, h)
+
+	// :bytes counts every line with its CRLF, but neither the dot-stuffing nor the terminating line
+	testCommand(t, c, 211, "GROUP test.group")
+	testCommand(t, c, 220, "ARTICLE 1")
+	lines, err := c.ReadDotLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := 0
+	for _, v := range lines {
+		size += len(v) + 2
+	}
+
+	for _, command := range []string{"OVER 1", "OVER " + a.Header.Get("Message-ID")} {
+		testCommand(t, c, 224, command)
+		lines, err := c.ReadDotLines()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(lines) != 1 {
+			t.Fatalf("%s returned %d lines, want 1", command, len(lines))
+		}
+		if bytes := strings.Split(lines[0], "\t")[6]; bytes != strconv.Itoa(size) {
+			t.Errorf("%s :bytes = %s, want the ARTICLE size %d", command, bytes, size)
+		}
+	}
+}
+
+func TestHelp(t *testing.T) {
+	h := newTestHandler(t)
+	c := newTestSession(t, h)
+
+	testCommand(t, c, 100, "HELP")
+	lines, err := c.ReadDotLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	listed := map[string]string{}
+	for _, v := range lines {
+		fields := strings.Fields(v)
+		if len(fields) == 0 {
+			t.Fatalf("empty HELP line in %q", lines)
+		}
+		listed[fields[0]] = v
+	}
+
+	// the commands of RFC 3977 which the server implements
+	for _, v := range []string{"ARTICLE", "BODY", "CAPABILITIES", "DATE", "GROUP", "HEAD", "HELP", "LAST", "LIST", "LISTGROUP", "MODE", "NEWGROUPS", "NEWNEWS", "NEXT", "OVER", "POST", "QUIT", "STAT"} {
+		if _, ok := listed[v]; !ok {
+			t.Errorf("HELP doesn't list %s", v)
+		}
+	}
+	// the list is built from the dispatch table
+	if len(listed) != len(h.handlers) {
+		t.Errorf("HELP lists %d commands, %d are registered", len(listed), len(h.handlers))
+	}
+	if got := listed["GROUP"]; strings.TrimSpace(got) != "GROUP newsgroup" {
+		t.Errorf("GROUP line = %q, want the usage", got)
+	}
+}
+
+func TestCapabilitiesModeReader(t *testing.T) {
+	c := newTestSession(t, newTestHandler(t))
+	capabilities := func() []string {
+		t.Helper()
+		testCommand(t, c, 101, "CAPABILITIES")
+		lines, err := c.ReadDotLines()
+		if err != nil {
+			t.Fatal(err)
+		}
+		return lines
+	}
+	has := func(lines []string, capability string) bool {
+		for _, v := range lines {
+			if v == capability || strings.HasPrefix(v, capability+" ") {
+				return true
+			}
+		}
+		return false
+	}
+
+	lines := capabilities()
+	if !has(lines, "MODE-READER") || has(lines, "READER") {
+		t.Errorf("capabilities before MODE READER = %q", lines)
+	}
+	if err := c.PrintfLine("MODE READER"); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ReadCodeLine(20); err != nil {
+		t.Fatal(err)
+	}
+	lines = capabilities()
+	if has(lines, "MODE-READER") || !has(lines, "READER") || !has(lines, "LIST ACTIVE NEWSGROUPS OVERVIEW.FMT") {
+		t.Errorf("capabilities after MODE READER = %q", lines)
+	}
+}
+
+func TestSessionByteLimit(t *testing.T) {
+	h := newTestHandler(t, "test.group")
+	c, closed := newLimitedTestSession(t, h, 4096)
+
+	// the session goes on under the limit
+	for i := 0; i < 10; i++ {
+		testCommand(t, c, 111, "DATE")
+	}
+	// the command crossing the limit is still completed
+	testCommand(t, c, 340, "POST")
+	dw := c.DotWriter()
+	dw.Write([]byte("From: poster@example.com\r\nNewsgroups: test.group\r\nSubject: large\r\n\r\n"))
+	for i := 0; i < 100; i++ {
+		dw.Write([]byte(strings.Repeat("x", 79) + "\r\n"))
+	}
+	if err := dw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ReadCodeLine(240); err != nil {
+		t.Fatalf("POST isn't completed: %v", err)
+	}
+	if _, message, err := c.ReadCodeLine(400); err != nil || message != "Session byte limit exceeded" {
+		t.Fatalf("session isn't closed on the byte limit: %s %v", message, err)
+	}
+	select {
+	case <-closed:
+	case <-time.After(5 * time.Second):
+		t.Fatal("session hasn't ended")
+	}
+
+	// the closed connection isn't counted as open anymore
+	for _, v := range []string{"in", "out"} {
+		if got := testutil.ToFloat64(metrics.ConnectionBytes.WithLabelValues(v)); got != 0 {
+			t.Errorf("open connection bytes %s = %v after the session has ended", v, got)
+		}
+	}
+}
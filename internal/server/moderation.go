@@ -0,0 +1,87 @@
+package server
+
+import (
+	"bytes"
+	"context"
+	"database/sql"
+	"github.com/ChronosX88/yans/internal/models"
+	"log/slog"
+	"net"
+	"net/smtp"
+	"strings"
+)
+
+// isApproved tells whether the article carries an Approved header (RFC 5537 §3.5.1) which can be trusted,
+// that is the user moderates every moderated group the article is posted to
+func (h *Handler) isApproved(ctx context.Context, a *models.Article, newsgroups []string, userID int64) (bool, error) {
+	if a.Header.Get("Approved") == "" {
+		return false, nil
+	}
+	for _, v := range newsgroups {
+		g, err := h.backend.GetGroup(ctx, strings.TrimSpace(v))
+		if err == sql.ErrNoRows {
+			continue // saving will fail anyway
+		} else if err != nil {
+			return false, err
+		}
+		if !g.Moderated {
+			continue
+		}
+		ok, err := h.backend.IsModerator(ctx, userID, g.GroupName)
+		if err != nil || !ok {
+			return false, err
+		}
+	}
+	return true, nil
+}
+
+// forwardToModerator mails the article to the moderator of the first moderated group it's posted to (RFC 1036 §4.2).
+// Nothing is sent if SMTP relay isn't configured or the group has no moderator address, such articles are held for approval instead.
+func (h *Handler) forwardToModerator(ctx context.Context, a *models.Article, newsgroups []string) (bool, error) {
+	if h.smtp.Address == "" {
+		return false, nil
+	}
+	for _, v := range newsgroups {
+		g, err := h.backend.GetGroup(ctx, strings.TrimSpace(v))
+		if err == sql.ErrNoRows {
+			continue // saving will fail anyway
+		} else if err != nil {
+			return false, err
+		}
+		if !g.Moderated {
+			continue
+		}
+
+		email, err := h.backend.GetGroupModeratorEmail(ctx, g.GroupName)
+		if err != nil {
+			return false, err
+		}
+		if email == "" {
+			return false, nil
+		}
+		if err := h.sendMail(email, a); err != nil {
+			return false, err
+		}
+		slog.Info("Article forwarded to moderator", "message_id", a.Header.Get("Message-ID"), "newsgroup", g.GroupName, "moderator", email)
+		return true, nil
+	}
+	return false, nil
+}
+
+func (h *Handler) sendMail(to string, a *models.Article) error {
+	var msg bytes.Buffer
+	msg.WriteString("To: " + to + "\r\n")
+	if err := a.Envelope.Root.Encode(&msg); err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if h.smtp.Username != "" {
+		host, _, err := net.SplitHostPort(h.smtp.Address)
+		if err != nil {
+			return err
+		}
+		auth = smtp.PlainAuth("", h.smtp.Username, h.smtp.Password, host)
+	}
+	return smtp.SendMail(h.smtp.Address, auth, h.smtp.From, []string{to}, msg.Bytes())
+}
@@ -2,18 +2,29 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
+	"github.com/ChronosX88/yans/internal/admin"
+	"github.com/ChronosX88/yans/internal/auth"
 	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/backend/postgres"
 	"github.com/ChronosX88/yans/internal/backend/sqlite"
 	"github.com/ChronosX88/yans/internal/common"
 	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/expiration"
+	"github.com/ChronosX88/yans/internal/httpapi"
+	"github.com/ChronosX88/yans/internal/metrics"
+	"github.com/ChronosX88/yans/internal/peering"
 	"github.com/ChronosX88/yans/internal/protocol"
+	"github.com/ChronosX88/yans/internal/utils"
 	"github.com/google/uuid"
-	"log"
+	"log/slog"
 	"net"
 	"net/http"
 	"nhooyr.io/websocket"
 	"sync"
+	"time"
 )
 
 var (
@@ -22,35 +33,91 @@ var (
 		{Type: protocol.ImplementationCapability, Params: fmt.Sprintf("%s %s", common.ServerName, common.ServerVersion)},
 		{Type: protocol.OverCapability, Params: "MSGID"},
 		{Type: protocol.ModeReaderCapability},
+		{Type: protocol.AuthInfoCapability, Params: "USER"},
 	}
 )
 
+// RegisterCapability advertises the capability in CAPABILITIES of all the sessions,
+// extensions call it on initialization, before the server is started
+func RegisterCapability(name string) {
+	Capabilities.Add(protocol.Capability{Type: protocol.NewCapabilityType(name)})
+}
+
 type NNTPServer struct {
 	ctx        context.Context
 	cancelFunc context.CancelFunc
 
-	ln  net.Listener
-	cfg config.Config
+	listeners []net.Listener
+	wsServer  *http.Server
+	cfg       config.Config
+	tlsConfig *tls.Config
 
-	backend backend.StorageBackend
+	backend       backend.StorageBackend
+	postLimiter   *PostRateLimiter
+	jwtValidator  *auth.JWTValidator
+	acl           *ConnACL
+	adminAPI      *admin.API
+	httpAPI       *httpapi.API
+	feeder        *peering.Feeder
+	expirer       *expiration.Expirer
+	metricsServer *metrics.Server
 
 	sessionPool      map[string]*Session
 	sessionPoolMutex sync.Mutex
+	sessions         sync.WaitGroup // running sessions
 }
 
 func NewNNTPServer(cfg config.Config) (*NNTPServer, error) {
+	if cfg.WildmatCacheSize > 0 {
+		utils.SetWildmatCacheSize(cfg.WildmatCacheSize)
+	}
+
 	b, err := initBackend(cfg)
 	if err != nil {
 		return nil, err
 	}
 
+	var tlsConfig *tls.Config
+	if cfg.TLSCertFile != "" && cfg.TLSKeyFile != "" {
+		cert, err := tls.LoadX509KeyPair(cfg.TLSCertFile, cfg.TLSKeyFile)
+		if err != nil {
+			return nil, err
+		}
+		tlsConfig = &tls.Config{Certificates: []tls.Certificate{cert}}
+	}
+
+	acl, err := NewConnACL(cfg.AllowedCIDRs, cfg.DeniedCIDRs)
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := time.LoadLocation(cfg.TimeZone); err != nil {
+		return nil, err
+	}
+
+	var jwtValidator *auth.JWTValidator
+	if cfg.JWT.Secret != "" {
+		if jwtValidator, err = auth.NewJWTValidator(cfg.JWT.Secret, cfg.JWT.Algorithm); err != nil {
+			return nil, err
+		}
+	}
+
 	ctx, cancel := context.WithCancel(context.Background())
 	ns := &NNTPServer{
-		ctx:         ctx,
-		cancelFunc:  cancel,
-		cfg:         cfg,
-		backend:     b,
-		sessionPool: map[string]*Session{},
+		ctx:          ctx,
+		cancelFunc:   cancel,
+		cfg:          cfg,
+		tlsConfig:    tlsConfig,
+		backend:      b,
+		jwtValidator: jwtValidator,
+		acl:          acl,
+		sessionPool:  map[string]*Session{},
+	}
+	// retention set for the group itself takes priority over the configured patterns
+	policy := expiration.Policies{expiration.NewDatabasePolicy(), expiration.NewConfigFilePolicy(cfg.Retention)}
+	ns.expirer = expiration.NewExpirer(b, policy, time.Duration(cfg.ExpirationInterval)*time.Minute)
+	if cfg.PostRateLimit > 0 {
+		ns.postLimiter = NewPostRateLimiter(ctx, cfg.PostRateLimit, cfg.PostRateBurst)
 	}
 	return ns, nil
 }
@@ -67,6 +134,14 @@ func initBackend(cfg config.Config) (backend.StorageBackend, error) {
 			}
 			sb = sqliteBackend
 		}
+	case config.PostgresBackendType:
+		{
+			postgresBackend, err := postgres.NewPostgreSQLBackend(cfg.Postgres)
+			if err != nil {
+				return nil, err
+			}
+			sb = postgresBackend
+		}
 	default:
 		{
 			return nil, fmt.Errorf("invalid backend type, supported backends: %s", backend.SupportedBackendList)
@@ -82,78 +157,206 @@ func (ns *NNTPServer) Start() error {
 		return err
 	}
 
-	log.Printf("Listening on %s...", address)
-
-	go func(ctx context.Context) {
-		for {
-			select {
-			case <-ctx.Done():
-				break
-			default:
-				{
-					conn, err := ln.Accept()
-					if err != nil {
-						log.Println(err)
-					}
-					log.Printf("Client %s has connected!", conn.RemoteAddr().String())
-
-					if err := ns.handleConn(ctx, conn, conn.RemoteAddr().String()); err != nil {
-						log.Println(err)
-					}
-				}
-			}
+	slog.Info("Listening for NNTP connections", "address", address)
+	ns.listeners = append(ns.listeners, ln)
+	go ns.acceptLoop(ns.ctx, ln)
+
+	if ns.tlsConfig != nil {
+		tlsAddress := fmt.Sprintf("%s:%d", ns.cfg.Address, ns.cfg.TLSPort)
+		tlsLn, err := tls.Listen("tcp", tlsAddress, ns.tlsConfig)
+		if err != nil {
+			return err
 		}
-	}(ns.ctx)
 
-	http.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		slog.Info("Listening for NNTPS connections", "address", tlsAddress)
+		ns.listeners = append(ns.listeners, tlsLn)
+		go ns.acceptLoop(ns.ctx, tlsLn)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		c, err := websocket.Accept(w, r, &websocket.AcceptOptions{InsecureSkipVerify: true})
 		if err != nil {
-			log.Println(err)
+			slog.Warn("Failed to accept websocket connection", "remote_addr", r.RemoteAddr, "error", err)
 			return
 		}
-		log.Printf("Client %s has connected!", r.RemoteAddr)
+		slog.Info("Client has connected", "remote_addr", r.RemoteAddr, "transport", "websocket")
 
 		if err := ns.handleConn(ns.ctx, websocket.NetConn(ns.ctx, c, websocket.MessageText), r.RemoteAddr); err != nil {
-			log.Println(err)
+			slog.Error("Failed to handle connection", "remote_addr", r.RemoteAddr, "error", err)
 		}
 	})
 
-	go http.ListenAndServe(fmt.Sprintf("%s:%d", ns.cfg.Address, ns.cfg.WSPort), nil)
+	ns.wsServer = &http.Server{Addr: fmt.Sprintf("%s:%d", ns.cfg.Address, ns.cfg.WSPort), Handler: mux}
+	go func() {
+		if err := ns.wsServer.ListenAndServe(); err != nil && err != http.ErrServerClosed {
+			slog.Error("Websocket listener has failed", "error", err)
+		}
+	}()
+
+	if ns.cfg.AdminAddr != "" {
+		ns.adminAPI = admin.NewAPI(ns.backend, ns.expirer, ns.cfg.UploadPath, ns.cfg.AdminAddr)
+		ns.adminAPI.Start()
+	}
+
+	if ns.cfg.HTTPAddr != "" {
+		var limiter httpapi.RateLimiter
+		if ns.postLimiter != nil {
+			limiter = ns.postLimiter
+		}
+		ns.httpAPI = httpapi.NewAPI(ns.backend, NewHandler(ns.backend, ns.cfg, ns.tlsConfig, ns.postLimiter, ns.jwtValidator), limiter, ns.cfg.MaxArticleSize, ns.cfg.HTTPAddr)
+		ns.httpAPI.Start()
+	}
+
+	if ns.cfg.MetricsAddr != "" {
+		ns.metricsServer = metrics.NewServer(ns.cfg.MetricsAddr)
+		ns.metricsServer.Start()
+		go spoolStatsLoop(ns.ctx, ns.backend, time.Duration(ns.cfg.SpoolStatsInterval)*time.Second)
+	}
+
+	ns.expirer.Start(ns.ctx)
+
+	if len(ns.cfg.Peers) > 0 {
+		ns.feeder = peering.NewFeeder(ns.backend, ns.cfg.Peers, ns.cfg.UploadPath, time.Duration(ns.cfg.FeedInterval)*time.Second)
+		ns.feeder.Start(ns.ctx)
+	}
 
 	return nil
 }
 
+func (ns *NNTPServer) acceptLoop(ctx context.Context, ln net.Listener) {
+	for {
+		conn, err := ln.Accept()
+		if err != nil {
+			if errors.Is(err, net.ErrClosed) {
+				return
+			}
+			slog.Warn("Failed to accept connection", "error", err)
+			continue
+		}
+		slog.Info("Client has connected", "remote_addr", conn.RemoteAddr().String())
+
+		if err := ns.handleConn(ctx, conn, conn.RemoteAddr().String()); err != nil {
+			slog.Error("Failed to handle connection", "remote_addr", conn.RemoteAddr().String(), "error", err)
+		}
+	}
+}
+
 func (ns *NNTPServer) handleConn(ctx context.Context, conn net.Conn, remoteAddr string) error {
+	if !ns.acl.Allow(remoteAddr) {
+		slog.Warn("Client is not allowed to connect", "remote_addr", remoteAddr)
+		defer conn.Close()
+		_, err := conn.Write([]byte(protocol.NNTPResponse{Code: 502, Message: "Access denied"}.String() + protocol.CRLF))
+		return err
+	}
+
 	id, _ := uuid.NewUUID()
 	closed := make(chan bool)
-	session, err := NewSession(ctx, conn, remoteAddr, Capabilities, id.String(), closed, NewHandler(ns.backend, ns.cfg.Domain, ns.cfg.UploadPath))
+	_, isTLS := conn.(*tls.Conn)
+	session, err := NewSession(ctx, conn, remoteAddr, ns.sessionCapabilities(isTLS), id.String(), closed, NewHandler(ns.backend, ns.cfg, ns.tlsConfig, ns.postLimiter, ns.jwtValidator), time.Duration(ns.cfg.IdleTimeout)*time.Second, ns.cfg.MaxBytesPerSession)
 	if err != nil {
 		return err
 	}
 	ns.sessionPoolMutex.Lock()
 	ns.sessionPool[id.String()] = session
 	ns.sessionPoolMutex.Unlock()
-	go func(ctx context.Context, id string, closed chan bool) {
-		for {
-			select {
-			case <-ctx.Done():
-				break
-			case _, ok := <-closed:
-				{
-					if !ok {
-						ns.sessionPoolMutex.Lock()
-						delete(ns.sessionPool, id)
-						ns.sessionPoolMutex.Unlock()
-						return
-					}
-				}
-			}
+	ns.sessions.Add(1)
+	go func(id string, closed chan bool) {
+		defer ns.sessions.Done()
+		for range closed {
 		}
-	}(ctx, id.String(), closed)
+		ns.sessionPoolMutex.Lock()
+		delete(ns.sessionPool, id)
+		ns.sessionPoolMutex.Unlock()
+	}(id.String(), closed)
 
 	return nil
 }
 
+// sessionCapabilities returns the capabilities of a new session, depending on the enabled features
+func (ns *NNTPServer) sessionCapabilities(isTLS bool) protocol.Capabilities {
+	caps := append(protocol.Capabilities{}, Capabilities...) // sessions modify their own capability list
+	if ns.tlsConfig != nil && !isTLS {
+		caps.Add(protocol.Capability{Type: protocol.StartTLSCapability})
+	}
+	if ns.cfg.AllowIHAVE {
+		caps.Add(protocol.Capability{Type: protocol.IHaveCapability})
+		caps.Add(protocol.Capability{Type: protocol.StreamingCapability})
+	}
+	return caps
+}
+
+func (ns *NNTPServer) Backend() backend.StorageBackend {
+	return ns.backend
+}
+
+// Stop stops accepting new connections and lets the sessions finish their current commands.
+// Connections which are still open after the shutdown timeout are closed, then the backend is closed.
 func (ns *NNTPServer) Stop() {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(ns.cfg.ShutdownTimeout)*time.Second)
+	defer cancel()
+
+	for _, v := range ns.listeners {
+		if err := v.Close(); err != nil {
+			slog.Error("Failed to close listener", "error", err)
+		}
+	}
+	if ns.wsServer != nil {
+		if err := ns.wsServer.Shutdown(ctx); err != nil {
+			slog.Error("Failed to stop websocket listener", "error", err)
+		}
+	}
+	if ns.adminAPI != nil {
+		if err := ns.adminAPI.Stop(ctx); err != nil {
+			slog.Error("Failed to stop admin API", "error", err)
+		}
+	}
+	if ns.httpAPI != nil {
+		if err := ns.httpAPI.Stop(ctx); err != nil {
+			slog.Error("Failed to stop HTTP API", "error", err)
+		}
+	}
+	if ns.metricsServer != nil {
+		if err := ns.metricsServer.Stop(ctx); err != nil {
+			slog.Error("Failed to stop metrics server", "error", err)
+		}
+	}
+
+	ns.drainSessions(ctx)
 	ns.cancelFunc()
+
+	if err := ns.backend.Close(); err != nil {
+		slog.Error("Failed to close backend", "error", err)
+	}
+}
+
+// drainSessions waits for the sessions to end after their current commands until ctx is done,
+// then the remaining connections are closed
+func (ns *NNTPServer) drainSessions(ctx context.Context) {
+	ns.sessionPoolMutex.Lock()
+	for _, v := range ns.sessionPool {
+		v.Drain()
+	}
+	ns.sessionPoolMutex.Unlock()
+
+	done := make(chan struct{})
+	go func() {
+		ns.sessions.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return
+	case <-ctx.Done():
+		{
+			ns.sessionPoolMutex.Lock()
+			slog.Warn("Shutdown timeout has expired, closing remaining connections", "count", len(ns.sessionPool))
+			for _, v := range ns.sessionPool {
+				v.conn.Close()
+			}
+			ns.sessionPoolMutex.Unlock()
+			<-done
+		}
+	}
 }
@@ -0,0 +1,104 @@
+package server
+
+import (
+	"bufio"
+	"crypto/tls"
+	"net/textproto"
+	"strings"
+	"testing"
+
+	"github.com/ChronosX88/yans/internal/config"
+	"github.com/ChronosX88/yans/internal/protocol"
+)
+
+// parseCapabilities reads the CAPABILITIES response into the capability labels and their arguments
+func parseCapabilities(t *testing.T, caps protocol.Capabilities) map[string]string {
+	t.Helper()
+	r := textproto.NewReader(bufio.NewReader(strings.NewReader(caps.String())))
+	if _, _, err := r.ReadCodeLine(101); err != nil {
+		t.Fatal(err)
+	}
+	lines, err := r.ReadDotLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lines) == 0 || lines[0] != "VERSION 2" {
+		t.Fatalf("capability list %q doesn't start with VERSION 2", lines)
+	}
+	res := map[string]string{}
+	for _, v := range lines {
+		label, args, _ := strings.Cut(v, " ")
+		res[label] = args
+	}
+	return res
+}
+
+func TestSessionCapabilities(t *testing.T) {
+	tests := []struct {
+		name    string
+		ns      *NNTPServer
+		isTLS   bool
+		want    []string
+		notWant []string
+	}{
+		{
+			name:    "defaults",
+			ns:      &NNTPServer{},
+			want:    []string{"VERSION", "IMPLEMENTATION", "MODE-READER", "OVER", "AUTHINFO"},
+			notWant: []string{"STARTTLS", "IHAVE", "STREAMING"},
+		},
+		{
+			name: "TLS",
+			ns:   &NNTPServer{tlsConfig: &tls.Config{}},
+			want: []string{"STARTTLS"},
+		},
+		{
+			name:    "TLS connection",
+			ns:      &NNTPServer{tlsConfig: &tls.Config{}},
+			isTLS:   true,
+			notWant: []string{"STARTTLS"},
+		},
+		{
+			name: "transit",
+			ns:   &NNTPServer{cfg: config.Config{AllowIHAVE: true}},
+			want: []string{"IHAVE", "STREAMING"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			caps := parseCapabilities(t, tt.ns.sessionCapabilities(tt.isTLS))
+			for _, v := range tt.want {
+				if _, ok := caps[v]; !ok {
+					t.Errorf("%s isn't advertised in %v", v, caps)
+				}
+			}
+			for _, v := range tt.notWant {
+				if _, ok := caps[v]; ok {
+					t.Errorf("%s is advertised", v)
+				}
+			}
+		})
+	}
+}
+
+func TestRegisterCapability(t *testing.T) {
+	saved := append(protocol.Capabilities{}, Capabilities...)
+	defer func() { Capabilities = saved }()
+
+	RegisterCapability("XTEST")
+	RegisterCapability("XTEST")
+
+	caps := (&NNTPServer{}).sessionCapabilities(false)
+	count := 0
+	for _, v := range caps {
+		if v.Type.String() == "XTEST" {
+			count++
+		}
+	}
+	if count != 1 {
+		t.Errorf("XTEST is advertised %d times, want once", count)
+	}
+	if _, ok := parseCapabilities(t, caps)["XTEST"]; !ok {
+		t.Error("registered capability isn't listed")
+	}
+}
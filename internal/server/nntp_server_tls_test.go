@@ -0,0 +1,176 @@
+//go:build sqlite_fts5
+
+package server
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/ChronosX88/yans/internal/config"
+)
+
+// writeTestCertificate writes a self-signed certificate for 127.0.0.1, it's returned as the pool trusting it
+func writeTestCertificate(t *testing.T, certFile, keyFile string) *x509.CertPool {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "news.example.com"},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool := x509.NewCertPool()
+	pool.AddCert(cert)
+	return pool
+}
+
+// newTestTLSServer starts the server with both listeners on random ports, the addresses are returned
+// along with the client configuration trusting its certificate
+func newTestTLSServer(t *testing.T) (string, string, *tls.Config) {
+	t.Helper()
+	dir := t.TempDir()
+	certFile, keyFile := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	pool := writeTestCertificate(t, certFile, keyFile)
+
+	ns, err := NewNNTPServer(config.Config{
+		Address:            "127.0.0.1",
+		Domain:             "news.example.com",
+		BackendType:        config.SQLiteBackendType,
+		SQLite:             config.SQLiteBackendConfig{Path: "file:" + t.Name() + "?mode=memory&cache=shared"},
+		TLSCertFile:        certFile,
+		TLSKeyFile:         keyFile,
+		ExpirationInterval: 60,
+		IdleTimeout:        60,
+		ShutdownTimeout:    5,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.Backend().CreateGroup(context.Background(), "test.group", "", false, "y"); err != nil {
+		t.Fatal(err)
+	}
+	if err := ns.Start(); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(ns.Stop)
+	return ns.listeners[0].Addr().String(), ns.listeners[1].Addr().String(), &tls.Config{RootCAs: pool}
+}
+
+// testPostAndRead posts an article and reads it back by its message-id
+func testPostAndRead(t *testing.T, c *textproto.Conn) {
+	t.Helper()
+	subject := "posted over TLS"
+	testCommand(t, c, 340, "POST")
+	dw := c.DotWriter()
+	if _, err := dw.Write([]byte("From: poster@example.com\r\nNewsgroups: test.group\r\nSubject: " + subject + "\r\n\r\nhello\r\n")); err != nil {
+		t.Fatal(err)
+	}
+	if err := dw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := c.ReadCodeLine(240); err != nil {
+		t.Fatalf("POST: %v", err)
+	}
+
+	testCommand(t, c, 211, "GROUP test.group")
+	messageID := strings.Fields(testCommand(t, c, 223, "STAT 1"))[1]
+	testCommand(t, c, 220, "ARTICLE "+messageID)
+	lines, err := c.ReadDotLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	article := strings.Join(lines, "\n")
+	if !strings.Contains(article, "Subject: "+subject) || !strings.HasSuffix(article, "\nhello") {
+		t.Errorf("ARTICLE returned %q", article)
+	}
+}
+
+func TestTLSListener(t *testing.T) {
+	_, tlsAddr, clientConfig := newTestTLSServer(t)
+
+	conn, err := tls.Dial("tcp", tlsAddr, clientConfig)
+	if err != nil {
+		t.Fatal(err)
+	}
+	c := textproto.NewConn(conn)
+	defer c.Close()
+	if _, _, err := c.ReadCodeLine(201); err != nil {
+		t.Fatal(err)
+	}
+
+	testPostAndRead(t, c)
+}
+
+func TestStartTLS(t *testing.T) {
+	addr, _, clientConfig := newTestTLSServer(t)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	c := textproto.NewConn(conn)
+	if _, _, err := c.ReadCodeLine(201); err != nil {
+		t.Fatal(err)
+	}
+	testCommand(t, c, 382, "STARTTLS")
+
+	// the session goes on over TLS without a new greeting (RFC 4642)
+	clientConfig.ServerName = "127.0.0.1"
+	tlsConn := tls.Client(conn, clientConfig)
+	if err := tlsConn.Handshake(); err != nil {
+		t.Fatal(err)
+	}
+	c = textproto.NewConn(tlsConn)
+	testCommand(t, c, 101, "CAPABILITIES")
+	lines, err := c.ReadDotLines()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, v := range lines {
+		if v == "STARTTLS" {
+			t.Error("STARTTLS is still advertised after the upgrade")
+		}
+	}
+
+	testPostAndRead(t, c)
+}
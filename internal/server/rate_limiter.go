@@ -0,0 +1,85 @@
+package server
+
+import (
+	"context"
+	"golang.org/x/time/rate"
+	"net"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	limiterIdleTimeout = 10 * time.Minute
+	limiterGCInterval  = time.Minute
+)
+
+type limiterEntry struct {
+	limiter  *rate.Limiter
+	lastSeen int64 // unix time, accessed atomically
+}
+
+// PostRateLimiter is a token bucket limiter of article posting, kept per remote IP address
+type PostRateLimiter struct {
+	limiters sync.Map
+	limit    rate.Limit
+	burst    int
+}
+
+// NewPostRateLimiter creates limiter allowing postsPerMinute posts per IP with the given burst size.
+// Limiters which have been idle for a while are dropped until ctx is done.
+func NewPostRateLimiter(ctx context.Context, postsPerMinute, burst int) *PostRateLimiter {
+	if burst <= 0 {
+		burst = 1
+	}
+	rl := &PostRateLimiter{
+		limit: rate.Limit(float64(postsPerMinute) / 60),
+		burst: burst,
+	}
+	go rl.gcLoop(ctx)
+	return rl
+}
+
+// Allow reports whether the client may post now, otherwise it returns how long the client should wait
+func (rl *PostRateLimiter) Allow(remoteAddr string) (bool, time.Duration) {
+	ip, _, err := net.SplitHostPort(remoteAddr)
+	if err != nil {
+		ip = remoteAddr
+	}
+
+	v, ok := rl.limiters.Load(ip)
+	if !ok {
+		v, _ = rl.limiters.LoadOrStore(ip, &limiterEntry{limiter: rate.NewLimiter(rl.limit, rl.burst)})
+	}
+	e := v.(*limiterEntry)
+	atomic.StoreInt64(&e.lastSeen, time.Now().Unix())
+
+	r := e.limiter.Reserve()
+	if delay := r.Delay(); delay > 0 {
+		r.Cancel()
+		return false, delay
+	}
+	return true, 0
+}
+
+func (rl *PostRateLimiter) gcLoop(ctx context.Context) {
+	ticker := time.NewTicker(limiterGCInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			{
+				deadline := time.Now().Add(-limiterIdleTimeout).Unix()
+				rl.limiters.Range(func(k, v interface{}) bool {
+					if atomic.LoadInt64(&v.(*limiterEntry).lastSeen) < deadline {
+						rl.limiters.Delete(k)
+					}
+					return true
+				})
+			}
+		}
+	}
+}
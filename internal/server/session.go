@@ -2,15 +2,20 @@ package server
 
 import (
 	"context"
+	"crypto/tls"
 	"errors"
 	"fmt"
+	"github.com/ChronosX88/yans/internal/metrics"
 	"github.com/ChronosX88/yans/internal/models"
 	"github.com/ChronosX88/yans/internal/protocol"
 	"io"
-	"log"
+	"log/slog"
 	"net"
 	"net/textproto"
+	"os"
 	"strings"
+	"sync"
+	"time"
 )
 
 type SessionMode int
@@ -21,7 +26,8 @@ const (
 )
 
 type Session struct {
-	ctx          context.Context
+	ctx          context.Context // cancelled once the session ends, so backend queries of a gone client are aborted
+	cancel       context.CancelFunc
 	capabilities protocol.Capabilities
 	conn         net.Conn
 	tconn        *textproto.Conn
@@ -29,12 +35,36 @@ type Session struct {
 	id           string
 	closed       chan<- bool
 	h            *Handler
+	idleTimeout  time.Duration
+	stats        *ConnStats
+	maxBytes     int64 // transferred in both directions, 0 means unlimited
+
+	// the stats already added to the transferred bytes counter
+	reportedRead    int64
+	reportedWritten int64
 
 	currentGroup   *models.Group
 	currentArticle *models.Article
 	mode           SessionMode
+
+	authUsername  string
+	authUserID    int64
+	authenticated bool
+	readOnly      bool // authenticated with a token which doesn't grant posting
+	tls           bool
+
+	streamQueue chan func()
+	streamDone  chan struct{}
+	streamOnce  sync.Once
+
+	stateMutex sync.Mutex
+	idle       bool // waiting for the next command
+	draining   bool
 }
 
+// size of the streaming jobs queue, the command reader waits when it's full
+const streamQueueSize = 64
+
 func NewSession(
 	ctx context.Context,
 	conn net.Conn,
@@ -43,6 +73,8 @@ func NewSession(
 	id string,
 	closed chan<- bool,
 	handler *Handler,
+	idleTimeout time.Duration,
+	maxBytes int64,
 ) (*Session, error) {
 	var err error
 	defer func() {
@@ -52,9 +84,14 @@ func NewSession(
 		}
 	}()
 
+	_, isTLS := conn.(*tls.Conn)
+	stats := &ConnStats{}
+	conn = &statsConn{Conn: conn, stats: stats}
 	tconn := textproto.NewConn(conn)
+	ctx, cancel := context.WithCancel(ctx)
 	s := &Session{
 		ctx:          ctx,
+		cancel:       cancel,
 		conn:         conn,
 		tconn:        tconn,
 		remoteAddr:   remoteAddr,
@@ -62,7 +99,11 @@ func NewSession(
 		id:           id,
 		closed:       closed,
 		h:            handler,
+		idleTimeout:  idleTimeout,
+		stats:        stats,
+		maxBytes:     maxBytes,
 		mode:         SessionModeTransit,
+		tls:          isTLS,
 	}
 
 	go s.loop()
@@ -71,7 +112,16 @@ func NewSession(
 }
 
 func (s *Session) loop() {
+	metrics.ActiveConnections.Inc()
 	defer func() {
+		metrics.ActiveConnections.Dec()
+		// the queued streaming jobs can't be answered anymore
+		s.cancel()
+		s.stopStream()
+		s.reportStats()
+		// the bytes of the closed connection are no longer open
+		metrics.ConnectionBytes.WithLabelValues("in").Sub(float64(s.reportedRead))
+		metrics.ConnectionBytes.WithLabelValues("out").Sub(float64(s.reportedWritten))
 		close(s.closed)
 	}()
 
@@ -82,34 +132,141 @@ func (s *Session) loop() {
 	}
 
 	for {
-		select {
-		case <-s.ctx.Done():
-			break
-		default:
-			{
-				id := s.tconn.Next()
-				s.tconn.StartRequest(id)
-				message, err := s.tconn.ReadLine()
-				if err != nil {
-					if err == io.EOF || errors.Is(err, net.ErrClosed) || strings.Contains(err.Error(), "StatusNormalClosure") {
-						log.Printf("Client %s has diconnected!", s.remoteAddr)
-					} else {
-						log.Print(err)
-						s.conn.Close()
-					}
-					return
-				}
-				s.tconn.EndRequest(id)
-				log.Printf("Received message from %s: %s", s.remoteAddr, message) // for debugging
-				err = s.h.Handle(s, message, id)
-				if err != nil {
-					log.Print(err)
-					s.tconn.PrintfLine(protocol.NNTPResponse{Code: 403, Message: fmt.Sprintf("Failed to process command: %s", err.Error())}.String())
-					s.conn.Close()
-					return
-				}
+		if s.ctx.Err() != nil {
+			s.conn.Close()
+			return
+		}
+		if !s.enterIdle() {
+			s.closeDrained()
+			return
+		}
+
+		id := s.tconn.Next()
+		s.tconn.StartRequest(id)
+		message, err := s.tconn.ReadLine()
+		if !s.enterBusy() {
+			// reading has been interrupted by Drain, unless the command was already received
+			if err != nil {
+				s.closeDrained()
+				return
 			}
 		}
+		if err != nil {
+			if errors.Is(err, os.ErrDeadlineExceeded) {
+				slog.Info("Closing idle connection", "remote_addr", s.remoteAddr)
+				s.tconn.PrintfLine(protocol.NNTPResponse{Code: 400, Message: "Idle timeout"}.String())
+				s.conn.Close()
+			} else if err == io.EOF || errors.Is(err, net.ErrClosed) || strings.Contains(err.Error(), "StatusNormalClosure") {
+				slog.Info("Client has disconnected", "remote_addr", s.remoteAddr)
+			} else {
+				slog.Warn("Failed to read command", "remote_addr", s.remoteAddr, "error", err)
+				s.conn.Close()
+			}
+			return
+		}
+		s.tconn.EndRequest(id)
+		err = s.h.Handle(s, message, id)
+		if err != nil {
+			s.tconn.PrintfLine(protocol.NNTPResponse{Code: 403, Message: fmt.Sprintf("Failed to process command: %s", err.Error())}.String())
+			s.conn.Close()
+			return
+		}
+		s.reportStats()
+		if s.maxBytes > 0 && s.stats.Total() > s.maxBytes {
+			slog.Info("Closing connection exceeding byte limit", "remote_addr", s.remoteAddr, "bytes", s.stats.Total())
+			s.tconn.PrintfLine(protocol.NNTPResponse{Code: 400, Message: "Session byte limit exceeded"}.String())
+			s.conn.Close()
+			return
+		}
 	}
+}
 
+// reportStats updates the transfer metrics with the bytes counted since the last report
+func (s *Session) reportStats() {
+	read, written := s.stats.BytesRead(), s.stats.BytesWritten()
+	metrics.TransferredBytesTotal.WithLabelValues("in").Add(float64(read - s.reportedRead))
+	metrics.TransferredBytesTotal.WithLabelValues("out").Add(float64(written - s.reportedWritten))
+	metrics.ConnectionBytes.WithLabelValues("in").Add(float64(read - s.reportedRead))
+	metrics.ConnectionBytes.WithLabelValues("out").Add(float64(written - s.reportedWritten))
+	s.reportedRead, s.reportedWritten = read, written
+}
+
+// Drain makes the session end once its current command is done, an idle session ends right away
+func (s *Session) Drain() {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	s.draining = true
+	if s.idle {
+		// interrupts waiting for the next command
+		s.conn.SetReadDeadline(time.Now())
+	}
+}
+
+// upgradeTLS replaces the connection with the negotiated TLS one, it's locked as Drain may use the connection meanwhile
+func (s *Session) upgradeTLS(conn *tls.Conn) {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	s.conn = conn
+	s.tconn = textproto.NewConn(conn)
+	s.tls = true
+}
+
+// enterIdle marks the session as waiting for a command and starts the idle timer, false is returned if it's draining
+func (s *Session) enterIdle() bool {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	if s.draining {
+		return false
+	}
+	s.idle = true
+	// set under the lock, so it doesn't override the deadline set by Drain
+	s.conn.SetReadDeadline(time.Now().Add(s.idleTimeout))
+	return true
+}
+
+// enterBusy marks the session as processing a command, false is returned if it's draining
+func (s *Session) enterBusy() bool {
+	s.stateMutex.Lock()
+	defer s.stateMutex.Unlock()
+
+	s.idle = false
+	// the command may still need to read its data
+	s.conn.SetReadDeadline(time.Time{})
+	return !s.draining
+}
+
+// closeDrained waits for the streaming jobs and closes the connection of the draining session
+func (s *Session) closeDrained() {
+	s.stopStream()
+	s.tconn.PrintfLine(protocol.NNTPResponse{Code: 400, Message: "Service is shutting down"}.String())
+	s.conn.Close()
+	slog.Info("Client has been disconnected on shutdown", "remote_addr", s.remoteAddr)
+}
+
+// stream runs the job in the session's streaming worker, so the command reader isn't blocked by it.
+// Jobs are run in order, so they may acquire their responses in the pipeline.
+func (s *Session) stream(job func()) {
+	s.streamOnce.Do(func() {
+		s.streamQueue = make(chan func(), streamQueueSize)
+		s.streamDone = make(chan struct{})
+		go func(queue <-chan func(), done chan<- struct{}) {
+			defer close(done)
+			for job := range queue {
+				job()
+			}
+		}(s.streamQueue, s.streamDone)
+	})
+	s.streamQueue <- job
+}
+
+// stopStream waits until the queued streaming jobs are done
+func (s *Session) stopStream() {
+	if s.streamQueue != nil {
+		close(s.streamQueue)
+		<-s.streamDone
+		s.streamQueue = nil
+	}
 }
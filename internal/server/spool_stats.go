@@ -0,0 +1,50 @@
+package server
+
+import (
+	"context"
+	"github.com/ChronosX88/yans/internal/backend"
+	"github.com/ChronosX88/yans/internal/metrics"
+	"log/slog"
+	"time"
+)
+
+// spoolStatsLoop updates the spool size metrics every interval until ctx is done
+func spoolStatsLoop(ctx context.Context, b backend.StorageBackend, interval time.Duration) {
+	t := time.NewTicker(interval)
+	defer t.Stop()
+
+	for {
+		if err := updateSpoolStats(ctx, b); err != nil && ctx.Err() == nil {
+			slog.Error("Failed to update spool size metrics", "error", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-t.C:
+		}
+	}
+}
+
+func updateSpoolStats(ctx context.Context, b backend.StorageBackend) error {
+	size, err := b.GetSpoolSize(ctx)
+	if err != nil {
+		return err
+	}
+	metrics.SpoolBytes.Set(float64(size))
+
+	groups, err := b.ListGroups(ctx)
+	if err != nil {
+		return err
+	}
+	// drop the deleted groups
+	metrics.GroupSpoolBytes.Reset()
+	for _, v := range groups {
+		size, err := b.GetSpoolSizeForGroup(ctx, &v)
+		if err != nil {
+			return err
+		}
+		metrics.GroupSpoolBytes.WithLabelValues(v.GroupName).Set(float64(size))
+	}
+	return nil
+}
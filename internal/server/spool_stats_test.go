@@ -0,0 +1,53 @@
+//go:build sqlite_fts5
+
+package server
+
+import (
+	"context"
+	"testing"
+
+	"github.com/ChronosX88/yans/internal/metrics"
+	"github.com/ChronosX88/yans/internal/models"
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestUpdateSpoolStats(t *testing.T) {
+	b := newTestHandler(t, "test.one", "test.two").backend
+	ctx := context.Background()
+	sizes := map[string]float64{}
+	for _, v := range []struct {
+		messageID string
+		body      string
+		groups    []string
+	}{
+		{"<1@example.com>", "abc", []string{"test.one"}},
+		{"<2@example.com>", "12345", []string{"test.one", "test.two"}},
+	} {
+		a := models.Article{HeaderRaw: `{"Message-Id":["` + v.messageID + `"]}`, Header: map[string][]string{"Message-Id": {v.messageID}}, Body: v.body}
+		if err := b.SaveArticle(ctx, a, v.groups); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := b.GetArticle(ctx, v.messageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		sizes[v.messageID] = float64(stored.ByteCount)
+	}
+	// a gauge of the group deleted meanwhile
+	metrics.GroupSpoolBytes.WithLabelValues("test.deleted").Set(1)
+
+	if err := updateSpoolStats(ctx, b); err != nil {
+		t.Fatalf("updateSpoolStats() error = %v", err)
+	}
+	if got, want := testutil.ToFloat64(metrics.SpoolBytes), sizes["<1@example.com>"]+sizes["<2@example.com>"]; got != want {
+		t.Errorf("spool bytes = %v, want %v", got, want)
+	}
+	for name, want := range map[string]float64{"test.one": sizes["<1@example.com>"] + sizes["<2@example.com>"], "test.two": sizes["<2@example.com>"]} {
+		if got := testutil.ToFloat64(metrics.GroupSpoolBytes.WithLabelValues(name)); got != want {
+			t.Errorf("spool bytes of %s = %v, want %v", name, got, want)
+		}
+	}
+	if n := testutil.CollectAndCount(metrics.GroupSpoolBytes); n != 2 {
+		t.Errorf("%d group spool gauges are collected, want the 2 existing groups", n)
+	}
+}
@@ -0,0 +1,20 @@
+package utils
+
+import (
+	"net/mail"
+	"strings"
+)
+
+// NormalizeEmail extracts the lowercased address from the From header, so it can be compared
+// regardless of the display name. Malformed headers fall back to the text between angle brackets.
+func NormalizeEmail(from string) string {
+	if addr, err := mail.ParseAddress(from); err == nil {
+		return strings.ToLower(addr.Address)
+	}
+	if i := strings.Index(from, "<"); i >= 0 {
+		if j := strings.Index(from[i:], ">"); j > 0 {
+			from = from[i+1 : i+j]
+		}
+	}
+	return strings.ToLower(strings.TrimSpace(from))
+}
@@ -0,0 +1,96 @@
+package utils
+
+import (
+	"container/list"
+	"github.com/dlclark/regexp2"
+	"sync"
+)
+
+const DefaultWildmatCacheSize = 128
+
+var (
+	wildmatCache = NewRegexCache(DefaultWildmatCacheSize, func(wildmat string) (*regexp2.Regexp, error) {
+		w, err := ParseWildmat(wildmat)
+		if err != nil {
+			return nil, err
+		}
+		return w.ToRegex()
+	})
+	regexCache = NewRegexCache(DefaultWildmatCacheSize, func(re string) (*regexp2.Regexp, error) {
+		return regexp2.Compile(re, regexp2.None)
+	})
+)
+
+// RegexCache is a thread-safe LRU cache of compiled regular expressions
+type RegexCache struct {
+	mutex   sync.Mutex
+	size    int
+	compile func(string) (*regexp2.Regexp, error)
+	order   *list.List
+	items   map[string]*list.Element
+}
+
+type regexCacheEntry struct {
+	key   string
+	regex *regexp2.Regexp
+}
+
+func NewRegexCache(size int, compile func(string) (*regexp2.Regexp, error)) *RegexCache {
+	return &RegexCache{
+		size:    size,
+		compile: compile,
+		order:   list.New(),
+		items:   map[string]*list.Element{},
+	}
+}
+
+// Get returns compiled regex for the key, compiling it only if it isn't cached yet
+func (rc *RegexCache) Get(key string) (*regexp2.Regexp, error) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	if e, ok := rc.items[key]; ok {
+		rc.order.MoveToFront(e)
+		return e.Value.(*regexCacheEntry).regex, nil
+	}
+
+	r, err := rc.compile(key)
+	if err != nil {
+		return nil, err
+	}
+	rc.items[key] = rc.order.PushFront(&regexCacheEntry{key: key, regex: r})
+	rc.evict()
+
+	return r, nil
+}
+
+func (rc *RegexCache) Resize(size int) {
+	rc.mutex.Lock()
+	defer rc.mutex.Unlock()
+
+	rc.size = size
+	rc.evict()
+}
+
+func (rc *RegexCache) evict() {
+	for rc.order.Len() > rc.size {
+		oldest := rc.order.Back()
+		rc.order.Remove(oldest)
+		delete(rc.items, oldest.Value.(*regexCacheEntry).key)
+	}
+}
+
+// CompileWildmat returns the regex equivalent of wildmat, using the shared cache
+func CompileWildmat(wildmat string) (*regexp2.Regexp, error) {
+	return wildmatCache.Get(wildmat)
+}
+
+// CompileRegex returns compiled regex, using the shared cache
+func CompileRegex(re string) (*regexp2.Regexp, error) {
+	return regexCache.Get(re)
+}
+
+func SetWildmatCacheSize(size int) {
+	wildmatCache.Resize(size)
+	regexCache.Resize(size)
+}
@@ -0,0 +1,87 @@
+package utils
+
+import (
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/dlclark/regexp2"
+)
+
+// newCountingCache returns the wildmat cache which counts the compilations of every key
+func newCountingCache(size int) (*RegexCache, map[string]*int64) {
+	counts := map[string]*int64{}
+	var mutex sync.Mutex
+	rc := NewRegexCache(size, func(wildmat string) (*regexp2.Regexp, error) {
+		mutex.Lock()
+		if counts[wildmat] == nil {
+			counts[wildmat] = new(int64)
+		}
+		atomic.AddInt64(counts[wildmat], 1)
+		mutex.Unlock()
+
+		w, err := ParseWildmat(wildmat)
+		if err != nil {
+			return nil, err
+		}
+		return w.ToRegex()
+	})
+	return rc, counts
+}
+
+func TestRegexCacheCompilesOnce(t *testing.T) {
+	rc, counts := newCountingCache(DefaultWildmatCacheSize)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				r, err := rc.Get("comp.lang.*")
+				if err != nil {
+					t.Error(err)
+					return
+				}
+				if ok, _ := r.MatchString("comp.lang.go"); !ok {
+					t.Error("cached regex doesn't match")
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	if n := *counts["comp.lang.*"]; n != 1 {
+		t.Errorf("pattern compiled %d times, want 1", n)
+	}
+}
+
+func TestRegexCacheEvictsLeastRecentlyUsed(t *testing.T) {
+	rc, counts := newCountingCache(2)
+	get := func(wildmat string) {
+		t.Helper()
+		if _, err := rc.Get(wildmat); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	get("a.*")
+	get("b.*")
+	get("a.*") // b.* is the least recently used now
+	get("c.*")
+	get("a.*")
+	get("b.*")
+
+	if n := *counts["a.*"]; n != 1 {
+		t.Errorf("a.* compiled %d times, want 1", n)
+	}
+	if n := *counts["b.*"]; n != 2 {
+		t.Errorf("b.* compiled %d times, want 2 as it's evicted in between", n)
+	}
+
+	rc.Resize(1)
+	if rc.order.Len() != 1 || len(rc.items) != 1 {
+		t.Errorf("cache holds %d entries after resizing to 1", rc.order.Len())
+	}
+}
@@ -0,0 +1,19 @@
+package utils
+
+import (
+	"regexp"
+	"strings"
+)
+
+// replyPrefixRegex matches reply markers like "Re: ", "RE:" or "Re: Re: " at the subject start
+var replyPrefixRegex = regexp.MustCompile(`^(?i:\s*re\s*:\s*)+`)
+
+// StripReplyPrefix removes the reply markers, so replies have the same subject as the original article
+func StripReplyPrefix(subject string) string {
+	return strings.TrimSpace(replyPrefixRegex.ReplaceAllString(subject, ""))
+}
+
+// EscapeLike escapes the LIKE pattern wildcards in s, the query must use ESCAPE '\'
+func EscapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
@@ -16,26 +16,22 @@ type WildmatPattern struct {
 	regex   *regexp2.Regexp
 }
 
-func regexpEscape(str string) string {
-	restrictedChars := []string{"(\\", "+", "|", "{", "[", "(", ")", "^", "$", ".", "#"}
-	for _, v := range restrictedChars {
-		str = strings.ReplaceAll(str, v, "\\"+v)
-	}
-	return str
-}
-
 func convertWildmatToRegex(pat string) (*regexp2.Regexp, error) {
 	regex := ""
-	pat = regexpEscape(pat)
-	patRunes := []rune(pat)
-	for _, v := range patRunes {
+	for _, v := range pat {
 		switch v {
 		case '?':
 			regex += "."
 		case '*':
-			regex += ".?"
+			// runs of stars match the same, but would make the regex backtrack a lot
+			if !strings.HasSuffix(regex, ".*") {
+				regex += ".*"
+			}
 		default:
 			{
+				if strings.ContainsRune(`\.+*?()|[]{}^$`, v) {
+					regex += `\`
+				}
 				regex += string(v)
 			}
 		}
@@ -63,21 +59,54 @@ func ParseWildmat(wildmat string) (*Wildmat, error) {
 	return res, nil
 }
 
+// wildmatEnd matches the end of the name only, $ of regexp2 matches before the final newline as well
+// and PostgreSQL has no \z
+const wildmatEnd = "(?!.)"
+
+// ToRegex converts the wildmat into a regex matching whole names. A name matches if the last pattern
+// matching it isn't negated (RFC 3977 §4.2), so every pattern is tried with the negated ones following it excluded.
+// The regex is supported both by regexp2 and by PostgreSQL.
 func (w *Wildmat) ToRegex() (*regexp2.Regexp, error) {
-	res := "(%s)%s"
-	include := ""
-	exclude := ""
-	for _, v := range w.patterns {
+	var alternatives []string
+	for i, v := range w.patterns {
 		if v.negated {
-			exclude += fmt.Sprintf("(?!%s)", v.regex.String())
-		} else {
-			if len(include) != 0 {
-				include += fmt.Sprintf("|(%s)", v.regex.String())
-			} else {
-				include += fmt.Sprintf("(%s)", v.regex.String())
+			continue
+		}
+		alternative := ""
+		for _, n := range w.patterns[i+1:] {
+			if n.negated {
+				alternative += fmt.Sprintf("(?!(?:%s)%s)", n.regex.String(), wildmatEnd)
 			}
 		}
+		alternatives = append(alternatives, fmt.Sprintf("%s(?:%s)%s", alternative, v.regex.String(), wildmatEnd))
+	}
+	if len(alternatives) == 0 {
+		// only negated patterns never match
+		return regexp2.Compile("(?s)^(?!.*)", regexp2.None)
+	}
+	// wildcards match newlines too
+	return regexp2.Compile(fmt.Sprintf("(?s)^(?:%s)", strings.Join(alternatives, "|")), regexp2.None)
+}
+
+// WildmatToSQL converts the wildmat into a WHERE clause fragment matching group names, along with its bind parameters.
+// The fragment refers to the group_name column. Wildmats without negated patterns become GLOB clauses, so they
+// may use an index, the others fall back to the REGEXP function with the compiled regex. Placeholders are "?".
+// GLOB is case-sensitive like the regex, so the results don't depend on the way of matching.
+func WildmatToSQL(pattern string) (string, []interface{}, error) {
+	if strings.Contains(pattern, "!") {
+		r, err := CompileWildmat(pattern)
+		if err != nil {
+			return "", nil, err
+		}
+		return "group_name REGEXP ?", []interface{}{r.String()}, nil
+	}
+
+	var clauses []string
+	var args []interface{}
+	for _, v := range strings.Split(pattern, ",") {
+		clauses = append(clauses, "group_name GLOB ?")
+		// * and ? are the same in GLOB, character classes are opened by [ only
+		args = append(args, strings.ReplaceAll(v, "[", "[[]"))
 	}
-	res = fmt.Sprintf(res, include, exclude)
-	return regexp2.Compile(res, regexp2.None)
+	return "(" + strings.Join(clauses, " OR ") + ")", args, nil
 }
@@ -0,0 +1,39 @@
+package utils
+
+import "testing"
+
+func TestCompileWildmat(t *testing.T) {
+	tests := []struct {
+		wildmat string
+		name    string
+		want    bool
+	}{
+		{"comp.*", "comp.lang.go", true},
+		{"comp.*", "xcomp.lang.go", false},
+		{"comp.*", "comp", false},
+		{"Comp.*", "comp.lang.go", false},
+		{"comp.lang.?o", "comp.lang.go", true},
+		{"comp.lang.?o", "comp.lang.o", false},
+		{"a.b", "axb", false},
+		{"a+b", "a+b", true},
+		{"a[b]c", "a[b]c", true},
+		{"*", "", true},
+		{"comp.*,alt.*", "alt.test", true},
+		// the last matching pattern wins (RFC 3977 §4.2)
+		{"*,!comp.*", "comp.lang.go", false},
+		{"*,!comp.*", "alt.test", true},
+		{"*,!comp.*,comp.lang.*", "comp.lang.go", true},
+		{"*,!comp.*,comp.lang.*", "comp.os.linux", false},
+		{"comp.*,!comp.lang.*,!alt.*", "comp.os", true},
+		{"!comp.*", "alt.test", false},
+	}
+	for _, tt := range tests {
+		r, err := CompileWildmat(tt.wildmat)
+		if err != nil {
+			t.Fatalf("CompileWildmat(%q) error = %v", tt.wildmat, err)
+		}
+		if got, err := r.MatchString(tt.name); err != nil || got != tt.want {
+			t.Errorf("CompileWildmat(%q).MatchString(%q) = %v, %v, want %v", tt.wildmat, tt.name, got, err, tt.want)
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package validation
+
+import (
+	"errors"
+	"fmt"
+	"github.com/ChronosX88/yans/internal/models"
+	"strings"
+)
+
+// headers which every article must have (RFC 1036 §2.1)
+var mandatoryHeaders = []string{"From", "Date", "Subject", "Message-ID", "Newsgroups"}
+
+var (
+	ErrInvalidMessageID  = errors.New("invalid Message-ID")
+	ErrControlNotAllowed = errors.New("control messages are not allowed")
+	ErrInvalidNewsgroups = errors.New("invalid Newsgroups header")
+)
+
+// ValidateArticle checks that the article has all the mandatory headers with sane values.
+// Articles with Control header are rejected unless allowControl is set.
+func ValidateArticle(a *models.Article, allowControl bool) error {
+	for _, v := range mandatoryHeaders {
+		if strings.TrimSpace(a.Header.Get(v)) == "" {
+			return fmt.Errorf("missing %s header", v)
+		}
+	}
+
+	if !IsValidMessageID(a.Header.Get("Message-ID")) {
+		return ErrInvalidMessageID
+	}
+
+	for _, v := range strings.Split(a.Header.Get("Newsgroups"), ",") {
+		if v = strings.TrimSpace(v); v == "" || strings.ContainsAny(v, " \t") {
+			return ErrInvalidNewsgroups
+		}
+	}
+
+	if !allowControl && a.Header.Get("Control") != "" {
+		return ErrControlNotAllowed
+	}
+	return nil
+}
+
+// IsValidMessageID checks the message-id has the <left@right> form without whitespace (RFC 5536 §3.1.3)
+func IsValidMessageID(id string) bool {
+	if len(id) < 5 || id[0] != '<' || id[len(id)-1] != '>' {
+		return false
+	}
+	parts := strings.Split(id[1:len(id)-1], "@")
+	if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+		return false
+	}
+	return !strings.ContainsAny(id[1:len(id)-1], "<> \t\r\n")
+}